@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func cache_main(args []string) {
+	cache, err := getTranscodeCache()
+	croak(err)
+	if cache == nil {
+		log.Fatal("The transcode cache is disabled")
+	}
+
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	if action == "list" {
+		entries, err := cache.Entries()
+		croak(err)
+
+		var total int64
+		for _, e := range entries {
+			fmt.Printf("%s  %10s  %s\n", e.LastUsed.Format("2006-01-02 15:04"), formatSize(e.Size), e.Key)
+			total += e.Size
+		}
+		fmt.Printf("%d entries in %s, totalling %s", len(entries), cache.Dir(), formatSize(total))
+		if cache.MaxSize() > 0 {
+			fmt.Printf(" of %s", formatSize(cache.MaxSize()))
+		}
+		fmt.Println()
+	} else if action == "prune" || action == "clear" {
+		before, err := cache.Size()
+		croak(err)
+
+		if action == "prune" {
+			_, err = cache.Prune(cache.MaxSize())
+		} else {
+			_, err = cache.Clear()
+		}
+		croak(err)
+
+		after, err := cache.Size()
+		croak(err)
+		fmt.Printf("Removed %s from %s; %s remaining\n", formatSize(before-after), cache.Dir(), formatSize(after))
+	} else {
+		fmt.Fprintf(os.Stderr, "Usage: speeldoos cache [list|prune|clear]\n")
+		os.Exit(1)
+	}
+}
+
+func formatSize(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
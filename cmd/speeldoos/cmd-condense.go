@@ -11,6 +11,7 @@ import (
 
 	tc "github.com/thijzert/go-termcolours"
 	"github.com/thijzert/speeldoos/lib/hivemind"
+	"github.com/thijzert/speeldoos/lib/transcodecache"
 	"github.com/thijzert/speeldoos/lib/wavreader"
 	"github.com/thijzert/speeldoos/lib/ziptraverser"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
@@ -18,10 +19,77 @@ import (
 
 type condenseJob struct {
 	Wavconf   wavreader.Config
+	Library   *speeldoos.Library
+	Cache     *transcodecache.Cache
 	Carrier   *speeldoos.Carrier
 	OutputDir string
 }
 
+// encode writes one performance as MP3, using the transcode cache if available
+func (job condenseJob) encode(zm ziptraverser.ZipTraverser, pf speeldoos.Performance, out io.Writer) error {
+	if job.Cache == nil {
+		return job.transcode(zm, pf, out)
+	}
+
+	hash, err := job.Library.SourceHash(pf)
+	if err != nil {
+		return err
+	}
+
+	key := transcodecache.Key(hash, job.Wavconf.MP3Settings())
+	f, err := job.Cache.GetOrCreate(key, func(w io.Writer) error {
+		return job.transcode(zm, pf, w)
+	})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(out, f)
+	return err
+}
+
+// transcode decodes all source files of a performance, and encodes them into one MP3 file
+func (job condenseJob) transcode(zm ziptraverser.ZipTraverser, pf speeldoos.Performance, out io.Writer) error {
+	var wout wavreader.Writer
+
+	for _, fn := range pf.SourceFiles {
+		f, err := zm.Get(path.Join(Config.LibraryDir, fn.Filename))
+		if err != nil {
+			return err
+		}
+
+		wav, err := speeldoos.DecodeSourceFile(job.Wavconf, f, fn)
+		if err != nil {
+			return err
+		}
+		defer wav.Close()
+
+		if wout == nil {
+			wout, err = job.Wavconf.ToMP3(out, wav.Format())
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = io.Copy(wout, wav)
+		if err != nil {
+			wout.CloseWithError(err)
+			return err
+		}
+	}
+
+	if wout == nil {
+		return fmt.Errorf("no audio found")
+	}
+
+	err := wout.Close()
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
 func (job condenseJob) Run(h hivemind.JC) error {
 	zm := ziptraverser.New()
 	defer zm.Close()
@@ -67,37 +135,12 @@ func (job condenseJob) Run(h hivemind.JC) error {
 		}
 		defer out.Close()
 
-		var wout io.WriteCloser = nil
-
-		for _, fn := range pf.SourceFiles {
-			f, err := zm.Get(path.Join(Config.LibraryDir, fn.Filename))
-
-			wav, err := job.Wavconf.FromFLAC(f)
-			if err != nil {
-				h.Println(err.Error())
-				continue
-			}
-			wav.Init()
-			defer wav.Close()
-
-			if wout == nil {
-				wout, err = job.Wavconf.ToMP3(out, wav.Format())
-				if err != nil {
-					h.Println(err.Error())
-					continue
-				}
-			}
-
-			_, err = io.Copy(wout, wav)
-			if err != nil {
-				return err
-			}
-		}
-
-		if wout == nil {
-			break
+		err = job.encode(zm, pf, out)
+		if err != nil {
+			h.Println(err.Error())
+			continue
 		}
-		wout.Close()
+		out.Close()
 
 		tags := &mFile{
 			Artist:     pf.Work.Composer.Name, // MP3 players are dumb
@@ -148,7 +191,11 @@ func condense_main(args []string) {
 		VBRQuality: Config.Condense.Quality,
 	}
 
-	d, err := allCarriers()
+	l, err := getLibrary()
+	croak(err)
+	d := l.AllCarriers()
+
+	cache, err := getTranscodeCache()
 	croak(err)
 
 	croak(os.MkdirAll(Config.Condense.OutputDir, 0755))
@@ -184,7 +231,7 @@ func condense_main(args []string) {
 		tim := file.ModTime().Add(-24 * time.Hour)
 		croak(os.Chtimes(outdir, tim, tim))
 
-		hive.AddJob(condenseJob{wavconf, foo, outdir})
+		hive.AddJob(condenseJob{wavconf, l, cache, foo, outdir})
 	}
 
 	hive.Wait()
@@ -19,13 +19,17 @@ func extract_main(args []string) {
 		VBRQuality: Config.Condense.Quality,
 	}
 
+	l := speeldoos.NewLibrary(Config.LibraryDir)
+	cache, err := getTranscodeCache()
+	croak(err)
+
 	hive := hivemind.New(Config.ConcurrentJobs)
 
 	for _, xml := range args {
 		foo, err := speeldoos.ImportCarrier(xml)
 		croak(err)
 
-		hive.AddJob(condenseJob{wavconf, foo, "."})
+		hive.AddJob(condenseJob{wavconf, l, cache, foo, "."})
 	}
 
 	hive.Wait()
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/thijzert/speeldoos/lib/cdrip"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
 )
 
@@ -153,12 +155,219 @@ func detectAllFiles(dirname, ext string) map[int]detectedDisc {
 	return rv
 }
 
+// A detectedTrack contains what a cue sheet says about a track
+type detectedTrack struct {
+	title, performer, songwriter, isrc string
+
+	// If the track is part of a single-file rip, the image and the samples it covers
+	image      string
+	start, end int64
+}
+
+// A detectedRip contains the details of one disc, from its cue sheet or EAC log
+type detectedRip struct {
+	title, catalog string
+	tracks         []detectedTrack
+
+	// The name of the audio file, if the entire disc was ripped to one file
+	// that still needs to be split
+	image, cuesheet string
+}
+
+// findFile returns the only file in a directory with the specified extension
+func findFile(dirname, ext string) string {
+	names, _ := filepath.Glob(path.Join(dirname, "*"+ext))
+	if len(names) == 1 {
+		return names[0]
+	}
+	return ""
+}
+
+func detectRip(dirname, cuesheet, logfile string) (detectedRip, bool) {
+	var rv detectedRip
+
+	if cuesheet == "" {
+		cuesheet = findFile(dirname, ".cue")
+	}
+	if cuesheet != "" {
+		f, err := os.Open(cuesheet)
+		croak(err)
+		cue, err := cdrip.ParseCueSheet(f)
+		f.Close()
+		croak(err)
+
+		rv.title = cue.Title
+		rv.catalog = cue.Catalog
+		for _, t := range cue.Tracks() {
+			dt := detectedTrack{
+				title:      t.Title,
+				performer:  t.Performer,
+				songwriter: t.Songwriter,
+				isrc:       t.ISRC,
+			}
+			if dt.performer == "" {
+				dt.performer = cue.Performer
+			}
+			if dt.songwriter == "" {
+				dt.songwriter = cue.Songwriter
+			}
+			rv.tracks = append(rv.tracks, dt)
+		}
+		if cue.SingleFile() {
+			rv.image = path.Join(path.Dir(cuesheet), cue.Files[0].Name)
+			rv.cuesheet = cuesheet
+
+			// FLAC images can be played as they are; the tracks are ranges within them
+			if strings.ToLower(path.Ext(rv.image)) == ".flac" {
+				ct := cue.Files[0].Tracks
+				for j := range rv.tracks {
+					rv.tracks[j].image = rv.image
+					rv.tracks[j].start = int64(ct[j].Start()) * cdrip.SamplesPerFrame
+					if j+1 < len(ct) {
+						rv.tracks[j].end = int64(ct[j+1].Start()) * cdrip.SamplesPerFrame
+					}
+				}
+				rv.image = ""
+			}
+		}
+		return rv, true
+	}
+
+	// Without a cue sheet, an EAC log at least has the number of tracks
+	if logfile == "" {
+		logfile = findFile(dirname, ".log")
+	}
+	if logfile != "" {
+		f, err := os.Open(logfile)
+		croak(err)
+		log, err := cdrip.ParseEACLog(f)
+		f.Close()
+		if err != nil {
+			if Config.Init.EACLogfile != "" {
+				croak(err)
+			}
+			return rv, false
+		}
+
+		rv.title = log.Title
+		for range log.TOC {
+			rv.tracks = append(rv.tracks, detectedTrack{performer: log.Artist})
+		}
+		return rv, true
+	}
+
+	return rv, false
+}
+
+// detectAllRips finds the cue sheet or EAC log for each disc
+func detectAllRips(discs map[int]detectedDisc) map[int]detectedRip {
+	rv := make(map[int]detectedRip)
+
+	if Config.Init.Cuesheet != "" || Config.Init.EACLogfile != "" {
+		if dr, ok := detectRip(".", Config.Init.Cuesheet, Config.Init.EACLogfile); ok {
+			rv[0] = dr
+		}
+		return rv
+	}
+
+	for i, dd := range discs {
+		if dr, ok := detectRip(dd.path, "", ""); ok {
+			rv[i] = dr
+		}
+	}
+	if len(rv) == 0 {
+		if dr, ok := detectRip(".", "", ""); ok {
+			rv[0] = dr
+		}
+	}
+
+	return rv
+}
+
+// groupWorks divides tracks into works, by the work titles at the start of their titles
+func groupWorks(tracks []detectedTrack) []int {
+	var rv []int
+	for i := 0; i < len(tracks); {
+		work, _, ok := speeldoos.SplitTitle(tracks[i].title)
+		end := i + 1
+		for ok && end < len(tracks) {
+			if w, _, ok := speeldoos.SplitTitle(tracks[end].title); !ok || w != work {
+				break
+			}
+			end++
+		}
+		rv = append(rv, end-i)
+		i = end
+	}
+	return rv
+}
+
+// workTitles derives the title of a work and its n parts from the titles of its tracks, if known
+func workTitles(tracks []detectedTrack, n int) (string, []string) {
+	title := "2222"
+	parts := make([]string, n)
+	if len(tracks) == 1 && tracks[0].title != "" {
+		title = tracks[0].title
+	} else if len(tracks) > 0 {
+		if w, _, ok := speeldoos.SplitTitle(tracks[0].title); ok {
+			title = w
+		}
+	}
+
+	for j := range parts {
+		if j < len(tracks) {
+			parts[j] = tracks[j].title
+			if w, p, ok := speeldoos.SplitTitle(tracks[j].title); ok && w == title {
+				parts[j] = p
+			}
+		}
+		if parts[j] == "" {
+			parts[j] = "2222"
+		}
+	}
+	return title, parts
+}
+
 func init_main(args []string) {
-	if len(args) == 0 {
+	detectedSourceFiles := detectAllFiles(".", ".flac")
+	detectedRips := detectAllRips(detectedSourceFiles)
+
+	if len(args) == 0 && len(detectedRips) == 0 {
 		croak(fmt.Errorf("Specify at least one number of parts"))
 	}
 
-	detectedSourceFiles := detectAllFiles(".", ".flac")
+	// The cue sheets or EAC logs list the tracks on each disc
+	var ripDiscs []int
+	for i := range detectedRips {
+		ripDiscs = append(ripDiscs, i)
+	}
+	sort.Ints(ripDiscs)
+
+	var ripTracks []detectedTrack
+	var ripSizes []string
+	var images []detectedRip
+	var imageDiscs []int
+	singleFile := make(map[int]bool)
+	for d, i := range ripDiscs {
+		dr := detectedRips[i]
+		ripTracks = append(ripTracks, dr.tracks...)
+		ripSizes = append(ripSizes, strconv.Itoa(len(dr.tracks)))
+
+		// The tracks of single-file rips don't have source files of their own
+		if dr.image != "" || (len(dr.tracks) > 0 && dr.tracks[0].image != "") {
+			if dd, ok := detectedSourceFiles[i]; ok && len(dd.files) == 1 {
+				delete(detectedSourceFiles, i)
+			}
+			singleFile[d+1] = true
+		}
+		if dr.image != "" {
+			images = append(images, dr)
+			imageDiscs = append(imageDiscs, d+1)
+		}
+	}
+	if len(ripDiscs) > 1 && Config.Init.Discs == "" {
+		Config.Init.Discs = strings.Join(ripSizes, " ")
+	}
 
 	pfsize := make([]int, 0, len(args))
 	total_tracks := 0
@@ -173,6 +382,15 @@ func init_main(args []string) {
 		total_tracks += n
 	}
 
+	if len(ripTracks) > 0 {
+		if len(args) == 0 {
+			pfsize = groupWorks(ripTracks)
+			total_tracks = len(ripTracks)
+		} else if total_tracks != len(ripTracks) {
+			croak(fmt.Errorf("Have %d parts, but the cue sheet lists %d tracks.", total_tracks, len(ripTracks)))
+		}
+	}
+
 	discsize := []int{total_tracks}
 	if Config.Init.Discs != "" {
 		discsize = discsize[0:0]
@@ -199,8 +417,8 @@ func init_main(args []string) {
 
 	if len(discsize) > 1 {
 		if len(detectedSourceFiles) > 0 {
-			if len(detectedSourceFiles) != len(discsize) {
-				croak(fmt.Errorf("Have %d discs, but detected %d sets of source files.", len(discsize), len(detectedSourceFiles)))
+			if len(detectedSourceFiles)+len(singleFile) != len(discsize) {
+				croak(fmt.Errorf("Have %d discs, but detected %d sets of source files.", len(discsize), len(detectedSourceFiles)+len(singleFile)))
 			}
 
 			for i, size := range discsize {
@@ -208,7 +426,7 @@ func init_main(args []string) {
 					if len(dd.files) != size {
 						croak(fmt.Errorf("Disc %d: expected %d tracks, but detected %d source files.", i+1, size, len(dd.files)))
 					}
-				} else {
+				} else if !singleFile[i+1] {
 					croak(fmt.Errorf("Source files for disc %d not autodetected", i+1))
 				}
 			}
@@ -234,19 +452,47 @@ func init_main(args []string) {
 	foo.Name = "2222"
 	foo.ID = "2222"
 	foo.Source = "2222"
-	foo.Performances = make([]speeldoos.Performance, 0, len(args))
+	foo.Performances = make([]speeldoos.Performance, 0, len(pfsize))
 
-	indexName := defaultIndexNames[Config.Init.Composer]
+	if len(ripDiscs) > 0 {
+		dr := detectedRips[ripDiscs[0]]
+		if dr.title != "" {
+			foo.Name = dr.title
+		}
+		if dr.catalog != "" {
+			foo.ID = dr.catalog
+		}
+		foo.Source = "CD"
+	}
 
 	disc_index := 0
 	track_counter := 1
+	first_track := 0
 
 	for _, n := range pfsize {
+		var tracks []detectedTrack
+		if first_track+n <= len(ripTracks) {
+			tracks = ripTracks[first_track : first_track+n]
+		}
+		first_track += n
+		title, parts := workTitles(tracks, n)
+
+		composer := Config.Init.Composer
+		if composer == "2222" && len(tracks) > 0 && tracks[0].songwriter != "" {
+			composer = tracks[0].songwriter
+		}
+		indexName := defaultIndexNames[composer]
+
+		opus := speeldoos.ParseCatalogueNumbers(title)
+		if len(opus) == 0 {
+			opus = []speeldoos.OpusNumber{{IndexName: indexName, Number: "2222"}}
+		}
+
 		pf := speeldoos.Performance{
 			Work: speeldoos.Work{
-				Composer:   speeldoos.Composer{Name: Config.Init.Composer, ID: strings.Replace(Config.Init.Composer, " ", "_", -1)},
-				Title:      []speeldoos.Title{speeldoos.Title{"2222", ""}},
-				OpusNumber: []speeldoos.OpusNumber{speeldoos.OpusNumber{IndexName: indexName, Number: "2222"}},
+				Composer:   speeldoos.Composer{Name: composer, ID: strings.Replace(composer, " ", "_", -1)},
+				Title:      []speeldoos.Title{{Title: title}},
+				OpusNumber: opus,
 				Year:       2222,
 			},
 			Year:        Config.Init.Year,
@@ -267,6 +513,14 @@ func init_main(args []string) {
 			pf.Performers = append(pf.Performers, speeldoos.Performer{Name: Config.Init.Conductor, Role: "conductor"})
 		}
 
+		if len(pf.Performers) == 0 {
+			// The performers in the cue sheet don't come with a role
+			for _, t := range tracks {
+				if t.performer != "" && !hasPerformer(pf.Performers, t.performer) {
+					pf.Performers = append(pf.Performers, speeldoos.Performer{Name: t.performer, Role: "2222"})
+				}
+			}
+		}
 		if len(pf.Performers) == 0 {
 			pf.Performers = append(pf.Performers, speeldoos.Performer{Name: "2222", Role: "2222"})
 		}
@@ -276,7 +530,7 @@ func init_main(args []string) {
 		}
 		for j := 0; j < n; j++ {
 			if n > 1 {
-				pf.Work.Parts[j].Part = "2222"
+				pf.Work.Parts[j].Part = parts[j]
 			}
 			if len(discsize) > 1 {
 				fn := path.Join(fmt.Sprintf(Config.Init.DiscFormat, disc_index+1), fmt.Sprintf(Config.Init.TrackFormat, track_counter))
@@ -297,6 +551,14 @@ func init_main(args []string) {
 					Filename: fn,
 				}
 			}
+			if j < len(tracks) {
+				pf.SourceFiles[j].ISRC = tracks[j].isrc
+				if tracks[j].image != "" {
+					pf.SourceFiles[j].Filename = tracks[j].image
+					pf.SourceFiles[j].Start = tracks[j].start
+					pf.SourceFiles[j].End = tracks[j].end
+				}
+			}
 			track_counter++
 			if track_counter > discsize[disc_index] {
 				track_counter = 1
@@ -318,4 +580,23 @@ func init_main(args []string) {
 	fmt.Fprintf(os.Stderr, "Success. If you saved the output of this script somewhere, use your favorite\n"+
 		"text editor to fill in the missing details. Pro tip: search for '2222' to\n"+
 		"quickly hop between every field that's been left blank.\n")
+
+	for i, dr := range images {
+		dir := "."
+		if len(discsize) > 1 {
+			dir = fmt.Sprintf(Config.Init.DiscFormat, imageDiscs[i])
+		}
+		fmt.Fprintf(os.Stderr, "\n%s contains an entire disc, but only FLAC images can be played as they are.\n"+
+			"Split it into tracks that match the source files above before continuing, e.g. using shnsplit:\n"+
+			"    shnsplit -f \"%s\" -d \"%s\" -o flac -t \"track_%%n\" \"%s\"\n", dr.image, dr.cuesheet, dir, dr.image)
+	}
+}
+
+func hasPerformer(performers []speeldoos.Performer, name string) bool {
+	for _, p := range performers {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
 }
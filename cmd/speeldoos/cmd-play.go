@@ -4,6 +4,9 @@ import (
 	"context"
 	"io"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
@@ -12,6 +15,11 @@ import (
 
 func play_main(args []string) {
 
+	// Stop playing on ^C, and take mplayer and any decoders down with us
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	Config.WAVConf.Context = ctx
+
 	l := speeldoos.NewLibrary(Config.LibraryDir)
 	l.WAVConf = Config.WAVConf
 	l.Refresh()
@@ -25,7 +33,21 @@ func play_main(args []string) {
 		log.Fatal(err)
 	}
 
-	ctx := context.Background()
+	if Config.Play.For != "" {
+		window, err := speeldoos.ParseWindow(Config.Play.For, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		prog, err := sch.FillWindow(window)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Programme: %s", prog)
+
+		sch.StopAfterQueue = true
+	}
+
 	go sch.Run(ctx)
 
 	output, err := Config.WAVConf.AudioOutput()
@@ -14,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -53,6 +54,9 @@ func confirmSettings() *speeldoos.Carrier {
 	ccp := &commonPath{}
 	for _, pf := range carrier.Performances {
 		for _, sf := range pf.SourceFiles {
+			if sf.Ranged() {
+				log.Fatalf("%s contains more than one track; split it into tracks first", sf.Filename)
+			}
 			discs[sf.Disc] = sf.Disc
 			ccp.Add(sf.Disc, sf.Filename)
 		}
@@ -527,6 +531,8 @@ func seedvault_main(argv []string) {
 			}
 		}
 
+		bar.Attachments = archiveAttachments(path.Join(Config.Seedvault.OutputDir, source_dir), archive_name+".zip", albus.Discs)
+
 		bar.Write(path.Join(Config.Seedvault.OutputDir, archive_name+".xml"))
 
 		log.Printf("Done.")
@@ -750,6 +756,41 @@ func (a *album) Job(dir string, fun jobFun) {
 	}
 }
 
+// archiveAttachments lists the attachments that were copied into the source
+// directory of an archive, with their path inside the archive
+func archiveAttachments(source_dir, archive string, discs []int) []speeldoos.Attachment {
+	var rv []speeldoos.Attachment
+	add := func(attachmentType string, disc int, name string) {
+		dd := ""
+		if disc != 0 {
+			dd = fmt.Sprintf("disc_%02d", disc)
+		}
+		if _, err := os.Stat(path.Join(source_dir, dd, name)); err == nil {
+			rv = append(rv, speeldoos.Attachment{
+				Type:     attachmentType,
+				Disc:     disc,
+				Filename: path.Join(archive, dd, name),
+			})
+		}
+	}
+
+	sorted := append([]int{}, discs...)
+	sort.Ints(sorted)
+
+	add(speeldoos.AttachmentCover, 0, "folder.jpg")
+	add(speeldoos.AttachmentInlay, 0, "inlay.jpg")
+	for _, d := range sorted {
+		add(speeldoos.AttachmentDisc, d, "disc.jpg")
+	}
+	add(speeldoos.AttachmentBooklet, 0, "booklet.pdf")
+	for _, d := range sorted {
+		add(speeldoos.AttachmentEACLog, d, "eac.log")
+		add(speeldoos.AttachmentCuesheet, d, "cuesheet.cue")
+	}
+
+	return rv
+}
+
 func lameRun(extraArgs ...string) jobFun {
 	return func(s *mFile, wav, out string) []runner {
 		mp3 := out + ".mp3"
@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 
 	plumbing "github.com/thijzert/speeldoos/internal/web-plumbing"
+	"github.com/thijzert/speeldoos/lib/users"
 	"github.com/thijzert/speeldoos/lib/wavreader"
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
@@ -31,10 +39,77 @@ func server_main(args []string) {
 	l.WAVConf = Config.WAVConf
 	l.Refresh()
 
+	cache, err := getTranscodeCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	conf := plumbing.ServerConfig{
-		Context:      context.Background(),
-		Library:      l,
-		StreamConfig: mc,
+		Context:        context.Background(),
+		Library:        l,
+		StreamConfig:   mc,
+		TranscodeCache: cache,
+		Gzip:           Config.Server.Gzip,
+		StateFile:      Config.Server.StateFile,
+	}
+
+	if conf.StateFile == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			conf.StateFile = filepath.Join(dir, "speeldoos", "server-state.json")
+		}
+	}
+
+	if Config.UsersFile != "" {
+		conf.Users, err = users.Load(Config.UsersFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(conf.Users.Users()) == 0 {
+			log.Printf("Warning: there are no users in %s; nobody will be able to log in", Config.UsersFile)
+		}
+	}
+
+	if Config.Server.AccessLog {
+		conf.AccessLog = os.Stderr
+	}
+	for _, o := range strings.Split(Config.Server.CORSOrigins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			conf.CORSOrigins = append(conf.CORSOrigins, o)
+		}
+	}
+
+	if Config.Server.FLAC.Enabled {
+		conf.FLACConfig = &chunker.OggFLACChunkConfig{
+			Audio: wavreader.Config{
+				FlacPath:        Config.Tools.Flac,
+				FLACCompression: Config.Server.FLAC.Compression,
+				PlaybackFormat:  Config.WAVConf.PlaybackFormat,
+			},
+		}
+	}
+	if Config.Server.Opus.Enabled {
+		conf.OpusConfig = &chunker.OpusChunkConfig{
+			Audio: wavreader.Config{
+				OpusencPath:    Config.Tools.Opusenc,
+				OpusBitrate:    Config.Server.Opus.Bitrate,
+				PlaybackFormat: Config.WAVConf.PlaybackFormat,
+			},
+		}
+	}
+
+	for _, sd := range Config.Server.Stations {
+		sc := plumbing.StationConfig{
+			Name:         sd.Name,
+			Query:        sd.Query,
+			StreamConfig: mc,
+			FLACConfig:   conf.FLACConfig,
+			OpusConfig:   conf.OpusConfig,
+		}
+		if sd.MaxBitrate != 0 || sd.VBRQuality != 0 {
+			sc.StreamConfig.Audio.MaxBitrate = sd.MaxBitrate
+			sc.StreamConfig.Audio.VBRQuality = sd.VBRQuality
+		}
+		conf.Stations = append(conf.Stations, sc)
 	}
 	s, err := plumbing.New(conf)
 	if err != nil {
@@ -46,9 +121,186 @@ func server_main(args []string) {
 		log.Fatal(err)
 	}
 
-	log.Printf("Listening on %s", Config.Server.Listen)
-
 	var srv http.Server
 	srv.Handler = s
-	log.Fatal(srv.Serve(ln))
+
+	certs, err := getCertificates()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	serveErr := make(chan error, 1)
+	if certs == nil {
+		log.Printf("Listening on %s", Config.Server.Listen)
+		go func() {
+			serveErr <- srv.Serve(ln)
+		}()
+	} else {
+		serveTLS(&srv, ln, certs, serveErr)
+	}
+
+	select {
+	case err := <-serveErr:
+		s.Close()
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Printf("Received %s; shutting down", sig)
+	}
+
+	// Stop accepting new connections, and give listeners some time to hear
+	// what's left in the buffers
+	ctx, cancel := context.WithTimeout(context.Background(), Config.Server.ShutdownTimeout)
+	defer cancel()
+
+	httpDone := make(chan struct{})
+	go func() {
+		if srv.Shutdown(ctx) != nil {
+			srv.Close()
+		}
+		close(httpDone)
+	}()
+
+	err = s.Shutdown(ctx)
+	if err != nil && err != context.DeadlineExceeded {
+		log.Printf("Error shutting down: %v", err)
+	}
+	<-httpDone
+	log.Printf("Bye")
+}
+
+// serveTLS serves HTTPS in the background, and reloads the certificate on SIGHUP
+func serveTLS(srv *http.Server, ln net.Listener, certs *plumbing.CertificateLoader, serveErr chan<- error) {
+	srv.TLSConfig = certs.TLSConfig()
+
+	// Reload the certificate on SIGHUP, e.g. after it's been renewed
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := certs.Reload(); err != nil {
+				log.Printf("Error reloading TLS certificate: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificate")
+			}
+		}
+	}()
+
+	if Config.Server.TLS.RedirectListen != "" {
+		go func() {
+			log.Printf("Redirecting HTTP requests on %s", Config.Server.TLS.RedirectListen)
+			log.Fatal(http.ListenAndServe(Config.Server.TLS.RedirectListen, plumbing.RedirectToHTTPS(Config.Server.Listen)))
+		}()
+	}
+
+	log.Printf("Listening on %s (HTTPS)", Config.Server.Listen)
+	go func() {
+		serveErr <- srv.ServeTLS(ln, "", "")
+	}()
+}
+
+// getCertificates loads the TLS certificate, generating a self-signed one if
+// needed. It returns nil if TLS isn't configured.
+func getCertificates() (*plumbing.CertificateLoader, error) {
+	conf := Config.Server.TLS
+	if conf.Cert == "" && conf.Key == "" && !conf.SelfSigned {
+		return nil, nil
+	}
+
+	if conf.SelfSigned {
+		if conf.Cert == "" || conf.Key == "" {
+			dir, err := os.UserConfigDir()
+			if err != nil {
+				return nil, err
+			}
+			dir = filepath.Join(dir, "speeldoos", "tls")
+			if conf.Cert == "" {
+				conf.Cert = filepath.Join(dir, "cert.pem")
+			}
+			if conf.Key == "" {
+				conf.Key = filepath.Join(dir, "key.pem")
+			}
+		}
+
+		_, errCert := os.Stat(conf.Cert)
+		_, errKey := os.Stat(conf.Key)
+		if os.IsNotExist(errCert) || os.IsNotExist(errKey) {
+			hosts := plumbing.LocalHostNames()
+			log.Printf("Generating a self-signed certificate for %s", strings.Join(hosts, ", "))
+			err := plumbing.GenerateSelfSigned(conf.Cert, conf.Key, hosts)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Wrote certificate to %s", conf.Cert)
+		}
+	} else if conf.Cert == "" || conf.Key == "" {
+		return nil, fmt.Errorf("both --tls_cert and --tls_key are needed for HTTPS")
+	}
+
+	return plumbing.NewCertificateLoader(conf.Cert, conf.Key)
+}
+
+// A stationDef holds the command-line definition of an additional station
+type stationDef struct {
+	Name       string
+	Query      string
+	MaxBitrate int
+	VBRQuality int
+}
+
+// A stationList collects station definitions from repeated command-line flags
+type stationList []stationDef
+
+func (l *stationList) String() string {
+	if l == nil {
+		return ""
+	}
+	names := make([]string, len(*l))
+	for i, sd := range *l {
+		names[i] = sd.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (l *stationList) Set(value string) error {
+	parts := strings.Split(value, ";")
+
+	sd := stationDef{
+		Name: strings.TrimSpace(parts[0]),
+	}
+	if sd.Name == "" || strings.ContainsAny(sd.Name, "/?#") {
+		return fmt.Errorf("invalid station name '%s'", sd.Name)
+	}
+	for _, other := range *l {
+		if other.Name == sd.Name {
+			return fmt.Errorf("duplicate station name '%s'", sd.Name)
+		}
+	}
+
+	var err error
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("station '%s': expected key=value pair; got '%s'", sd.Name, part)
+		}
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		if k == "query" {
+			sd.Query = v
+		} else if k == "bitrate" {
+			sd.MaxBitrate, err = strconv.Atoi(v)
+		} else if k == "vbr" {
+			sd.VBRQuality, err = strconv.Atoi(v)
+		} else {
+			return fmt.Errorf("station '%s': unknown setting '%s'", sd.Name, k)
+		}
+		if err != nil {
+			return fmt.Errorf("station '%s': %v", sd.Name, err)
+		}
+	}
+
+	*l = append(*l, sd)
+	return nil
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/thijzert/speeldoos/lib/users"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func users_main(args []string) {
+	if Config.UsersFile == "" {
+		log.Fatal("No users file configured. Set one with --users_file")
+	}
+
+	store, err := users.Load(Config.UsersFile)
+	croak(err)
+
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:]
+	}
+
+	if action == "list" {
+		for _, u := range store.Users() {
+			fmt.Printf("%-20s %-10s", u.Name, u.Role)
+			for _, t := range u.Tokens {
+				fmt.Printf(" [token '%s', %s]", t.Label, t.Created.Format("2006-01-02"))
+			}
+			fmt.Println()
+		}
+		return
+	}
+
+	if len(args) < 1 {
+		users_usage()
+	}
+	name := args[0]
+
+	if action == "add" {
+		role := users.RoleListener
+		if len(args) > 1 {
+			role, err = users.ParseRole(args[1])
+			croak(err)
+		}
+		croak(store.Add(name, role))
+		croak(store.SetPassword(name, readNewPassword(name)))
+	} else if action == "passwd" {
+		croak(store.SetPassword(name, readNewPassword(name)))
+	} else if action == "role" && len(args) == 2 {
+		role, err := users.ParseRole(args[1])
+		croak(err)
+		croak(store.SetRole(name, role))
+	} else if action == "remove" {
+		croak(store.Remove(name))
+	} else if action == "token" {
+		label := "default"
+		if len(args) > 1 {
+			label = args[1]
+		}
+		token, err := store.NewToken(name, label)
+		croak(err)
+		fmt.Println(token)
+	} else if action == "revoke" && len(args) == 2 {
+		croak(store.RevokeToken(name, args[1]))
+	} else {
+		users_usage()
+	}
+
+	croak(store.Save())
+}
+
+func users_usage() {
+	fmt.Fprintf(os.Stderr, "Usage: speeldoos users list\n")
+	fmt.Fprintf(os.Stderr, "       speeldoos users add NAME [listener|dj|admin]\n")
+	fmt.Fprintf(os.Stderr, "       speeldoos users passwd NAME\n")
+	fmt.Fprintf(os.Stderr, "       speeldoos users role NAME listener|dj|admin\n")
+	fmt.Fprintf(os.Stderr, "       speeldoos users remove NAME\n")
+	fmt.Fprintf(os.Stderr, "       speeldoos users token NAME [LABEL]\n")
+	fmt.Fprintf(os.Stderr, "       speeldoos users revoke NAME LABEL\n")
+	os.Exit(1)
+}
+
+// readNewPassword asks for a new password. If standard input isn't a
+// terminal, the password is read from its first line instead.
+func readNewPassword(name string) string {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if line == "" {
+			croak(err)
+		}
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	fmt.Fprintf(os.Stderr, "New password for %s: ", name)
+	pw, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	croak(err)
+
+	fmt.Fprintf(os.Stderr, "Repeat password: ")
+	pw2, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	croak(err)
+
+	if string(pw) != string(pw2) {
+		croak(errors.New("passwords don't match"))
+	}
+	if len(pw) == 0 {
+		croak(errors.New("empty password"))
+	}
+	return string(pw)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/thijzert/speeldoos/lib/cdrip"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+// A ripLog is a log file to check one disc of a carrier against
+type ripLog struct {
+	Disc     int
+	Filename string
+	Log      *cdrip.RipLog
+}
+
+func verify_rip_main(args []string) {
+	if Config.VerifyRip.Logfile != "" && len(args) != 1 {
+		croak(fmt.Errorf("Specify the ID of the carrier the log file belongs to"))
+	}
+
+	lib, err := getLibrary()
+	if err != nil {
+		log.Fatalf("Unable to open library: %s", err)
+	}
+	lib.WAVConf = Config.WAVConf
+
+	exitStatus := 0
+
+	for _, pc := range lib.AllCarriers() {
+		if len(args) > 0 {
+			found := false
+			for _, arg := range args {
+				if pc.Carrier.ID == arg {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		// Inbox items have no carrier file to store the results in until
+		// they're tagged
+		if !strings.HasSuffix(pc.Filename, ".xml") {
+			if len(args) > 0 {
+				exitStatus = 1
+				fmt.Printf("%s: not tagged yet\n", pc.Filename)
+			}
+			continue
+		}
+
+		logs, err := findRipLogs(lib, pc.Carrier)
+		if err != nil {
+			exitStatus = 1
+			fmt.Printf("%s: %s\n", pc.Filename, err)
+			continue
+		}
+		if len(logs) == 0 {
+			if len(args) > 0 {
+				exitStatus = 1
+				fmt.Printf("%s: no rip logs found\n", pc.Filename)
+			}
+			continue
+		}
+
+		modified := false
+		for _, rl := range logs {
+			v, err := lib.VerifyRip(pc.Carrier, rl.Disc, rl.Filename, rl.Log)
+			if err != nil {
+				exitStatus = 1
+				fmt.Printf("%s: %s\n", pc.Filename, err)
+				continue
+			}
+
+			printRipVerification(pc.Filename, v)
+			if !v.OK() {
+				exitStatus = 1
+			}
+
+			pc.Carrier.SetRipVerification(v)
+			modified = true
+		}
+
+		if modified {
+			croak(lib.SaveCarrier(pc.Carrier))
+		}
+	}
+
+	os.Exit(exitStatus)
+}
+
+// findRipLogs returns the log given on the command line, or otherwise those
+// among the carrier's attachments
+func findRipLogs(lib *speeldoos.Library, c *speeldoos.Carrier) ([]ripLog, error) {
+	if Config.VerifyRip.Logfile != "" {
+		f, err := os.Open(Config.VerifyRip.Logfile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		rl, err := cdrip.ParseRipLog(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", Config.VerifyRip.Logfile, err)
+		}
+		return []ripLog{{Config.VerifyRip.Disc, Config.VerifyRip.Logfile, rl}}, nil
+	}
+
+	var rv []ripLog
+	for _, a := range lib.Attachments(c) {
+		if a.Type != speeldoos.AttachmentEACLog {
+			continue
+		}
+		rl, err := lib.ReadRipLog(a.Filename)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, ripLog{a.Disc, a.Filename, rl})
+	}
+	return rv, nil
+}
+
+func printRipVerification(filename string, v speeldoos.RipVerification) {
+	disc := ""
+	if v.Disc != 0 {
+		disc = fmt.Sprintf(" disc %d:", v.Disc)
+	}
+	fmt.Printf("%s:%s %s (%s), log checksum %s\n", filename, disc, v.Log, v.Ripper, v.LogChecksum)
+
+	if v.CRC != "" {
+		fmt.Printf("    all tracks: CRC %s\n", verdict(v.CRC))
+	}
+	for _, t := range v.Tracks {
+		var results []string
+		if t.CRC != "" {
+			results = append(results, fmt.Sprintf("CRC %s %s", t.CRC32, verdict(t.CRC)))
+		} else {
+			results = append(results, fmt.Sprintf("CRC %s", t.CRC32))
+		}
+		ar := fmt.Sprintf("AccurateRip %s/%s", t.AccurateRipV1, t.AccurateRipV2)
+		if t.AccurateRip != "" {
+			ar += " " + verdict(t.AccurateRip)
+		}
+		if t.Confidence > 0 {
+			ar += fmt.Sprintf(" (accurately ripped, confidence %d)", t.Confidence)
+		}
+		results = append(results, ar)
+
+		fmt.Printf("    track %2d: %s\n", t.Number, strings.Join(results, "; "))
+	}
+}
+
+func verdict(v speeldoos.Verdict) string {
+	if v == speeldoos.VerdictMatch {
+		return "matches the log"
+	}
+	return "DOES NOT MATCH the log"
+}
@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/thijzert/go-rcfile"
+	"github.com/thijzert/speeldoos/lib/transcodecache"
 	"github.com/thijzert/speeldoos/lib/wavreader"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
 )
@@ -16,13 +18,20 @@ var Config = struct {
 	Subcommand     string
 	ConcurrentJobs int
 	LibraryDir     string
+	UsersFile      string
 	Tools          struct {
 		Flac, Metaflac string
 		Lame           string
 		ID3v2          string
 		MPlayer        string
+		Opusenc        string
+	}
+	WAVConf wavreader.Config
+	Cache   struct {
+		Dir     string
+		MaxSize int
+		Disable bool
 	}
-	WAVConf  wavreader.Config
 	Condense struct {
 		Quality   int
 		OutputDir string
@@ -33,6 +42,25 @@ var Config = struct {
 			MaxBitrate int
 			VBRQuality int
 		}
+		FLAC struct {
+			Enabled     bool
+			Compression int
+		}
+		Opus struct {
+			Enabled bool
+			Bitrate int
+		}
+		Stations    stationList
+		AccessLog   bool
+		Gzip        bool
+		CORSOrigins string
+		TLS         struct {
+			Cert, Key      string
+			SelfSigned     bool
+			RedirectListen string
+		}
+		StateFile       string
+		ShutdownTimeout time.Duration
 	}
 	Extract struct {
 		Bitrate string
@@ -40,6 +68,9 @@ var Config = struct {
 	Grep struct {
 		CaseSensitive bool
 	}
+	Play struct {
+		For string
+	}
 	Init struct {
 		OutputFile                              string
 		TrackFormat, DiscFormat                 string
@@ -47,6 +78,7 @@ var Config = struct {
 		Year                                    int
 		Soloist, Orchestra, Ensemble, Conductor string
 		Discs                                   string
+		Cuesheet, EACLogfile                    string
 	}
 	Seedvault struct {
 		InputXML, OutputDir                        string
@@ -56,6 +88,10 @@ var Config = struct {
 		Tracker                                    string
 		DArchive, D320, DV0, DV2, DV6              bool
 	}
+	VerifyRip struct {
+		Logfile string
+		Disc    int
+	}
 }{}
 
 var cmdline = flag.NewFlagSet("speeldoos", flag.ContinueOnError)
@@ -65,6 +101,7 @@ func init() {
 	// Global settings {{{
 	cmdline.IntVar(&Config.ConcurrentJobs, "j", 2, "Number of concurrent jobs")
 	cmdline.StringVar(&Config.LibraryDir, "library_dir", ".", "Search speeldoos files in this directory")
+	cmdline.StringVar(&Config.UsersFile, "users_file", "", "User accounts for `sd server`; leave empty to disable logging in")
 
 	// }}}
 	// External tools {{{
@@ -73,6 +110,13 @@ func init() {
 	cmdline.StringVar(&Config.Tools.Lame, "tools.lame", "", "Path to `lame`")
 	cmdline.StringVar(&Config.Tools.ID3v2, "tools.id3v2", "", "Path to `id3v2`")
 	cmdline.StringVar(&Config.Tools.MPlayer, "tools.mplayer", "", "Path to `mplayer`")
+	cmdline.StringVar(&Config.Tools.Opusenc, "tools.opusenc", "", "Path to `opusenc`")
+
+	// }}}
+	// Transcode cache {{{
+	cmdline.StringVar(&Config.Cache.Dir, "cache.dir", "", "Transcode cache directory (default: the user's cache directory)")
+	cmdline.IntVar(&Config.Cache.MaxSize, "cache.max_size", 4096, "Maximum size of the transcode cache, in MiB (0 = no limit)")
+	cmdline.BoolVar(&Config.Cache.Disable, "cache.disable", false, "Don't use the transcode cache")
 
 	// }}}
 	// Settings for `sd condense` {{{
@@ -103,6 +147,8 @@ func init() {
 	cmdline.StringVar(&Config.Init.Conductor, "init.conductor", "", "Pre-fill a conductor in each performance")
 
 	cmdline.StringVar(&Config.Init.Discs, "init.discs", "", "A space separated list of the number of tracks in each disc, for a multi-disc release.")
+	cmdline.StringVar(&Config.Init.Cuesheet, "init.cuesheet", "", "Cue sheet to take the track list from (default: look for one next to the source files)")
+	cmdline.StringVar(&Config.Init.EACLogfile, "init.eac_logfile", "", "EAC log file to take the track list from, if there's no cue sheet")
 
 	// }}}
 	// Settings for `sd play` {{{
@@ -112,12 +158,28 @@ func init() {
 	cmdline.IntVar(&Config.WAVConf.PlaybackFormat.Rate, "play.rate", 44100, "Playback sample rate.")
 	cmdline.IntVar(&Config.WAVConf.PlaybackFormat.Bits, "play.bits", 16, "Playback audio resolution")
 
+	cmdline.StringVar(&Config.Play.For, "play.for", "", "Fill a time slot, then stop. Use a duration (e.g. '90m') or an end time (e.g. '23:00')")
+
 	// }}}
 	// Settings for `sd server` {{{
 
 	cmdline.StringVar(&Config.Server.Listen, "server.listen", "localhost:11884", "Address and port on which to listen")
 	cmdline.IntVar(&Config.Server.Encoder.MaxBitrate, "server.encoder.bitrate", 0, "MP3 stream bitrate (ABR mode) (value 16-320; higher is better)")
 	cmdline.IntVar(&Config.Server.Encoder.VBRQuality, "server.encoder.vbr", 0, "MP3 stream quality preset (VBR mode) (value 0-9); lower is better)")
+	cmdline.BoolVar(&Config.Server.FLAC.Enabled, "server.flac", false, "Also stream lossless Ogg-FLAC audio")
+	cmdline.IntVar(&Config.Server.FLAC.Compression, "server.flac.compression", 5, "FLAC stream compression level (value 0-8; higher is smaller)")
+	cmdline.BoolVar(&Config.Server.Opus.Enabled, "server.opus", false, "Also stream Ogg/Opus audio")
+	cmdline.IntVar(&Config.Server.Opus.Bitrate, "server.opus.bitrate", 64, "Opus stream bitrate in kbit/s")
+	cmdline.Var(&Config.Server.Stations, "server.station", "Run an additional station (may be repeated). Syntax: NAME[;query=SEARCH][;bitrate=N][;vbr=N]")
+	cmdline.BoolVar(&Config.Server.AccessLog, "server.access_log", false, "Log every HTTP request")
+	cmdline.BoolVar(&Config.Server.Gzip, "server.gzip", true, "Compress HTML and JSON responses")
+	cmdline.StringVar(&Config.Server.TLS.Cert, "server.tls_cert", "", "Serve HTTPS using this certificate (PEM)")
+	cmdline.StringVar(&Config.Server.TLS.Key, "server.tls_key", "", "Private key for the HTTPS certificate (PEM)")
+	cmdline.BoolVar(&Config.Server.TLS.SelfSigned, "server.tls_self_signed", false, "Generate a self-signed HTTPS certificate if the certificate files don't exist")
+	cmdline.StringVar(&Config.Server.TLS.RedirectListen, "server.redirect_listen", "", "Address and port on which to redirect plain HTTP requests to HTTPS")
+	cmdline.StringVar(&Config.Server.CORSOrigins, "server.cors_origins", "", "Comma-separated list of origins that may use the API from other sites ('*' for any)")
+	cmdline.StringVar(&Config.Server.StateFile, "server.state_file", "", "File that keeps the play queue between restarts (default: server-state.json in your user configuration directory)")
+	cmdline.DurationVar(&Config.Server.ShutdownTimeout, "server.shutdown_timeout", 10*time.Second, "Time to let listeners drain their streams when shutting down")
 
 	// }}}
 	// Settings pertaining to `sd seedvault` {{{
@@ -141,6 +203,11 @@ func init() {
 	cmdline.BoolVar(&Config.Seedvault.DV2, "seedvault.v2", false, "Also encode V2")
 	cmdline.BoolVar(&Config.Seedvault.DV6, "seedvault.v6", false, "Also encode V6 (for audiobooks)")
 
+	// }}}
+	// Settings for `sd verify-rip` {{{
+	cmdline.StringVar(&Config.VerifyRip.Logfile, "verify-rip.logfile", "", "EAC or XLD log file to check against (default: the carrier's attached logs)")
+	cmdline.IntVar(&Config.VerifyRip.Disc, "verify-rip.disc", 0, "The disc the log file belongs to, for a multi-disc release")
+
 	// }}}
 	// }}}
 
@@ -186,21 +253,33 @@ func init() {
 	if Config.Tools.MPlayer == "" {
 		Config.Tools.MPlayer = "mplayer"
 	}
+	if Config.Tools.Opusenc == "" {
+		Config.Tools.Opusenc = "opusenc"
+	}
 
 	Config.WAVConf.PlaybackFormat.Format = 1
 	Config.WAVConf.FlacPath = Config.Tools.Flac
 	Config.WAVConf.LamePath = Config.Tools.Lame
 	Config.WAVConf.MPlayerPath = Config.Tools.MPlayer
+	Config.WAVConf.OpusencPath = Config.Tools.Opusenc
 
 	if Config.ConcurrentJobs < 1 {
 		Config.ConcurrentJobs = 1
 	}
+
+	if Config.Cache.Dir == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			Config.Cache.Dir = filepath.Join(dir, "speeldoos")
+		}
+	}
 }
 
 type SubCommand func([]string)
 
 func getSubCmd(name string) SubCommand {
-	if name == "condense" {
+	if name == "cache" {
+		return cache_main
+	} else if name == "condense" {
 		return condense_main
 	} else if name == "extract" {
 		return extract_main
@@ -216,6 +295,10 @@ func getSubCmd(name string) SubCommand {
 		return seedvault_main
 	} else if name == "server" {
 		return server_main
+	} else if name == "users" {
+		return users_main
+	} else if name == "verify-rip" {
+		return verify_rip_main
 	} else {
 		return nil
 	}
@@ -250,6 +333,14 @@ func getLibrary() (*speeldoos.Library, error) {
 	return l, nil
 }
 
+// getTranscodeCache opens the transcode cache. It returns nil if the cache is disabled.
+func getTranscodeCache() (*transcodecache.Cache, error) {
+	if Config.Cache.Disable || Config.Cache.Dir == "" {
+		return nil, nil
+	}
+	return transcodecache.New(Config.Cache.Dir, int64(Config.Cache.MaxSize)<<20)
+}
+
 func allCarriers() ([]speeldoos.ParsedCarrier, error) {
 	l, er := getLibrary()
 	if er != nil {
@@ -263,7 +354,7 @@ func allCarriersWithErrors() ([]speeldoos.ParsedCarrier, error) {
 	if er != nil {
 		return nil, er
 	}
-	return l.Carriers, nil
+	return l.ParsedCarriers(), nil
 }
 
 func croak(e error) {
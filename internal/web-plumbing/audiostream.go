@@ -1,13 +1,16 @@
 package plumbing
 
 import (
-	"io"
+	"context"
 	"log"
+	"net/http"
 	"time"
 
 	"github.com/thijzert/speeldoos/lib/wavreader"
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
+	"github.com/thijzert/speeldoos/pkg/search"
+	"github.com/thijzert/speeldoos/pkg/web"
 )
 
 type playlistItem struct {
@@ -15,34 +18,228 @@ type playlistItem struct {
 	Wav         wavreader.Reader
 }
 
-func (s *Server) initAudioStream() error {
+// A StationConfig defines one named audio stream with its own programme
+type StationConfig struct {
+	// The station name, as used in its URL (/stations/{name}/stream.mp3)
+	Name string
+
+	// If set, only performances matching this search query are picked at random
+	Query string
+
+	// Encoder settings for the MP3 stream
+	StreamConfig chunker.MP3ChunkConfig
+
+	// Encoder settings for the lossless Ogg-FLAC stream; nil to disable it
+	FLACConfig *chunker.OggFLACChunkConfig
+
+	// Encoder settings for the Ogg/Opus stream; nil to disable it
+	OpusConfig *chunker.OpusChunkConfig
+}
+
+// A station combines a scheduler with the audio streams it feeds
+type station struct {
+	name      string
+	config    StationConfig
+	scheduler *speeldoos.Scheduler
+	chunker   chunker.Chunker
+	flac      chunker.Chunker
+	opus      chunker.Chunker
+	metrics   streamMetrics
+}
+
+type stationContextKey struct{}
+
+func (s *Server) newStation(conf StationConfig, state stationState) (*station, error) {
+	st := &station{
+		name:   conf.Name,
+		config: conf,
+	}
+
 	wc := chunker.WAVChunkConfig{
-		StreamFormat: s.config.StreamConfig.Audio.PlaybackFormat,
+		StreamFormat: conf.StreamConfig.Audio.PlaybackFormat,
 	}
 
 	var err error
 
-	s.scheduler, err = s.config.Library.NewScheduler(wc)
+	st.scheduler, err = s.config.Library.NewScheduler(wc)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	go s.scheduler.Run(s.context)
+	if conf.Query != "" {
+		var sconf search.Config
+		q, err := sconf.Compile(conf.Query)
+		if err != nil {
+			return nil, err
+		}
+		st.scheduler.Filter = q.Matches
+	}
 
-	s.chunker, err = s.config.StreamConfig.NewMP3()
+	st.scheduler.PlayQueue = state.PlayQueue
+	st.scheduler.History = state.History
+
+	go st.scheduler.Run(s.context)
+
+	conf.StreamConfig.Context = s.processes
+	st.chunker, err = conf.StreamConfig.NewMP3()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	err = s.encode(st, st.chunker)
+	if err != nil {
+		return nil, err
+	}
+	go s.watchNowPlaying(st)
+
+	if conf.FLACConfig != nil {
+		fc := *conf.FLACConfig
+		fc.Context = s.processes
+		st.flac, err = fc.NewOggFLAC()
+		if err != nil {
+			return nil, err
+		}
+		err = s.encode(st, st.flac)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.OpusConfig != nil {
+		oc := *conf.OpusConfig
+		oc.Context = s.processes
+		st.opus, err = oc.NewOpus()
+		if err != nil {
+			return nil, err
+		}
+		err = s.encode(st, st.opus)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
 
-	stream, err := s.scheduler.AudioStream.NewStreamWithOffset(25 * time.Second)
+// encode feeds a station's scheduler output into an encoding chunker
+func (s *Server) encode(st *station, enc chunker.Chunker) error {
+	stream, err := st.scheduler.AudioStream.NewStreamWithOffset(25 * time.Second)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	s.encoders.Add(1)
 	go func() {
-		io.Copy(s.chunker, stream)
-		s.chunker.Close()
+		defer s.encoders.Done()
+		chunker.CopyWithAssociatedData(enc, stream)
+		enc.Close()
 	}()
 
 	return nil
 }
+
+// close stops all of a station's audio streams, without waiting for them to
+// finish what's in their buffers
+func (st *station) close() {
+	st.scheduler.AudioStream.CloseWithError(errShuttingDown)
+	for _, enc := range []chunker.Chunker{st.chunker, st.flac, st.opus} {
+		if enc != nil {
+			enc.CloseWithError(errShuttingDown)
+		}
+	}
+}
+
+func (s *Server) initAudioStream(state serverState) error {
+	def := StationConfig{
+		StreamConfig: s.config.StreamConfig,
+		FLACConfig:   s.config.FLACConfig,
+		OpusConfig:   s.config.OpusConfig,
+	}
+
+	var err error
+	s.defaultStation, err = s.newStation(def, state.Stations[def.Name])
+	if err != nil {
+		return err
+	}
+	s.stations = append(s.stations, s.defaultStation)
+
+	for _, conf := range s.config.Stations {
+		st, err := s.newStation(conf, state.Stations[conf.Name])
+		if err != nil {
+			return err
+		}
+		log.Printf("Started station '%s'", st.name)
+		s.stations = append(s.stations, st)
+	}
+
+	return nil
+}
+
+// stationRoutes registers all station-specific handlers under the given prefix
+func (s *Server) stationRoutes(st *station, prefix string) {
+	handle := func(pattern string, h http.Handler) {
+		if st != s.defaultStation {
+			h = withStation(st, h)
+		}
+		s.mux.Handle(prefix+pattern, h)
+	}
+
+	handle("stream.mp3", st.metrics.metered("mp3", true, s.HandlerFunc(web.MP3StreamHandler, "")))
+	handle("stream.m3u8", s.HandlerFunc(web.HLSPlaylistHandler, ""))
+	handle("hls/", st.metrics.metered("hls", false, s.HandlerFunc(web.HLSSegmentHandler, "")))
+	handle("stream.wav", st.metrics.metered("wav", true, s.HandlerFunc(web.WAVStreamHandler, "")))
+	if st.flac != nil {
+		handle("stream.oga", st.metrics.metered("flac", true, s.HandlerFunc(web.FLACStreamHandler, "")))
+	} else {
+		handle("stream.oga", s.HandlerFunc(web.FLACStreamHandler, ""))
+	}
+	if st.opus != nil {
+		handle("stream.opus", st.metrics.metered("opus", true, s.HandlerFunc(web.OpusStreamHandler, "")))
+	} else {
+		handle("stream.opus", s.HandlerFunc(web.OpusStreamHandler, ""))
+	}
+	handle("now-playing", s.HandlerFunc(web.NowPlayingHandler, "fragment/nowPlaying"))
+	handle("api/queue/add", s.HandlerFunc(web.AddQueueHandler, ""))
+	handle("api/queue/fill", s.HandlerFunc(web.FillQueueHandler, ""))
+}
+
+// withStation binds a handler to a specific station
+func withStation(st *station, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), stationContextKey{}, st)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// stationFor returns the station a request is bound to
+func (s *Server) stationFor(r *http.Request) *station {
+	if r != nil {
+		if st, ok := r.Context().Value(stationContextKey{}).(*station); ok {
+			return st
+		}
+	}
+	return s.defaultStation
+}
+
+func (st *station) buffers() web.StationBuffers {
+	var rv web.StationBuffers
+	if sts, ok := st.chunker.(chunker.Statuser); ok {
+		rv.MP3Stream = sts
+	}
+	if sts, ok := st.scheduler.AudioStream.(chunker.Statuser); ok {
+		rv.Scheduler = sts
+	}
+	return rv
+}
+
+// nowPlaying returns the performance currently audible on the MP3 stream,
+// falling back on the scheduler's output if the encoder hasn't caught up yet
+func (st *station) nowPlaying() speeldoos.Performance {
+	for _, ch := range []chunker.Chunker{st.chunker, st.scheduler.AudioStream} {
+		if ad, err := ch.GetAssociatedData(); err == nil {
+			if pf, ok := ad.(speeldoos.Performance); ok {
+				return pf
+			}
+		}
+	}
+	return speeldoos.Performance{}
+}
@@ -0,0 +1,48 @@
+package plumbing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/thijzert/speeldoos/lib/users"
+	"github.com/thijzert/speeldoos/pkg/web"
+)
+
+// authenticate finds the user making a request. Browsers use a session
+// cookie; scripts and audio players can use an API token, either as a Bearer
+// token, as the password in Basic authentication or in the 'token' query
+// parameter. It also returns the session ID, if any.
+func (s *Server) authenticate(r *http.Request) (*users.User, string) {
+	store := s.config.Users
+	if store == nil {
+		return nil, ""
+	}
+
+	if c, err := r.Cookie(web.SessionCookie); err == nil {
+		if u, err := store.Session(c.Value); err == nil {
+			return &u, c.Value
+		}
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		if u, err := store.AuthenticateToken(strings.TrimSpace(auth[7:])); err == nil {
+			return &u, ""
+		}
+	}
+
+	if _, password, ok := r.BasicAuth(); ok {
+		// Only tokens are accepted here, not passwords. Browsers remember Basic
+		// credentials, and send them along with requests made by other sites.
+		if u, err := store.AuthenticateToken(password); err == nil {
+			return &u, ""
+		}
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		if u, err := store.AuthenticateToken(token); err == nil {
+			return &u, ""
+		}
+	}
+
+	return nil, ""
+}
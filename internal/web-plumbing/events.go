@@ -0,0 +1,116 @@
+package plumbing
+
+import (
+	"sync"
+
+	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+	"github.com/thijzert/speeldoos/pkg/web"
+)
+
+// eventBufferSize is the number of events a subscriber may lag behind before
+// further events are dropped
+const eventBufferSize = 32
+
+// An eventHub distributes server events to all subscribers
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan web.Event]struct{}
+	closed      bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan web.Event]struct{}),
+	}
+}
+
+// Subscribe implements web.EventSource
+func (h *eventHub) Subscribe() (<-chan web.Event, func()) {
+	ch := make(chan web.Event, eventBufferSize)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends all subscriptions
+func (h *eventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends an event to all subscribers. Subscribers that can't keep up
+// miss out on the event, rather than holding up everyone else.
+func (h *eventHub) Publish(ev web.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// publishQueue publishes the current play queue of a station
+func (s *Server) publishQueue(st *station) {
+	st.scheduler.QueueMutex.RLock()
+	queue := append([]speeldoos.PerformanceID{}, st.scheduler.PlayQueue...)
+	st.scheduler.QueueMutex.RUnlock()
+
+	s.events.Publish(web.NewQueueEvent(st.name, s.config.Library, queue))
+}
+
+// watchNowPlaying follows a station's MP3 stream at the live edge, and
+// publishes a track change the moment it becomes audible
+func (s *Server) watchNowPlaying(st *station) {
+	stream, err := st.chunker.NewStream()
+	if err != nil {
+		return
+	}
+	ads, ok := stream.(chunker.AssociatedDataStream)
+	if !ok {
+		return
+	}
+
+	var current speeldoos.PerformanceID
+	buf := make([]byte, 32*1024)
+	for {
+		_, err := ads.Read(buf)
+
+		if pf, ok := ads.AssociatedData().(speeldoos.Performance); ok && pf.ID != current {
+			current = pf.ID
+			s.events.Publish(web.NewNowPlayingEvent(st.name, pf))
+
+			// The scheduler may have taken the new track off the queue
+			s.publishQueue(st)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
 
@@ -36,6 +37,17 @@ func init() {
 }
 
 func (h htmlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := h.Server.getState(r)
+	err := web.Authorize(h.Handler, state)
+	if err != nil {
+		if state.User == nil {
+			h.Server.redirect(w, r, h.appRoot(r)+"login?continue="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		} else {
+			h.Error(w, r, err)
+		}
+		return
+	}
+
 	req, err := h.Handler.DecodeRequest(r)
 	if err != nil {
 		h.Error(w, r, err)
@@ -48,19 +60,24 @@ func (h htmlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	state := h.Server.getState()
 	newState, resp, err := h.Handler.HandleRequest(state, req)
 	if err != nil {
 		h.Error(w, r, err)
 		return
 	}
 
-	err = h.Server.setState(newState)
+	err = h.Server.setState(r, newState)
 	if err != nil {
 		h.Error(w, r, err)
 		return
 	}
 
+	// Alternative path: this response can write its own headers and response body
+	if h, ok := resp.(http.Handler); ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
 	w.Header()["Content-Type"] = []string{"text/html; charset=UTF-8"}
 
 	csp := ""
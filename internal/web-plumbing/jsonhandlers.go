@@ -3,10 +3,12 @@ package plumbing
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
 	"github.com/thijzert/speeldoos/pkg/web"
 )
 
@@ -24,20 +26,31 @@ func (s *Server) JSONFunc(handler web.Handler) http.Handler {
 }
 
 func (h jsonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := h.Server.getState(r)
+	err := web.Authorize(h.Handler, state)
+	if err != nil {
+		if state.User == nil {
+			// Give audio players and scripts a chance to log in
+			w.Header().Set("WWW-Authenticate", `Basic realm="speeldoos"`)
+			err = weberrors.WithStatus(err, 401)
+		}
+		h.Error(w, r, err)
+		return
+	}
+
 	req, err := h.Handler.DecodeRequest(r)
 	if err != nil {
 		h.Error(w, r, err)
 		return
 	}
 
-	state := h.Server.getState()
 	newState, resp, err := h.Handler.HandleRequest(state, req)
 	if err != nil {
 		h.Error(w, r, err)
 		return
 	}
 
-	err = h.Server.setState(newState)
+	err = h.Server.setState(r, newState)
 	if err != nil {
 		h.Error(w, r, err)
 		return
@@ -64,26 +77,34 @@ func (h jsonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (jsonHandler) Error(w http.ResponseWriter, r *http.Request, err error) {
+	st, _ := weberrors.HTTPStatusCode(err)
+	if st == 0 {
+		st = 500
+	}
+
+	message := err.Error()
+	var uerr weberrors.UserError
+	if errors.As(err, &uerr) {
+		message = uerr.Message()
+	}
 
 	w.Header()["Content-Type"] = []string{"application/json"}
 	w.Header()["X-Content-Type-Options"] = []string{"nosniff"}
+	w.WriteHeader(st)
 
-	// TODO: we may need to set a different status entirely
-
-	w.WriteHeader(500)
 	errorResponse := struct {
-		errorCode    int
-		errorMessage string
+		ErrorCode    int    `json:"errorCode"`
+		ErrorMessage string `json:"errorMessage"`
 	}{
-		500, // TODO: error codes
-		err.Error(),
+		st,
+		message,
 	}
 
 	var b bytes.Buffer
 	e := json.NewEncoder(&b)
 	err = e.Encode(errorResponse)
 	if err != nil {
-		fmt.Fprintf(w, "{errorCode: 500, errorMessage: \"I give up.\"}")
+		fmt.Fprintf(w, "{\"errorCode\": 500, \"errorMessage\": \"I give up.\"}")
 	} else {
 		io.Copy(w, &b)
 	}
@@ -0,0 +1,235 @@
+package plumbing
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thijzert/speeldoos/lib/users"
+	"github.com/thijzert/speeldoos/lib/wavreader"
+	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
+)
+
+// streamStats counts the listeners and traffic of one audio stream
+type streamStats struct {
+	listeners int64
+	bytes     int64
+}
+
+// streamMetrics keeps the stream statistics of a station, by stream name
+type streamMetrics struct {
+	mu      sync.Mutex
+	streams map[string]*streamStats
+}
+
+func (m *streamMetrics) get(stream string) *streamStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.streams == nil {
+		m.streams = make(map[string]*streamStats)
+	}
+	rv, ok := m.streams[stream]
+	if !ok {
+		rv = &streamStats{}
+		m.streams[stream] = rv
+	}
+	return rv
+}
+
+func (m *streamMetrics) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rv := make([]string, 0, len(m.streams))
+	for name := range m.streams {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// metered counts the bytes a handler sends for a stream. If listening is
+// set, every request in progress also counts as a connected listener.
+func (m *streamMetrics) metered(stream string, listening bool, h http.Handler) http.Handler {
+	stats := m.get(stream)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if listening {
+			atomic.AddInt64(&stats.listeners, 1)
+			defer atomic.AddInt64(&stats.listeners, -1)
+		}
+
+		h.ServeHTTP(&meteredWriter{ResponseWriter: w, bytes: &stats.bytes}, r)
+	})
+}
+
+// A meteredWriter adds the size of everything written to a counter
+type meteredWriter struct {
+	http.ResponseWriter
+	bytes *int64
+}
+
+func (w *meteredWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddInt64(w.bytes, int64(n))
+	return n, err
+}
+
+// Flush implements http.Flusher, so streaming responses keep working
+func (w *meteredWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// serveMetrics exposes the server's vital signs in the Prometheus text format
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.config.Users != nil {
+		if u, _ := s.authenticate(r); !u.Can(users.RoleListener) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="speeldoos"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+func (s *Server) writeMetrics(out io.Writer) {
+	m := metricsWriter{w: out}
+
+	m.help("speeldoos_stream_listeners", "gauge", "Number of connected listeners per audio stream")
+	for _, st := range s.stations {
+		for _, name := range st.metrics.names() {
+			m.sample("speeldoos_stream_listeners", atomic.LoadInt64(&st.metrics.get(name).listeners), "station", st.name, "stream", name)
+		}
+	}
+
+	m.help("speeldoos_stream_sent_bytes_total", "counter", "Number of bytes served per audio stream")
+	for _, st := range s.stations {
+		for _, name := range st.metrics.names() {
+			m.sample("speeldoos_stream_sent_bytes_total", atomic.LoadInt64(&st.metrics.get(name).bytes), "station", st.name, "stream", name)
+		}
+	}
+
+	type buffer struct {
+		station, name string
+		status        chunker.BufferStatus
+	}
+	var buffers []buffer
+	for _, st := range s.stations {
+		for _, b := range []struct {
+			name string
+			ch   chunker.Chunker
+		}{{"scheduler", st.scheduler.AudioStream}, {"mp3", st.chunker}, {"flac", st.flac}, {"opus", st.opus}} {
+			if sts, ok := b.ch.(chunker.Statuser); ok {
+				buffers = append(buffers, buffer{st.name, b.name, sts.BufferStatus()})
+			}
+		}
+	}
+
+	m.help("speeldoos_buffer_ahead_seconds", "gauge", "Length of the audio in a buffer that isn't available for reading yet. For the 'scheduler' buffer, this is the read-ahead of the decoded audio.")
+	for _, b := range buffers {
+		ahead := float64(b.status.Tahead) / 1000
+		if b.status.Tmax.IsZero() {
+			ahead = 0
+		}
+		m.sample("speeldoos_buffer_ahead_seconds", ahead, "station", b.station, "buffer", b.name)
+	}
+
+	m.help("speeldoos_buffer_behind_seconds", "gauge", "Length of the audio in a buffer that's available for reading")
+	for _, b := range buffers {
+		behind := float64(b.status.Tbehind) / 1000
+		if b.status.Tmin.IsZero() {
+			behind = 0
+		}
+		m.sample("speeldoos_buffer_behind_seconds", behind, "station", b.station, "buffer", b.name)
+	}
+
+	m.help("speeldoos_scheduler_decode_errors_total", "counter", "Number of performances the scheduler failed to decode")
+	for _, st := range s.stations {
+		m.sample("speeldoos_scheduler_decode_errors_total", st.scheduler.DecodeErrors(), "station", st.name)
+	}
+
+	procs := wavreader.ProcessStats()
+	m.help("speeldoos_process_starts_total", "counter", "Number of times an encoder, decoder or player process was started. Encoders are started once per stream; any more starts are restarts.")
+	for _, p := range procs {
+		m.sample("speeldoos_process_starts_total", p.Starts, "program", p.Program)
+	}
+	m.help("speeldoos_process_failures_total", "counter", "Number of encoder, decoder or player processes that exited with an error")
+	for _, p := range procs {
+		m.sample("speeldoos_process_failures_total", p.Failures, "program", p.Program)
+	}
+
+	carriers, parseErrors := 0, 0
+	for _, pc := range s.config.Library.ParsedCarriers() {
+		if pc.Error != nil {
+			parseErrors++
+		} else {
+			carriers++
+		}
+	}
+	m.help("speeldoos_library_carriers", "gauge", "Number of carriers in the library")
+	m.sample("speeldoos_library_carriers", carriers)
+	m.help("speeldoos_library_parse_errors", "gauge", "Number of carrier files in the library that couldn't be parsed")
+	m.sample("speeldoos_library_parse_errors", parseErrors)
+}
+
+// A metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	w io.Writer
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func (m metricsWriter) help(name, kind, help string) {
+	help = helpEscaper.Replace(help)
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value, with any labels given as name/value pairs
+func (m metricsWriter) sample(name string, value interface{}, labels ...string) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 0 {
+		sb.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(labels[i])
+			sb.WriteString(`="`)
+			sb.WriteString(labelEscaper.Replace(labels[i+1]))
+			sb.WriteString(`"`)
+		}
+		sb.WriteString("}")
+	}
+
+	sb.WriteString(" ")
+	switch v := value.(type) {
+	case int:
+		sb.WriteString(strconv.Itoa(v))
+	case int64:
+		sb.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			sb.WriteString("NaN")
+		} else {
+			sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	sb.WriteString("\n")
+
+	io.WriteString(m.w, sb.String())
+}
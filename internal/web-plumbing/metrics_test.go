@@ -0,0 +1,49 @@
+package plumbing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMetricsWriter(t *testing.T) {
+	var b bytes.Buffer
+	m := metricsWriter{w: &b}
+
+	m.help("test_total", "counter", "A test\nmetric")
+	m.sample("test_total", int64(42), "station", `"quoted"\`, "stream", "mp3")
+	m.sample("test_seconds", 1.5)
+
+	expected := "# HELP test_total A test\\nmetric\n" +
+		"# TYPE test_total counter\n" +
+		`test_total{station="\"quoted\"\\",stream="mp3"} 42` + "\n" +
+		"test_seconds 1.5\n"
+	if b.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestMetered(t *testing.T) {
+	var m streamMetrics
+	var during int64
+
+	h := m.metered("mp3", true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = atomic.LoadInt64(&m.get("mp3").listeners)
+		io.WriteString(w, "hello, world")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream.mp3", nil))
+
+	stats := m.get("mp3")
+	if during != 1 {
+		t.Errorf("%d listeners during the request; expected 1", during)
+	}
+	if stats.listeners != 0 {
+		t.Errorf("%d listeners after the request; expected 0", stats.listeners)
+	}
+	if stats.bytes != 12 {
+		t.Errorf("counted %d bytes; expected 12", stats.bytes)
+	}
+}
@@ -0,0 +1,329 @@
+package plumbing
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Middleware wraps a HTTP handler to add behaviour to every request
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps a handler in a list of middleware. The first middleware in the
+// list is the outermost one.
+func chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// middleware assembles the middleware chain from the server configuration
+func (s *Server) middleware() []Middleware {
+	var rv []Middleware
+
+	if s.config.AccessLog != nil {
+		rv = append(rv, AccessLog(s.config.AccessLog))
+	}
+	rv = append(rv, s.recoverPanics, SameOrigin("/api/", s.config.CORSOrigins))
+	if len(s.config.CORSOrigins) > 0 {
+		rv = append(rv, CORS("/api/", s.config.CORSOrigins))
+	}
+	if s.config.Gzip {
+		rv = append(rv, Gzip)
+	}
+
+	return append(rv, s.config.Middleware...)
+}
+
+// A responseRecorder keeps track of the status code and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, so streaming responses keep working
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// AccessLog writes a line for every request to out, including the response
+// status, its size and the time it took.
+func AccessLog(out io.Writer) Middleware {
+	logger := log.New(out, "", log.LstdFlags)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			defer func() {
+				status := rec.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				logger.Printf("%s %s %s %d %d %s", r.RemoteAddr, r.Method, loggedURI(r.URL), status, rec.written, time.Since(start).Round(time.Microsecond))
+			}()
+
+			h.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// loggedURI returns the request URI for the access log, leaving out the API
+// token if it was passed as a query parameter
+func loggedURI(u *url.URL) string {
+	q := u.Query()
+	if _, ok := q["token"]; !ok {
+		return u.RequestURI()
+	}
+	q.Set("token", "REDACTED")
+
+	rv := *u
+	rv.RawQuery = q.Encode()
+	return rv.RequestURI()
+}
+
+// recoverPanics turns a panic in any handler into an error page, rather than
+// a dropped connection
+func (s *Server) recoverPanics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			log.Printf("panic serving %s: %v\n%s", r.URL.Path, p, debug.Stack())
+
+			// It's too late for an error page if the response has already started
+			if rec.status != 0 {
+				return
+			}
+
+			err := fmt.Errorf("internal server error")
+			if wantsJSON(r) {
+				jsonHandler{Server: s}.Error(w, r, err)
+			} else {
+				htmlHandler{Server: s}.Error(w, r, err)
+			}
+		}()
+
+		h.ServeHTTP(rec, r)
+	})
+}
+
+// CORS allows cross-origin requests to any path under prefix from the
+// specified origins. Use "*" to allow any origin.
+func CORS(prefix string, origins []string) Middleware {
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		allowed[strings.TrimRight(o, "/")] = true
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !strings.HasPrefix(r.URL.Path, prefix) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if !allowed["*"] && !allowed[origin] {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+			// Answer preflight requests directly
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				if rh := r.Header.Get("Access-Control-Request-Headers"); rh != "" {
+					w.Header().Set("Access-Control-Allow-Headers", rh)
+				}
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(600))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SameOrigin refuses requests that change something, if a browser says they
+// were made from another site. Only the origins that are allowed to use the API
+// through CORS may post to URLs starting with prefix. Requests that don't
+// mention an origin at all come from scripts rather than browsers, and are let
+// through.
+func SameOrigin(prefix string, origins []string) Middleware {
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		allowed[strings.TrimRight(o, "/")] = true
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				if ref, err := url.Parse(r.Referer()); err == nil && ref.Host != "" {
+					origin = ref.Scheme + "://" + ref.Host
+				}
+			}
+			if origin == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, prefix) && (allowed["*"] || allowed[origin]) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		})
+	}
+}
+
+// compressibleTypes lists the content types that are worth compressing. Audio
+// is already compressed, and breaks Range requests besides.
+var compressibleTypes = map[string]bool{
+	"text/html":              true,
+	"text/css":               true,
+	"text/plain":             true,
+	"text/xml":               true,
+	"application/json":       true,
+	"application/javascript": true,
+	"image/svg+xml":          true,
+}
+
+// Gzip compresses HTML, JSON and other text responses for clients that accept it
+func Gzip(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.Close()
+
+		h.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, p := range params[1:] {
+			if strings.Replace(p, " ", "", -1) == "q=0" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// A gzipWriter decides whether to compress a response once its headers are
+// written, based on its content type
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	hdr := w.Header()
+	mt, _, _ := mime.ParseMediaType(hdr.Get("Content-Type"))
+	if compressibleTypes[mt] && hdr.Get("Content-Encoding") == "" && hdr.Get("Content-Range") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+		hdr.Set("Content-Encoding", "gzip")
+		hdr.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, so streaming responses keep working
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
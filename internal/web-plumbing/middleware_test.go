@@ -0,0 +1,150 @@
+package plumbing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	h := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/audio" {
+			w.Header().Set("Content-Type", "audio/mpeg")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		io.WriteString(w, `{"hello": "world"}`)
+	}))
+
+	r := httptest.NewRequest("GET", "/json", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("JSON response was not compressed")
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(gz)
+	if string(b) != `{"hello": "world"}` {
+		t.Errorf("unexpected response body %q", b)
+	}
+
+	r = httptest.NewRequest("GET", "/audio", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("audio response was compressed")
+	}
+
+	r = httptest.NewRequest("GET", "/json", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("response was compressed even though the client doesn't accept it")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS("/api/", []string{"https://example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+
+	r := httptest.NewRequest("OPTIONS", "/api/v1/carriers", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("unexpected preflight response: %d, origin '%s'", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	r = httptest.NewRequest("GET", "/api/v1/carriers", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin got CORS headers")
+	}
+
+	r = httptest.NewRequest("GET", "/library", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("non-API path got CORS headers")
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	s := &Server{}
+	h := s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 500 {
+		t.Errorf("expected status 500; got %d", w.Code)
+	}
+}
+
+func TestAccessLogRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	h := AccessLog(&buf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hls/stream/3.ts?token=s3cret&q=1", nil))
+	if strings.Contains(buf.String(), "s3cret") {
+		t.Errorf("the token was logged: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "/hls/stream/3.ts?") || !strings.Contains(buf.String(), "q=1") {
+		t.Errorf("the request was not logged: %s", buf.String())
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	h := SameOrigin("/api/", []string{"https://example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+
+	tests := []struct {
+		Method, Path, Origin, Referer string
+		Status                        int
+	}{
+		{"GET", "/inbox/", "https://evil.example", "", 200},
+		{"POST", "/edit/carrier/ABC-1", "", "", 200},
+		{"POST", "/edit/carrier/ABC-1", "http://example.org", "", 200},
+		{"POST", "/edit/carrier/ABC-1", "", "http://example.org/edit/carrier/ABC-1", 200},
+		{"POST", "/edit/carrier/ABC-1", "https://evil.example", "", 403},
+		{"POST", "/edit/carrier/ABC-1", "", "https://evil.example/form.html", 403},
+		{"POST", "/edit/carrier/ABC-1", "null", "", 403},
+		{"POST", "/api/library/refresh", "https://evil.example", "", 403},
+		{"POST", "/api/library/refresh", "https://example.com", "", 200},
+		{"POST", "/edit/carrier/ABC-1", "https://example.com", "", 403},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest(tc.Method, "http://example.org"+tc.Path, nil)
+		if tc.Origin != "" {
+			r.Header.Set("Origin", tc.Origin)
+		}
+		if tc.Referer != "" {
+			r.Header.Set("Referer", tc.Referer)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.Status {
+			t.Errorf("%s %s from '%s%s': got status %d, expected %d", tc.Method, tc.Path, tc.Origin, tc.Referer, w.Code, tc.Status)
+		}
+	}
+}
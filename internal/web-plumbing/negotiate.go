@@ -0,0 +1,106 @@
+package plumbing
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/thijzert/speeldoos/pkg/web"
+)
+
+type negotiatingHandler struct {
+	HTML *htmlHandler
+	JSON jsonHandler
+}
+
+// HandlerFunc creates a HTTP handler that outputs either HTML or JSON,
+// depending on the request's Accept header or its 'format' parameter. If
+// templateName is empty, the handler always outputs JSON.
+func (s *Server) HandlerFunc(handler web.Handler, templateName string) http.Handler {
+	rv := negotiatingHandler{
+		JSON: jsonHandler{
+			Server:  s,
+			Handler: handler,
+		},
+	}
+	if templateName != "" {
+		rv.HTML = &htmlHandler{
+			Server:       s,
+			TemplateName: templateName,
+			Handler:      handler,
+		}
+	}
+	return rv
+}
+
+func (h negotiatingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.HTML == nil {
+		h.JSON.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+
+	if wantsJSON(r) {
+		h.JSON.ServeHTTP(w, r)
+	} else {
+		h.HTML.ServeHTTP(w, r)
+	}
+}
+
+// wantsJSON decides whether a request prefers JSON over HTML. An explicit
+// 'format' parameter takes precedence over the Accept header; if neither
+// expresses a preference, HTML wins.
+func wantsJSON(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "json":
+		return true
+	case "html":
+		return false
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	return acceptQuality(accept, "application/json") > acceptQuality(accept, "text/html")
+}
+
+// acceptQuality returns the quality value an Accept header assigns to a media
+// type. The most specific matching media range determines the result.
+func acceptQuality(accept, mediaType string) float64 {
+	major := mediaType[:strings.IndexByte(mediaType, '/')]
+
+	rv, specificity := 0.0, -1
+	for _, rng := range strings.Split(accept, ",") {
+		params := strings.Split(rng, ";")
+		mt := strings.ToLower(strings.TrimSpace(params[0]))
+
+		spec := -1
+		if mt == mediaType {
+			spec = 2
+		} else if mt == major+"/*" {
+			spec = 1
+		} else if mt == "*/*" {
+			spec = 0
+		}
+		if spec <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if len(p) > 2 && (p[:2] == "q=" || p[:2] == "Q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		rv, specificity = q, spec
+	}
+
+	return rv
+}
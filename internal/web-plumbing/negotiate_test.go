@@ -0,0 +1,34 @@
+package plumbing
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		URL    string
+		Accept string
+		JSON   bool
+	}{
+		{"/", "", false},
+		{"/", "*/*", false},
+		{"/", "application/json", true},
+		{"/", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"/", "application/json, text/html;q=0.5", true},
+		{"/", "text/*;q=0.3, application/*", true},
+		{"/", "application/json;q=0, */*", false},
+		{"/?format=json", "text/html", true},
+		{"/?format=html", "application/json", false},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", tc.URL, nil)
+		if tc.Accept != "" {
+			r.Header.Set("Accept", tc.Accept)
+		}
+		if got := wantsJSON(r); got != tc.JSON {
+			t.Errorf("%s with Accept '%s': got JSON=%v, expected %v", tc.URL, tc.Accept, got, tc.JSON)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package plumbing
 import (
 	"context"
 	"html/template"
+	"io"
 	"net/http"
+	"sync"
 
+	"github.com/thijzert/speeldoos/lib/transcodecache"
+	"github.com/thijzert/speeldoos/lib/users"
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
 	"github.com/thijzert/speeldoos/pkg/web"
@@ -12,95 +16,235 @@ import (
 
 // A ServerConfig combines common options for running a HTTP frontend
 type ServerConfig struct {
+	// The stations stop once this context is done; use Shutdown to stop
+	// them gracefully instead.
 	Context      context.Context
 	Library      *speeldoos.Library
 	StreamConfig chunker.MP3ChunkConfig
+
+	// Encoder settings for the optional Ogg-FLAC and Opus streams; nil to disable them
+	FLACConfig *chunker.OggFLACChunkConfig
+	OpusConfig *chunker.OpusChunkConfig
+
+	// The cache for transcoded performances; nil to disable
+	TranscodeCache *transcodecache.Cache
+
+	// Any additional named stations
+	Stations []StationConfig
+
+	// If set, a line is written here for every request
+	AccessLog io.Writer
+
+	// Compress HTML and JSON responses for clients that support it
+	Gzip bool
+
+	// User accounts; nil to disable authentication
+	Users *users.Store
+
+	// If set, the play queue and history of every station are saved here on
+	// shutdown, and restored on startup
+	StateFile string
+
+	// Origins that may use the API from other sites ("*" allows any origin)
+	CORSOrigins []string
+
+	// Any additional middleware, outermost first. These run after the
+	// built-in middleware above.
+	Middleware []Middleware
 }
 
 // A Server wraps a HTTP frontend
 type Server struct {
 	context         context.Context
+	cancel          context.CancelFunc
 	config          ServerConfig
 	mux             *http.ServeMux
-	scheduler       *speeldoos.Scheduler
-	chunker         chunker.Chunker
+	handler         http.Handler
+	defaultStation  *station
+	stations        []*station
 	parsedTemplates map[string]*template.Template
 	nowPlaying      speeldoos.Performance
+	events          *eventHub
+
+	// Any child processes are killed once this context is done
+	processes     context.Context
+	killProcesses context.CancelFunc
+
+	// Tracks the goroutines feeding the encoders
+	encoders sync.WaitGroup
+
+	shutdownOnce sync.Once
+	shutdownErr  error
 }
 
 // New instantiates a new server instance
 func New(config ServerConfig) (*Server, error) {
+	if config.Context == nil {
+		config.Context = context.Background()
+	}
+
 	s := &Server{
-		context: config.Context,
-		config:  config,
-		mux:     http.NewServeMux(),
+		config: config,
+		mux:    http.NewServeMux(),
+		events: newEventHub(),
 	}
+	s.context, s.cancel = context.WithCancel(config.Context)
+	s.processes, s.killProcesses = context.WithCancel(context.Background())
 
-	err := s.initAudioStream()
+	config.Library.OnRefresh = func() {
+		s.events.Publish(web.Event{Type: web.EventLibrary})
+	}
+
+	state, err := s.loadState()
 	if err != nil {
 		return nil, err
 	}
 
-	s.mux.Handle("/", s.HTMLFunc(web.HomeHandler, "full/home"))
-	s.mux.Handle("/status", s.HTMLFunc(web.StatusHandler, "full/status"))
-	s.mux.Handle("/library", s.HTMLFunc(web.LibraryHandler, "full/library"))
-
-	s.mux.Handle("/debug/carrier/", s.JSONFunc(web.DebugCarrierHandler))
-
-	s.mux.Handle("/api/status/buffers", s.JSONFunc(web.BufferStatusHandler))
-	s.mux.Handle("/api/search", s.HTMLFunc(web.SearchResultHandler, "fragment/searchResult"))
-	s.mux.Handle("/api/queue/add", s.JSONFunc(web.AddQueueHandler))
+	err = s.initAudioStream(state)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
 
-	s.mux.Handle("/stream.mp3", s.JSONFunc(web.MP3StreamHandler))
-	s.mux.Handle("/stream.wav", s.JSONFunc(web.WAVStreamHandler))
-	s.mux.Handle("/now-playing", s.HTMLFunc(web.NowPlayingHandler, "fragment/nowPlaying"))
+	s.mux.Handle("/", s.HandlerFunc(web.HomeHandler, "full/home"))
+	s.mux.Handle("/login", s.HandlerFunc(web.LoginHandler, "full/login"))
+	s.mux.Handle("/logout", s.HandlerFunc(web.LogoutHandler, ""))
+	s.mux.Handle("/status", s.HandlerFunc(web.StatusHandler, "full/status"))
+	s.mux.Handle("/library", s.HandlerFunc(web.LibraryHandler, "full/library"))
+
+	s.mux.Handle("/debug/carrier/", s.HandlerFunc(web.DebugCarrierHandler, ""))
+	s.mux.Handle("/edit/carrier/", s.HandlerFunc(web.EditCarrierHandler, "full/editCarrier"))
+	s.mux.Handle("/inbox", s.HandlerFunc(web.InboxHandler, "full/inbox"))
+	s.mux.Handle("/inbox/", s.HandlerFunc(web.InboxItemHandler, "full/inboxItem"))
+	s.mux.Handle("/performance/", s.HandlerFunc(web.PerformanceAudioHandler, ""))
+	s.mux.Handle("/carrier/", s.HandlerFunc(web.CarrierAttachmentHandler, ""))
+
+	s.mux.Handle("/api/status/buffers", s.HandlerFunc(web.BufferStatusHandler, ""))
+	s.mux.Handle("/api/events", s.HandlerFunc(web.EventsHandler, ""))
+	s.mux.Handle("/api/library/refresh", s.HandlerFunc(web.RefreshLibraryHandler, ""))
+	s.mux.Handle("/api/v1/carriers", s.HandlerFunc(web.APICarriersHandler, ""))
+	s.mux.Handle("/api/v1/carriers/", s.HandlerFunc(web.APICarriersHandler, ""))
+	s.mux.Handle("/api/v1/performances", s.HandlerFunc(web.APIPerformancesHandler, ""))
+	s.mux.Handle("/api/v1/performances/", s.HandlerFunc(web.APIPerformancesHandler, ""))
+	s.mux.Handle("/api/v1/composers", s.HandlerFunc(web.APIComposersHandler, ""))
+	s.mux.Handle("/api/v1/search", s.HandlerFunc(web.APISearchHandler, ""))
+	s.mux.Handle("/api/search", s.HandlerFunc(web.SearchResultHandler, "fragment/searchResult"))
+
+	for _, st := range s.stations {
+		if st == s.defaultStation {
+			s.stationRoutes(st, "/")
+		} else {
+			s.stationRoutes(st, "/stations/"+st.name+"/")
+		}
+	}
 
 	s.mux.HandleFunc("/assets/", s.serveStaticAsset)
+	s.mux.HandleFunc("/metrics", s.serveMetrics)
+
+	s.handler = chain(s.mux, s.middleware()...)
 
 	return s, nil
 }
 
-// Close frees any held resources
+// Shutdown stops all stations. The encoders get to finish the audio that's
+// already been scheduled, so connected listeners can drain their streams,
+// until ctx is done. After that, any remaining child processes are killed, and
+// the play queues are saved to the state file.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	s.cancel()
+	s.events.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.encoders.Wait()
+		close(done)
+	}()
+
+	var rv error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		rv = ctx.Err()
+		for _, st := range s.stations {
+			st.close()
+		}
+	}
+	s.killProcesses()
+
+	if err := s.saveState(); err != nil {
+		return err
+	}
+	return rv
+}
+
+// Close stops all stations immediately, and frees any held resources
 func (s *Server) Close() error {
-	// TODO: actually close some resources
-	return nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := s.Shutdown(ctx)
+	if err == context.Canceled {
+		err = nil
+	}
+	return err
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
-func (s *Server) getState() web.State {
+func (s *Server) getState(r *http.Request) web.State {
+	st := s.stationFor(r)
+
 	rv := web.State{
-		Library:   s.config.Library,
-		RawStream: s.scheduler.AudioStream,
-		MP3Stream: s.chunker,
-	}
-	if st, ok := s.chunker.(chunker.Statuser); ok {
-		rv.Buffers.MP3Stream = st
-	}
-	if st, ok := s.scheduler.AudioStream.(chunker.Statuser); ok {
-		rv.Buffers.Scheduler = st
+		Library:        s.config.Library,
+		TranscodeCache: s.config.TranscodeCache,
+		Events:         s.events,
+		Station:        st.name,
+		Scheduler:      st.scheduler,
+		RawStream:      st.scheduler.AudioStream,
+		MP3Stream:      st.chunker,
+		FLACStream:     st.flac,
+		OpusStream:     st.opus,
+		Buffers:        st.buffers(),
+		NowPlaying:     st.nowPlaying(),
+		Users:          s.config.Users,
 	}
-	if ad, err := s.scheduler.AudioStream.GetAssociatedData(); err == nil {
-		if pf, ok := ad.(speeldoos.Performance); ok {
-			rv.NowPlaying = pf
-		}
+
+	rv.User, rv.Session = s.authenticate(r)
+
+	for _, other := range s.stations {
+		rv.Stations = append(rv.Stations, web.StationState{
+			Name:       other.name,
+			NowPlaying: other.nowPlaying(),
+			Buffers:    other.buffers(),
+		})
 	}
 
-	s.scheduler.QueueMutex.RLock()
-	rv.PlayQueue = append(rv.PlayQueue, s.scheduler.PlayQueue...)
-	s.scheduler.QueueMutex.RUnlock()
+	st.scheduler.QueueMutex.RLock()
+	rv.PlayQueue = append(rv.PlayQueue, st.scheduler.PlayQueue...)
+	st.scheduler.QueueMutex.RUnlock()
 
 	return rv
 }
 
 // setState writes back any modified fields to the global state
-func (s *Server) setState(state web.State) error {
+func (s *Server) setState(r *http.Request, state web.State) error {
+	st := s.stationFor(r)
+
 	if state.PlayQueueDirty {
-		s.scheduler.QueueMutex.Lock()
-		s.scheduler.PlayQueue = append(s.scheduler.PlayQueue[:0], state.PlayQueue...)
-		s.scheduler.QueueMutex.Unlock()
+		st.scheduler.QueueMutex.Lock()
+		st.scheduler.PlayQueue = append(st.scheduler.PlayQueue[:0], state.PlayQueue...)
+		st.scheduler.QueueMutex.Unlock()
+	}
+	if state.PlayQueueDirty || state.PlayQueueChanged {
+		s.publishQueue(st)
 	}
 
 	return nil
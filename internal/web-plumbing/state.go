@@ -0,0 +1,93 @@
+package plumbing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+var errShuttingDown = errors.New("the server is shutting down")
+
+// serverState is the part of the server state that survives a restart
+type serverState struct {
+	// The state of every station, by name. The default station has an empty name.
+	Stations map[string]stationState
+}
+
+type stationState struct {
+	PlayQueue []speeldoos.PerformanceID `json:",omitempty"`
+	History   []speeldoos.PerformanceID `json:",omitempty"`
+}
+
+// loadState reads the state file, if there is one
+func (s *Server) loadState() (serverState, error) {
+	var rv serverState
+	if s.config.StateFile == "" {
+		return rv, nil
+	}
+
+	b, err := os.ReadFile(s.config.StateFile)
+	if os.IsNotExist(err) {
+		return rv, nil
+	} else if err != nil {
+		return rv, err
+	}
+
+	err = json.Unmarshal(b, &rv)
+	if err != nil {
+		return rv, fmt.Errorf("%s: %v", s.config.StateFile, err)
+	}
+	return rv, nil
+}
+
+// saveState writes the play queue and history of every station to the state file
+func (s *Server) saveState() error {
+	if s.config.StateFile == "" {
+		return nil
+	}
+
+	state := serverState{
+		Stations: make(map[string]stationState),
+	}
+	for _, st := range s.stations {
+		st.scheduler.QueueMutex.RLock()
+		state.Stations[st.name] = stationState{
+			PlayQueue: append([]speeldoos.PerformanceID{}, st.scheduler.PlayQueue...),
+			History:   append([]speeldoos.PerformanceID{}, st.scheduler.History...),
+		}
+		st.scheduler.QueueMutex.RUnlock()
+	}
+
+	b, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.config.StateFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so a crash halfway doesn't wipe the previous state
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.StateFile), ".state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(b, '\n'))
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.config.StateFile)
+}
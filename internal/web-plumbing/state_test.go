@@ -0,0 +1,82 @@
+package plumbing
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	id := func(s string) speeldoos.PerformanceID {
+		rv, err := speeldoos.ParsePerformanceID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	s := &Server{
+		config: ServerConfig{
+			StateFile: filepath.Join(t.TempDir(), "speeldoos", "state.json"),
+		},
+		stations: []*station{
+			{
+				scheduler: &speeldoos.Scheduler{
+					PlayQueue: []speeldoos.PerformanceID{id("ABC-1-2"), id("ABC-1-1")},
+					History:   []speeldoos.PerformanceID{id("DEF-3-1")},
+				},
+			},
+			{
+				name:      "piano",
+				scheduler: &speeldoos.Scheduler{},
+			},
+		},
+	}
+
+	// Without a state file, the server starts out empty
+	state, err := s.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Stations) != 0 {
+		t.Errorf("loaded state from a file that doesn't exist: %v", state)
+	}
+
+	if err := s.saveState(); err != nil {
+		t.Fatal(err)
+	}
+	state, err = s.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := state.Stations[""]
+	if !reflect.DeepEqual(def.PlayQueue, s.stations[0].scheduler.PlayQueue) {
+		t.Errorf("play queue: got %v; expected %v", def.PlayQueue, s.stations[0].scheduler.PlayQueue)
+	}
+	if !reflect.DeepEqual(def.History, s.stations[0].scheduler.History) {
+		t.Errorf("history: got %v; expected %v", def.History, s.stations[0].scheduler.History)
+	}
+	if piano, ok := state.Stations["piano"]; !ok || len(piano.PlayQueue) != 0 || len(piano.History) != 0 {
+		t.Errorf("unexpected state for station 'piano': %v", piano)
+	}
+}
+
+func TestEventHubClose(t *testing.T) {
+	h := newEventHub()
+	ch, unsubscribe := h.Subscribe()
+
+	h.Close()
+	if _, ok := <-ch; ok {
+		t.Errorf("subscription is still open after closing")
+	}
+	unsubscribe()
+
+	// Subscribing after closing yields a closed channel right away
+	ch, _ = h.Subscribe()
+	if _, ok := <-ch; ok {
+		t.Errorf("subscribed to a closed hub")
+	}
+}
@@ -0,0 +1,86 @@
+package plumbing
+
+import (
+	"bytes"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertificateLoader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	err := GenerateSelfSigned(certFile, keyFile, []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := NewCertificateLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := certs.GetCertificate(nil)
+	if before == nil {
+		t.Fatalf("no certificate loaded")
+	}
+	leaf, err := x509.ParseCertificate(before.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 1 || len(leaf.IPAddresses) != 1 {
+		t.Errorf("unexpected names: %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	err = GenerateSelfSigned(certFile, keyFile, []string{"localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := certs.GetCertificate(nil)
+	if bytes.Equal(before.Certificate[0], after.Certificate[0]) {
+		t.Errorf("certificate was not reloaded")
+	}
+
+	// A broken certificate shouldn't replace the working one
+	if err := writePEM(certFile, "CERTIFICATE", []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Reload(); err == nil {
+		t.Errorf("reloading a broken certificate succeeded")
+	}
+	if c, _ := certs.GetCertificate(nil); c != after {
+		t.Errorf("broken certificate replaced the working one")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		Listen, Host, URL, Expected string
+	}{
+		{":443", "example.com", "/library?q=1", "https://example.com/library?q=1"},
+		{":8443", "example.com:8080", "/", "https://example.com:8443/"},
+		{"localhost:11884", "[::1]:80", "/stream.mp3", "https://[::1]:11884/stream.mp3"},
+		{"localhost:11884", "[::1]", "/stream.mp3", "https://[::1]:11884/stream.mp3"},
+		{":443", "[fe80::1]", "/", "https://[fe80::1]/"},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", tc.URL, nil)
+		r.Host = tc.Host
+		w := httptest.NewRecorder()
+		RedirectToHTTPS(tc.Listen).ServeHTTP(w, r)
+
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("%s: status %d", tc.URL, w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != tc.Expected {
+			t.Errorf("%s%s: redirected to '%s'; expected '%s'", tc.Host, tc.URL, loc, tc.Expected)
+		}
+	}
+}
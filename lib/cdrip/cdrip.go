@@ -0,0 +1,72 @@
+// Package cdrip reads the files a CD ripper leaves behind, such as cue sheets
+// and EAC or XLD log files, and computes the checksums those logs contain.
+package cdrip
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// FramesPerSecond is the number of CD frames (or sectors) in one second of audio
+const FramesPerSecond = 75
+
+// SamplesPerFrame is the number of samples in one CD frame
+const SamplesPerFrame = 588
+
+// Frames is a position or length on a CD, in frames
+type Frames int
+
+// ParseFrames parses a position in the 'mm:ss:ff' format used in cue sheets
+func ParseFrames(s string) (Frames, error) {
+	var m, sec, f int
+	n, err := fmt.Sscanf(s, "%d:%d:%d", &m, &sec, &f)
+	if err != nil || n != 3 || sec >= 60 || f >= FramesPerSecond {
+		return 0, fmt.Errorf("invalid position '%s'", s)
+	}
+	return Frames((m*60+sec)*FramesPerSecond + f), nil
+}
+
+// Duration returns the playing time of this many frames
+func (f Frames) Duration() time.Duration {
+	return time.Duration(f) * time.Second / FramesPerSecond
+}
+
+func (f Frames) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d", int(f)/FramesPerSecond/60, int(f)/FramesPerSecond%60, int(f)%FramesPerSecond)
+}
+
+// decodeText converts a text file to UTF-8. Rippers on Windows like to write
+// UTF-16 with a byte order mark, or some ANSI code page without one.
+func decodeText(b []byte) string {
+	if bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}) {
+		return string(b[3:])
+	}
+
+	if len(b) >= 2 && ((b[0] == 0xff && b[1] == 0xfe) || (b[0] == 0xfe && b[1] == 0xff)) {
+		le := b[0] == 0xff
+		b = b[2:]
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if le {
+				u[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+			} else {
+				u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+			}
+		}
+		return string(utf16.Decode(u))
+	}
+
+	if utf8.Valid(b) {
+		return string(b)
+	}
+
+	// Treat anything else as Latin-1
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
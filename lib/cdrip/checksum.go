@@ -0,0 +1,100 @@
+package cdrip
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// accurateRipSkip is the number of samples at the very start and end of a
+// disc that AccurateRip leaves out, as drives can't always read them
+const accurateRipSkip = 5 * SamplesPerFrame
+
+// A TrackChecksum computes the checksums that rippers log for a track. Write
+// the track's audio to it as 16-bit stereo PCM.
+type TrackChecksum struct {
+	samples     int64
+	first, last bool
+
+	pos              int64
+	crc, crcSkipZero uint32
+	v1, v2           uint32
+	partial          [4]byte
+	partialLen       int
+}
+
+// NewTrackChecksum starts computing the checksums of a track with the given
+// number of samples. The first and last tracks of a disc are treated
+// differently by AccurateRip.
+func NewTrackChecksum(samples int64, first, last bool) *TrackChecksum {
+	return &TrackChecksum{
+		samples: samples,
+		first:   first,
+		last:    last,
+	}
+}
+
+func (t *TrackChecksum) Write(b []byte) (int, error) {
+	n := len(b)
+	t.crc = crc32.Update(t.crc, crc32.IEEETable, b)
+
+	// Samples may be split across writes
+	if t.partialLen > 0 {
+		k := copy(t.partial[t.partialLen:], b)
+		t.partialLen += k
+		b = b[k:]
+		if t.partialLen < 4 {
+			return n, nil
+		}
+		t.addSample(t.partial[:])
+		t.partialLen = 0
+	}
+	for len(b) >= 4 {
+		t.addSample(b[:4])
+		b = b[4:]
+	}
+	t.partialLen = copy(t.partial[:], b)
+
+	return n, nil
+}
+
+func (t *TrackChecksum) addSample(b []byte) {
+	// EAC leaves out silence when computing its CRCs
+	for i := 0; i < 4; i += 2 {
+		if b[i] != 0 || b[i+1] != 0 {
+			t.crcSkipZero = crc32.Update(t.crcSkipZero, crc32.IEEETable, b[i:i+2])
+		}
+	}
+
+	t.pos++
+	if t.first && t.pos < accurateRipSkip {
+		return
+	}
+	if t.last && t.pos > t.samples-accurateRipSkip {
+		return
+	}
+
+	s := binary.LittleEndian.Uint32(b)
+	p := uint64(s) * uint64(t.pos)
+	t.v1 += uint32(p)
+	t.v2 += uint32(p) + uint32(p>>32)
+}
+
+// CRC32 returns the CRC32 of all audio
+func (t *TrackChecksum) CRC32() uint32 {
+	return t.crc
+}
+
+// CRC32SkipZero returns the CRC32 of all audio, leaving out zero samples
+func (t *TrackChecksum) CRC32SkipZero() uint32 {
+	return t.crcSkipZero
+}
+
+// AccurateRipV1 returns the AccurateRip v1 checksum
+func (t *TrackChecksum) AccurateRipV1() uint32 {
+	return t.v1
+}
+
+// AccurateRipV2 returns the AccurateRip v2 checksum
+func (t *TrackChecksum) AccurateRipV2() uint32 {
+	return t.v2
+}
@@ -0,0 +1,53 @@
+package cdrip
+
+import (
+	"hash/crc32"
+	"testing"
+)
+
+func TestTrackChecksum(t *testing.T) {
+	// Three stereo samples: 1, 2 and 0xffffffff
+	audio := []byte{1, 0, 0, 0, 2, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+
+	tc := NewTrackChecksum(3, false, false)
+	// Samples may be split across writes
+	tc.Write(audio[:5])
+	tc.Write(audio[5:7])
+	tc.Write(audio[7:])
+
+	if tc.CRC32() != crc32.ChecksumIEEE(audio) {
+		t.Errorf("CRC32 %08X", tc.CRC32())
+	}
+	if tc.CRC32SkipZero() != crc32.ChecksumIEEE([]byte{1, 0, 2, 0, 0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("CRC32 without zero samples %08X", tc.CRC32SkipZero())
+	}
+
+	// 1*1 + 2*2 + 3*0xffffffff = 0x2_00000002; v2 adds the upper half
+	if tc.AccurateRipV1() != 2 || tc.AccurateRipV2() != 4 {
+		t.Errorf("AccurateRip checksums %08X, %08X", tc.AccurateRipV1(), tc.AccurateRipV2())
+	}
+
+	// The first 5 frames of a disc are left out, save for the last sample
+	audio = make([]byte, 4*(accurateRipSkip+1))
+	audio[4*(accurateRipSkip-2)] = 1
+	audio[4*(accurateRipSkip-1)] = 1
+	audio[4*accurateRipSkip] = 1
+	tc = NewTrackChecksum(accurateRipSkip+1, true, false)
+	tc.Write(audio)
+	if tc.AccurateRipV1() != 2*accurateRipSkip+1 {
+		t.Errorf("first track: %d", tc.AccurateRipV1())
+	}
+
+	// ... and so are the last 5 frames
+	tc = NewTrackChecksum(accurateRipSkip+1, false, true)
+	tc.Write(audio)
+	if tc.AccurateRipV1() != 0 {
+		t.Errorf("last track: %d", tc.AccurateRipV1())
+	}
+	audio[0] = 1
+	tc = NewTrackChecksum(accurateRipSkip+1, false, true)
+	tc.Write(audio)
+	if tc.AccurateRipV1() != 1 {
+		t.Errorf("last track: %d", tc.AccurateRipV1())
+	}
+}
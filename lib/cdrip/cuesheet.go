@@ -0,0 +1,200 @@
+package cdrip
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A CueSheet describes the layout of a CD, and the files it was ripped to
+type CueSheet struct {
+	// The Media Catalog Number (usually the EAN/UPC barcode)
+	Catalog string
+
+	Title      string
+	Performer  string
+	Songwriter string
+
+	// The release date, from a 'REM DATE' comment
+	Date string
+
+	Files []CueFile
+}
+
+// A CueFile is an audio file containing one or more tracks
+type CueFile struct {
+	Name string
+	Type string
+
+	Tracks []CueTrack
+}
+
+// A CueTrack is one track on a CD
+type CueTrack struct {
+	Number int
+	Type   string
+
+	Title      string
+	Performer  string
+	Songwriter string
+	ISRC       string
+
+	// The index points of this track, relative to the start of its file
+	Indexes []CueIndex
+}
+
+// A CueIndex marks a position within a track. Index 0 marks the start of
+// the pregap, and index 1 the start of the track proper.
+type CueIndex struct {
+	Number   int
+	Position Frames
+}
+
+// Start returns the position of index 1 of a track, or that of its first
+// index if it doesn't have one.
+func (t CueTrack) Start() Frames {
+	for _, idx := range t.Indexes {
+		if idx.Number == 1 {
+			return idx.Position
+		}
+	}
+	if len(t.Indexes) > 0 {
+		return t.Indexes[0].Position
+	}
+	return 0
+}
+
+// Tracks returns all tracks in the cue sheet, in order
+func (c *CueSheet) Tracks() []CueTrack {
+	var rv []CueTrack
+	for _, f := range c.Files {
+		rv = append(rv, f.Tracks...)
+	}
+	return rv
+}
+
+// SingleFile returns true if all tracks were ripped to one file
+func (c *CueSheet) SingleFile() bool {
+	return len(c.Files) == 1 && len(c.Files[0].Tracks) > 1
+}
+
+// ParseCueSheet reads a cue sheet
+func ParseCueSheet(r io.Reader) (*CueSheet, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &CueSheet{}
+	var file *CueFile
+	var track *CueTrack
+
+	for i, line := range strings.Split(decodeText(b), "\n") {
+		fields := splitCueLine(line)
+		if len(fields) == 0 {
+			continue
+		}
+		arg := func(n int) string {
+			if n < len(fields) {
+				return fields[n]
+			}
+			return ""
+		}
+		fail := func(format string, args ...interface{}) (*CueSheet, error) {
+			return nil, fmt.Errorf("line %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+
+		switch cmd := strings.ToUpper(fields[0]); cmd {
+		case "CATALOG":
+			// Rippers write all zeroes for discs that don't have one
+			if strings.Trim(arg(1), "0") != "" {
+				rv.Catalog = arg(1)
+			}
+		case "REM":
+			if strings.ToUpper(arg(1)) == "DATE" {
+				rv.Date = arg(2)
+			}
+		case "FILE":
+			rv.Files = append(rv.Files, CueFile{Name: arg(1), Type: arg(2)})
+			file = &rv.Files[len(rv.Files)-1]
+			track = nil
+		case "TRACK":
+			if file == nil {
+				return fail("TRACK before FILE")
+			}
+			n, err := strconv.Atoi(arg(1))
+			if err != nil {
+				return fail("invalid track number '%s'", arg(1))
+			}
+			file.Tracks = append(file.Tracks, CueTrack{Number: n, Type: arg(2)})
+			track = &file.Tracks[len(file.Tracks)-1]
+		case "INDEX":
+			if track == nil {
+				return fail("INDEX outside of a track")
+			}
+			n, err := strconv.Atoi(arg(1))
+			if err != nil {
+				return fail("invalid index number '%s'", arg(1))
+			}
+			pos, err := ParseFrames(arg(2))
+			if err != nil {
+				return fail("%v", err)
+			}
+			track.Indexes = append(track.Indexes, CueIndex{Number: n, Position: pos})
+		case "TITLE", "PERFORMER", "SONGWRITER", "ISRC":
+			// These apply to the current track, or to the whole disc before the first one
+			var title, performer, songwriter, isrc *string
+			if track != nil {
+				title, performer, songwriter, isrc = &track.Title, &track.Performer, &track.Songwriter, &track.ISRC
+			} else {
+				title, performer, songwriter = &rv.Title, &rv.Performer, &rv.Songwriter
+			}
+			switch cmd {
+			case "TITLE":
+				*title = arg(1)
+			case "PERFORMER":
+				*performer = arg(1)
+			case "SONGWRITER":
+				*songwriter = arg(1)
+			case "ISRC":
+				if isrc != nil {
+					*isrc = arg(1)
+				}
+			}
+		}
+	}
+
+	if len(rv.Tracks()) == 0 {
+		return nil, fmt.Errorf("no tracks in cue sheet")
+	}
+
+	return rv, nil
+}
+
+// splitCueLine splits a line into its fields, some of which may be quoted
+func splitCueLine(line string) []string {
+	var rv []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				rv = append(rv, line[1:])
+				break
+			}
+			rv = append(rv, line[1:end+1])
+			line = strings.TrimSpace(line[end+2:])
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			rv = append(rv, line)
+			break
+		}
+		rv = append(rv, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+	return rv
+}
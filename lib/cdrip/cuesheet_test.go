@@ -0,0 +1,96 @@
+package cdrip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+const testCueSheet = `REM GENRE Classical
+REM DATE 1976
+CATALOG 0028944740024
+PERFORMER "Wiener Philharmoniker, Carlos Kleiber"
+TITLE "Beethoven: Symphonies 5 & 7"
+FILE "Beethoven.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "Symphony No. 5 in C minor, Op. 67: I. Allegro con brio"
+    SONGWRITER "Ludwig van Beethoven"
+    ISRC DEF057611110
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Symphony No. 5 in C minor, Op. 67: II. Andante con moto"
+    PERFORMER "Carlos Kleiber"
+    INDEX 00 07:25:40
+    INDEX 01 07:27:65
+`
+
+func TestParseCueSheet(t *testing.T) {
+	cue, err := ParseCueSheet(bytes.NewBufferString(testCueSheet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cue.Catalog != "0028944740024" || cue.Title != "Beethoven: Symphonies 5 & 7" || cue.Date != "1976" {
+		t.Errorf("disc details: %+v", cue)
+	}
+	if cue.Performer != "Wiener Philharmoniker, Carlos Kleiber" {
+		t.Errorf("performer '%s'", cue.Performer)
+	}
+	if !cue.SingleFile() || cue.Files[0].Name != "Beethoven.flac" {
+		t.Errorf("files: %+v", cue.Files)
+	}
+
+	tracks := cue.Tracks()
+	if len(tracks) != 2 {
+		t.Fatalf("expected 2 tracks; got %d", len(tracks))
+	}
+	if tracks[0].ISRC != "DEF057611110" || tracks[0].Songwriter != "Ludwig van Beethoven" || tracks[0].Performer != "" {
+		t.Errorf("track 1: %+v", tracks[0])
+	}
+	if tracks[1].Number != 2 || tracks[1].Performer != "Carlos Kleiber" || tracks[1].Start() != (7*60+27)*75+65 {
+		t.Errorf("track 2: %+v", tracks[1])
+	}
+	if tracks[1].Start().String() != "07:27:65" {
+		t.Errorf("track 2 starts at %s", tracks[1].Start())
+	}
+
+	// Cue sheets written on Windows tend to come in UTF-16
+	u := utf16.Encode([]rune(testCueSheet))
+	b := []byte{0xff, 0xfe}
+	for _, c := range u {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	cue, err = ParseCueSheet(bytes.NewBuffer(b))
+	if err != nil || cue.Title != "Beethoven: Symphonies 5 & 7" {
+		t.Errorf("UTF-16: %v %v", cue, err)
+	}
+
+	if _, err := ParseCueSheet(bytes.NewBufferString("TITLE \"Nothing\"\n")); err == nil {
+		t.Errorf("a cue sheet without tracks should not parse")
+	}
+}
+
+func TestCueSheetWithoutCatalog(t *testing.T) {
+	cue, err := ParseCueSheet(bytes.NewBufferString(strings.Replace(testCueSheet, "0028944740024", "0000000000000", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cue.Catalog != "" {
+		t.Errorf("got catalog number '%s' for a disc without one", cue.Catalog)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	f, err := ParseFrames("01:02:03")
+	if err != nil || f != 62*75+3 {
+		t.Errorf("got %d (%v)", f, err)
+	}
+	if d := Frames(150).Duration(); d != 2*time.Second {
+		t.Errorf("150 frames last %s", d)
+	}
+	if _, err := ParseFrames("01:02:75"); err == nil {
+		t.Errorf("there are only 75 frames in a second")
+	}
+}
@@ -0,0 +1,140 @@
+package cdrip
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	eacTrackHeader = regexp.MustCompile(`^Track\s+([0-9]+)$`)
+	eacAccurateRip = regexp.MustCompile(`(?i)^(?:Track\s+([0-9]+)\s+)?(accurately ripped|cannot be verified as accurate)\s*\(confidence\s+([0-9]+)\)\s*\[([0-9A-F]{8})\](?:.*\(AR v([0-9])\))?`)
+	eacChecksum    = regexp.MustCompile(`^==== Log checksum ([0-9A-Fa-f]{64}) ====$`)
+)
+
+// ParseEACLog reads a log file written by Exact Audio Copy
+func ParseEACLog(r io.Reader) (*RipLog, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	text := decodeText(b)
+	if !strings.HasPrefix(firstLine(text), "Exact Audio Copy") {
+		return nil, fmt.Errorf("not an EAC log file")
+	}
+	return parseEACLog(text)
+}
+
+func parseEACLog(text string) (*RipLog, error) {
+	rv, lines, err := parseLogHeader(text, "EAC extraction logfile")
+	if err != nil {
+		return nil, err
+	}
+
+	var track *TrackLog
+	inRange := false
+	for _, line := range lines {
+		if m := eacTrackHeader.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			track = rv.track(n)
+			inRange = false
+			continue
+		} else if line == "Range status and errors" {
+			inRange = true
+			continue
+		}
+
+		if m := eacAccurateRip.FindStringSubmatch(line); m != nil {
+			// The AccurateRip summary of range rips lists each track on one line
+			t := track
+			if m[1] != "" {
+				n, _ := strconv.Atoi(m[1])
+				t = rv.track(n)
+				track = nil
+			}
+			if t == nil {
+				continue
+			}
+
+			ar := AccurateRipResult{
+				Version:  1,
+				Checksum: parseCRC(m[4]),
+				Accurate: strings.EqualFold(m[2], "accurately ripped"),
+			}
+			ar.Confidence, _ = strconv.Atoi(m[3])
+			if m[5] != "" {
+				ar.Version, _ = strconv.Atoi(m[5])
+			}
+			t.AccurateRip = append(t.AccurateRip, ar)
+			continue
+		}
+
+		if m := eacChecksum.FindStringSubmatch(line); m != nil {
+			if strings.EqualFold(m[1], eacLogChecksum(text)) {
+				rv.Checksum = ChecksumValid
+			} else {
+				rv.Checksum = ChecksumInvalid
+			}
+			continue
+		}
+
+		var crc *uint32
+		if strings.HasPrefix(line, "Test CRC ") {
+			crc = &rv.TestCRC
+			if track != nil {
+				crc = &track.TestCRC
+			}
+		} else if strings.HasPrefix(line, "Copy CRC ") {
+			crc = &rv.CopyCRC
+			if track != nil {
+				crc = &track.CopyCRC
+			}
+		} else if strings.HasPrefix(line, "Filename ") && track != nil {
+			track.Filename = strings.TrimSpace(line[len("Filename "):])
+		}
+		if crc != nil && (track != nil || inRange) {
+			*crc = parseCRC(line[len("Test CRC "):])
+		}
+	}
+
+	return rv, nil
+}
+
+// eacChecksumKey is the key with which EAC signs its logs
+var eacChecksumKey, _ = hex.DecodeString("9378716cf13e4265ae55338e940b376184da389e50647726b35f6f341ee3efd9")
+
+// eacLogChecksum computes the checksum EAC appends to its logs. This is the
+// last block of the log text, encrypted with Rijndael in CBC mode. The
+// checksum line itself and any line breaks are left out.
+func eacLogChecksum(text string) string {
+	if i := strings.LastIndex(text, "==== Log checksum"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.NewReplacer("\r", "", "\n", "", "\ufeff", "").Replace(text)
+
+	u := utf16.Encode([]rune(text))
+	plaintext := make([]byte, 2*len(u))
+	for i, c := range u {
+		plaintext[2*i], plaintext[2*i+1] = byte(c), byte(c>>8)
+	}
+
+	r, _ := newRijndael(eacChecksumKey, 32)
+	block := make([]byte, 32)
+	for i := 0; i < len(plaintext); i += 32 {
+		// The last block is padded with zeroes
+		for k := range block {
+			if i+k < len(plaintext) {
+				block[k] ^= plaintext[i+k]
+			}
+		}
+		r.encrypt(block)
+	}
+
+	return strings.ToUpper(hex.EncodeToString(block))
+}
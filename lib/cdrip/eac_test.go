@@ -0,0 +1,146 @@
+package cdrip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testEACLog = "Exact Audio Copy V1.0 beta 3 from 29. August 2011\r\n" +
+	"\r\n" +
+	"EAC extraction logfile from 16. March 2013, 20:29\r\n" +
+	"\r\n" +
+	"Carlos Kleiber / Beethoven: Symphonies 5 & 7\r\n" +
+	"\r\n" +
+	"Used drive  : PLEXTOR DVDR   PX-716A   Adapter: 1  ID: 0\r\n" +
+	"\r\n" +
+	"TOC of the extracted CD\r\n" +
+	"\r\n" +
+	"     Track |   Start  |  Length  | Start sector | End sector \r\n" +
+	"    ---------------------------------------------------------\r\n" +
+	"        1  |  0:00.00 |  7:27.65 |         0    |    33589   \r\n" +
+	"        2  |  7:27.65 |  9:58.20 |     33590    |    78459   \r\n" +
+	"\r\n" +
+	"\r\n" +
+	"Track  1\r\n" +
+	"\r\n" +
+	"     Filename C:\\Rips\\01 - Allegro con brio.wav\r\n" +
+	"\r\n" +
+	"     Test CRC 0D3A1B2C\r\n" +
+	"     Copy CRC 0D3A1B2C\r\n" +
+	"     Accurately ripped (confidence 12)  [1A2B3C4D]  (AR v2)\r\n" +
+	"     Copy OK\r\n" +
+	"\r\n" +
+	"Track  2\r\n" +
+	"\r\n" +
+	"     Filename C:\\Rips\\02 - Andante con moto.wav\r\n" +
+	"\r\n" +
+	"     Copy CRC 99887766\r\n" +
+	"     Cannot be verified as accurate (confidence 3)  [55AA55AA], AccurateRip returned [12345678]  (AR v2)\r\n" +
+	"     Copy OK\r\n" +
+	"\r\n" +
+	"No errors occurred\r\n" +
+	"\r\n" +
+	"End of status report\r\n"
+
+const testEACRangeLog = "Exact Audio Copy V1.0 beta 3 from 29. August 2011\r\n" +
+	"\r\n" +
+	"EAC extraction logfile from 16. March 2013, 20:29\r\n" +
+	"\r\n" +
+	"Carlos Kleiber / Beethoven: Symphonies 5 & 7\r\n" +
+	"\r\n" +
+	"     Track |   Start  |  Length  | Start sector | End sector \r\n" +
+	"    ---------------------------------------------------------\r\n" +
+	"        1  |  0:00.00 |  7:27.65 |         0    |    33589   \r\n" +
+	"        2  |  7:27.65 |  9:58.20 |     33590    |    78459   \r\n" +
+	"\r\n" +
+	"Range status and errors\r\n" +
+	"\r\n" +
+	"Selected range\r\n" +
+	"\r\n" +
+	"     Test CRC 11223344\r\n" +
+	"     Copy CRC 11223344\r\n" +
+	"\r\n" +
+	"AccurateRip summary\r\n" +
+	"\r\n" +
+	"Track  1  accurately ripped (confidence 12)  [1A2B3C4D]  (AR v2)\r\n" +
+	"Track  2  not present in AccurateRip database\r\n"
+
+func TestParseEACLog(t *testing.T) {
+	log, err := ParseEACLog(bytes.NewBufferString(testEACLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Ripper != "Exact Audio Copy V1.0 beta 3 from 29. August 2011" {
+		t.Errorf("ripper '%s'", log.Ripper)
+	}
+	if log.Artist != "Carlos Kleiber" || log.Title != "Beethoven: Symphonies 5 & 7" {
+		t.Errorf("disc '%s' / '%s'", log.Artist, log.Title)
+	}
+	if len(log.TOC) != 2 {
+		t.Fatalf("expected 2 tracks; got %d", len(log.TOC))
+	}
+	if log.TOC[1].Track != 2 || log.TOC[1].Start != 33590 || log.TOC[1].Length() != 44870 {
+		t.Errorf("track 2: %+v", log.TOC[1])
+	}
+
+	if len(log.Tracks) != 2 {
+		t.Fatalf("expected results for 2 tracks; got %d", len(log.Tracks))
+	}
+	if tr := log.Tracks[0]; tr.TestCRC != 0x0D3A1B2C || tr.CopyCRC != 0x0D3A1B2C || tr.Filename != `C:\Rips\01 - Allegro con brio.wav` {
+		t.Errorf("track 1: %+v", tr)
+	}
+	if ar := log.Tracks[0].AccurateRip; len(ar) != 1 || ar[0] != (AccurateRipResult{2, 0x1A2B3C4D, true, 12}) {
+		t.Errorf("track 1: AccurateRip %v", ar)
+	}
+	if tr, ok := log.Track(2); !ok || tr.TestCRC != 0 || tr.CopyCRC != 0x99887766 || len(tr.AccurateRip) != 1 || tr.AccurateRip[0].Accurate {
+		t.Errorf("track 2: %+v", tr)
+	}
+	if log.Checksum != ChecksumMissing {
+		t.Errorf("checksum %s", log.Checksum)
+	}
+
+	if _, err := ParseEACLog(bytes.NewBufferString(testCueSheet)); err == nil {
+		t.Errorf("a cue sheet is not an EAC log")
+	}
+
+	// Single-file rips have CRCs for the whole range, and a summary of the AccurateRip results
+	log, err = ParseRipLog(bytes.NewBufferString(testEACRangeLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.TestCRC != 0x11223344 || log.CopyCRC != 0x11223344 {
+		t.Errorf("range CRCs %08X %08X", log.TestCRC, log.CopyCRC)
+	}
+	if tr, ok := log.Track(1); !ok || len(tr.AccurateRip) != 1 || tr.AccurateRip[0].Checksum != 0x1A2B3C4D {
+		t.Errorf("range track 1: %+v", tr)
+	}
+	if _, ok := log.Track(2); ok {
+		t.Errorf("track 2 is not in the AccurateRip database")
+	}
+}
+
+func TestEACLogChecksum(t *testing.T) {
+	sum := eacLogChecksum(testEACLog)
+	if len(sum) != 64 {
+		t.Fatalf("checksum '%s'", sum)
+	}
+
+	// Line breaks don't count
+	if eacLogChecksum(strings.ReplaceAll(testEACLog, "\r\n", "\n")) != sum {
+		t.Errorf("line breaks changed the checksum")
+	}
+
+	signed := testEACLog + "\r\n==== Log checksum " + sum + " ====\r\n"
+	log, err := ParseRipLog(bytes.NewBufferString(signed))
+	if err != nil || log.Checksum != ChecksumValid {
+		t.Errorf("signed log: checksum %v (%v)", log.Checksum, err)
+	}
+
+	tampered := strings.Replace(signed, "Copy CRC 99887766", "Copy CRC 99887767", 1)
+	log, err = ParseRipLog(bytes.NewBufferString(tampered))
+	if err != nil || log.Checksum != ChecksumInvalid {
+		t.Errorf("tampered log: checksum %v (%v)", log.Checksum, err)
+	}
+}
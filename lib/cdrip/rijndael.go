@@ -0,0 +1,128 @@
+package cdrip
+
+import "fmt"
+
+// A rijndael cipher is like AES, but allows for larger blocks. EAC signs its
+// logs using 256-bit blocks, which crypto/aes doesn't support.
+type rijndael struct {
+	nb, nr int
+	w      [][4]byte
+}
+
+var rijndaelSbox [256]byte
+
+func init() {
+	// Build the S-box from the multiplicative inverse in GF(2^8), using 3 as
+	// a generator, followed by the affine transformation
+	var exp, log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+		x ^= xtime(x)
+	}
+
+	for i := 0; i < 256; i++ {
+		var inv byte
+		if i != 0 {
+			inv = exp[(255-int(log[i]))%255]
+		}
+		s := inv
+		for k := 1; k <= 4; k++ {
+			s ^= inv<<k | inv>>(8-k)
+		}
+		rijndaelSbox[i] = s ^ 0x63
+	}
+}
+
+func xtime(b byte) byte {
+	if b&0x80 != 0 {
+		return b<<1 ^ 0x1b
+	}
+	return b << 1
+}
+
+// newRijndael sets up a cipher for a block size of 16 to 32 bytes, in steps of 4
+func newRijndael(key []byte, blockSize int) (*rijndael, error) {
+	nk, nb := len(key)/4, blockSize/4
+	if len(key)%4 != 0 || nk < 4 || nk > 8 || blockSize%4 != 0 || nb < 4 || nb > 8 {
+		return nil, fmt.Errorf("invalid key or block size")
+	}
+
+	r := &rijndael{nb: nb, nr: nb + 6}
+	if nk > nb {
+		r.nr = nk + 6
+	}
+
+	r.w = make([][4]byte, nb*(r.nr+1))
+	for i := 0; i < nk; i++ {
+		copy(r.w[i][:], key[4*i:])
+	}
+	rcon := byte(1)
+	for i := nk; i < len(r.w); i++ {
+		t := r.w[i-1]
+		if i%nk == 0 {
+			t = [4]byte{rijndaelSbox[t[1]] ^ rcon, rijndaelSbox[t[2]], rijndaelSbox[t[3]], rijndaelSbox[t[0]]}
+			rcon = xtime(rcon)
+		} else if nk > 6 && i%nk == 4 {
+			t = [4]byte{rijndaelSbox[t[0]], rijndaelSbox[t[1]], rijndaelSbox[t[2]], rijndaelSbox[t[3]]}
+		}
+		for k := range t {
+			r.w[i][k] = r.w[i-nk][k] ^ t[k]
+		}
+	}
+
+	return r, nil
+}
+
+// encrypt encrypts one block in place
+func (r *rijndael) encrypt(block []byte) {
+	// The state is stored column by column, just like the block
+	s := block[:4*r.nb]
+
+	addRoundKey := func(round int) {
+		for c := 0; c < r.nb; c++ {
+			for k := 0; k < 4; k++ {
+				s[4*c+k] ^= r.w[round*r.nb+c][k]
+			}
+		}
+	}
+
+	// Rows are shifted by different amounts for larger blocks
+	shifts := [4]int{0, 1, 2, 3}
+	if r.nb == 7 {
+		shifts = [4]int{0, 1, 2, 4}
+	} else if r.nb == 8 {
+		shifts = [4]int{0, 1, 3, 4}
+	}
+	row := make([]byte, r.nb)
+
+	addRoundKey(0)
+	for round := 1; round <= r.nr; round++ {
+		for i := range s {
+			s[i] = rijndaelSbox[s[i]]
+		}
+
+		for k := 1; k < 4; k++ {
+			for c := range row {
+				row[c] = s[4*((c+shifts[k])%r.nb)+k]
+			}
+			for c, b := range row {
+				s[4*c+k] = b
+			}
+		}
+
+		if round != r.nr {
+			for c := 0; c < r.nb; c++ {
+				a0, a1, a2, a3 := s[4*c], s[4*c+1], s[4*c+2], s[4*c+3]
+				all := a0 ^ a1 ^ a2 ^ a3
+				s[4*c] ^= all ^ xtime(a0^a1)
+				s[4*c+1] ^= all ^ xtime(a1^a2)
+				s[4*c+2] ^= all ^ xtime(a2^a3)
+				s[4*c+3] ^= all ^ xtime(a3^a0)
+			}
+		}
+
+		addRoundKey(round)
+	}
+}
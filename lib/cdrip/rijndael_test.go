@@ -0,0 +1,38 @@
+package cdrip
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestRijndael(t *testing.T) {
+	// With 128-bit blocks, Rijndael is AES
+	for _, keySize := range []int{16, 24, 32} {
+		key := make([]byte, keySize)
+		block := make([]byte, 16)
+		for i := range key {
+			key[i] = byte(i*7 + 3)
+		}
+		for i := range block {
+			block[i] = byte(i * 31)
+		}
+
+		expected := make([]byte, 16)
+		a, _ := aes.NewCipher(key)
+		a.Encrypt(expected, block)
+
+		r, err := newRijndael(key, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.encrypt(block)
+		if !bytes.Equal(block, expected) {
+			t.Errorf("%d-bit key: got %x; expected %x", keySize*8, block, expected)
+		}
+	}
+
+	if _, err := newRijndael(make([]byte, 32), 12); err == nil {
+		t.Errorf("expected an error for a 96-bit block")
+	}
+}
@@ -0,0 +1,221 @@
+package cdrip
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A RipLog contains the details of a CD rip, as recorded by the ripper
+type RipLog struct {
+	// The name and version of the program that wrote the log
+	Ripper string
+
+	Artist string
+	Title  string
+
+	// The table of contents of the CD
+	TOC []TOCEntry
+
+	// The results for each track
+	Tracks []TrackLog
+
+	// If the disc was ripped to one file, the CRC32 of the test and copy
+	// passes over that file, or 0 if there weren't any
+	TestCRC, CopyCRC uint32
+
+	// Whether the log was signed by the ripper, and if so, if it's been
+	// tampered with since
+	Checksum ChecksumStatus
+}
+
+// A TOCEntry is the position of a track on a CD
+type TOCEntry struct {
+	Track int
+
+	// The first and last sector of the track
+	Start, End Frames
+}
+
+// Length returns the length of a track
+func (e TOCEntry) Length() Frames {
+	return e.End - e.Start + 1
+}
+
+// A TrackLog contains the results of ripping one track
+type TrackLog struct {
+	Number   int
+	Filename string
+
+	// The CRC32 of the test and copy passes, or 0 if there weren't any
+	TestCRC, CopyCRC uint32
+
+	// The AccurateRip checksums the ripper computed, and what it found in
+	// the AccurateRip database
+	AccurateRip []AccurateRipResult
+}
+
+// An AccurateRipResult is the result of looking up a track in the
+// AccurateRip database
+type AccurateRipResult struct {
+	// The version of the AccurateRip checksum (1 or 2)
+	Version int
+
+	// The checksum the ripper computed
+	Checksum uint32
+
+	// Whether the database contains this checksum, and how many others
+	// submitted it
+	Accurate   bool
+	Confidence int
+}
+
+func (a AccurateRipResult) String() string {
+	if a.Accurate {
+		return fmt.Sprintf("v%d %08X: accurately ripped (confidence %d)", a.Version, a.Checksum, a.Confidence)
+	} else if a.Confidence > 0 {
+		return fmt.Sprintf("v%d %08X: not accurately ripped (confidence %d)", a.Version, a.Checksum, a.Confidence)
+	}
+	return fmt.Sprintf("v%d %08X: not in the database", a.Version, a.Checksum)
+}
+
+// A ChecksumStatus tells if a log is signed by the ripper
+type ChecksumStatus int
+
+// The possible states of a log's checksum
+const (
+	ChecksumMissing ChecksumStatus = iota
+	ChecksumValid
+	ChecksumInvalid
+	ChecksumUnsupported
+)
+
+func (c ChecksumStatus) String() string {
+	switch c {
+	case ChecksumValid:
+		return "valid"
+	case ChecksumInvalid:
+		return "invalid"
+	case ChecksumUnsupported:
+		return "unsupported"
+	}
+	return "missing"
+}
+
+// Track returns the results for a track, if the log has them
+func (l *RipLog) Track(n int) (TrackLog, bool) {
+	for _, t := range l.Tracks {
+		if t.Number == n {
+			return t, true
+		}
+	}
+	return TrackLog{}, false
+}
+
+// track returns the results for a track, adding them if they aren't there yet
+func (l *RipLog) track(n int) *TrackLog {
+	for i := range l.Tracks {
+		if l.Tracks[i].Number == n {
+			return &l.Tracks[i]
+		}
+	}
+	l.Tracks = append(l.Tracks, TrackLog{Number: n})
+	return &l.Tracks[len(l.Tracks)-1]
+}
+
+// ParseRipLog reads a log file written by Exact Audio Copy or X Lossless Decoder
+func ParseRipLog(r io.Reader) (*RipLog, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	text := decodeText(b)
+	switch first := firstLine(text); {
+	case strings.HasPrefix(first, "Exact Audio Copy"):
+		return parseEACLog(text)
+	case strings.HasPrefix(first, "X Lossless Decoder"):
+		return parseXLDLog(text)
+	}
+	return nil, fmt.Errorf("not an EAC or XLD log file")
+}
+
+// logLines splits a log file into lines, without any surrounding whitespace
+func logLines(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return lines
+}
+
+func firstLine(text string) string {
+	for _, line := range logLines(text) {
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+var tocLine = regexp.MustCompile(`^\s*([0-9]+)\s*\|\s*[0-9:.]+\s*\|\s*[0-9:.]+\s*\|\s*([0-9]+)\s*\|\s*([0-9]+)\s*$`)
+
+// parseLogHeader reads the parts that EAC and XLD logs have in common: the
+// ripper, the disc and the table of contents. It returns the lines after
+// the table of contents.
+func parseLogHeader(text, header string) (*RipLog, []string, error) {
+	rv := &RipLog{}
+	lines := logLines(text)
+
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, nil, fmt.Errorf("empty log file")
+	}
+	rv.Ripper = lines[0]
+
+	// The line after the header introduces the disc as 'Artist / Title'
+	i := 1
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], header) {
+			break
+		}
+	}
+	for i++; i < len(lines); i++ {
+		if lines[i] != "" {
+			if k := strings.Index(lines[i], " / "); k >= 0 {
+				rv.Artist, rv.Title = lines[i][:k], lines[i][k+3:]
+			}
+			break
+		}
+	}
+
+	for ; i < len(lines); i++ {
+		if m := tocLine.FindStringSubmatch(lines[i]); m != nil {
+			var e TOCEntry
+			e.Track, _ = strconv.Atoi(m[1])
+			start, _ := strconv.Atoi(m[2])
+			end, _ := strconv.Atoi(m[3])
+			e.Start, e.End = Frames(start), Frames(end)
+			rv.TOC = append(rv.TOC, e)
+		} else if len(rv.TOC) > 0 && lines[i] == "" {
+			break
+		}
+	}
+
+	if len(rv.TOC) == 0 {
+		return nil, nil, fmt.Errorf("no table of contents in log file")
+	}
+
+	return rv, lines[i:], nil
+}
+
+// parseCRC reads a CRC32 as written in a log file
+func parseCRC(s string) uint32 {
+	c, _ := strconv.ParseUint(strings.TrimSpace(s), 16, 32)
+	return uint32(c)
+}
@@ -0,0 +1,89 @@
+package cdrip
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	xldTrackHeader   = regexp.MustCompile(`^Track ([0-9]+)$`)
+	xldField         = regexp.MustCompile(`^([^:]+?)\s*:\s*(.*)$`)
+	xldAccurateRipV  = regexp.MustCompile(`^AccurateRip v([0-9]) signature$`)
+	xldConfidence    = regexp.MustCompile(`confidence ([0-9]+)`)
+	xldSignatureLine = "-----BEGIN XLD SIGNATURE-----"
+)
+
+// parseXLDLog reads a log file written by X Lossless Decoder. XLD signs its
+// logs too, but the way it does so isn't documented, so the signature can't
+// be checked.
+func parseXLDLog(text string) (*RipLog, error) {
+	rv, lines, err := parseLogHeader(text, "XLD extraction logfile")
+	if err != nil {
+		return nil, err
+	}
+
+	var track *TrackLog
+	var ar *AccurateRipResult
+	allTracks := false
+	for _, line := range lines {
+		if m := xldTrackHeader.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			track = rv.track(n)
+			ar = nil
+			allTracks = false
+			continue
+		} else if line == "All Tracks" {
+			allTracks = true
+			continue
+		} else if line == xldSignatureLine {
+			rv.Checksum = ChecksumUnsupported
+			break
+		}
+
+		// The result of an AccurateRip lookup follows the checksum on a line
+		// of its own, e.g. '->Accurately ripped (v1+v2, confidence 12+8/20)'
+		if strings.HasPrefix(line, "->") && ar != nil {
+			ar.Accurate = strings.HasPrefix(line, "->Accurately ripped")
+			if m := xldConfidence.FindStringSubmatch(line); m != nil {
+				ar.Confidence, _ = strconv.Atoi(m[1])
+			}
+			continue
+		}
+
+		m := xldField.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key, value := m[1], m[2]
+
+		if track == nil {
+			// The CRCs of all tracks together are useful for single-file rips
+			if allTracks {
+				if key == "CRC32 hash (test run)" {
+					rv.TestCRC = parseCRC(value)
+				} else if key == "CRC32 hash" {
+					rv.CopyCRC = parseCRC(value)
+				}
+			}
+			continue
+		}
+
+		switch key {
+		case "Filename":
+			track.Filename = value
+		case "CRC32 hash (test run)":
+			track.TestCRC = parseCRC(value)
+		case "CRC32 hash":
+			track.CopyCRC = parseCRC(value)
+		default:
+			if v := xldAccurateRipV.FindStringSubmatch(key); v != nil {
+				n, _ := strconv.Atoi(v[1])
+				track.AccurateRip = append(track.AccurateRip, AccurateRipResult{Version: n, Checksum: parseCRC(value)})
+				ar = &track.AccurateRip[len(track.AccurateRip)-1]
+			}
+		}
+	}
+
+	return rv, nil
+}
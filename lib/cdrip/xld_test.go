@@ -0,0 +1,92 @@
+package cdrip
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testXLDLog = `X Lossless Decoder version 20121027 (143.1)
+
+XLD extraction logfile from 2013-03-16 20:29:00 +0100
+
+Carlos Kleiber / Beethoven: Symphonies 5 & 7
+
+Used drive : PLEXTOR DVDR PX-716A (revision 1.11)
+
+TOC of the extracted CD
+     Track |   Start  |  Length  | Start sector | End sector
+    ---------------------------------------------------------
+        1  | 00:00:00 | 07:27:65 |         0    |    33589
+        2  | 07:27:65 | 09:58:20 |     33590    |    78459
+
+AccurateRip Summary (DiscID: 00123456-00abcdef-1234abcd)
+    Track 01 : OK (A1+A2, v1+v2 confidence 12+8/20)
+    Track 02 : NG
+
+All Tracks
+    Album gain               : -3.21 dB
+    CRC32 hash (test run)    : 11223344
+    CRC32 hash               : 11223344
+
+Track 01
+    Filename : /Users/thijs/Music/01 - Allegro con brio.flac
+    Pre-gap length : 00:02:00
+
+    CRC32 hash (test run)  : 0D3A1B2C
+    CRC32 hash             : 0D3A1B2C
+    CRC32 hash (skip zero) : 7A6B5C4D
+    AccurateRip v1 signature : 1A2B3C4D
+        ->Accurately ripped (v1+v2, confidence 12+8/20)
+    AccurateRip v2 signature : 5E6F7A8B
+        ->Accurately ripped (v2, confidence 8/20)
+
+Track 02
+    Filename : /Users/thijs/Music/02 - Andante con moto.flac
+
+    CRC32 hash             : 99887766
+    AccurateRip v1 signature : 55AA55AA
+        ->Rip may not be accurate.
+
+No errors occurred
+
+End of status report
+
+-----BEGIN XLD SIGNATURE-----
+AbCdEf0123456789
+-----END XLD SIGNATURE-----
+`
+
+func TestParseXLDLog(t *testing.T) {
+	log, err := ParseRipLog(bytes.NewBufferString(testXLDLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Ripper != "X Lossless Decoder version 20121027 (143.1)" || log.Title != "Beethoven: Symphonies 5 & 7" {
+		t.Errorf("ripper '%s', title '%s'", log.Ripper, log.Title)
+	}
+	if len(log.TOC) != 2 || log.TOC[1].Start != 33590 {
+		t.Errorf("TOC: %+v", log.TOC)
+	}
+	if log.TestCRC != 0x11223344 || log.CopyCRC != 0x11223344 {
+		t.Errorf("all tracks: CRCs %08X %08X", log.TestCRC, log.CopyCRC)
+	}
+	if log.Checksum != ChecksumUnsupported {
+		t.Errorf("checksum %s", log.Checksum)
+	}
+
+	if len(log.Tracks) != 2 {
+		t.Fatalf("expected results for 2 tracks; got %d", len(log.Tracks))
+	}
+	tr := log.Tracks[0]
+	if tr.Filename != "/Users/thijs/Music/01 - Allegro con brio.flac" || tr.TestCRC != 0x0D3A1B2C || tr.CopyCRC != 0x0D3A1B2C {
+		t.Errorf("track 1: %+v", tr)
+	}
+	if len(tr.AccurateRip) != 2 || tr.AccurateRip[0] != (AccurateRipResult{1, 0x1A2B3C4D, true, 12}) || tr.AccurateRip[1] != (AccurateRipResult{2, 0x5E6F7A8B, true, 8}) {
+		t.Errorf("track 1: AccurateRip %v", tr.AccurateRip)
+	}
+	tr = log.Tracks[1]
+	if tr.TestCRC != 0 || tr.CopyCRC != 0x99887766 || len(tr.AccurateRip) != 1 || tr.AccurateRip[0].Accurate {
+		t.Errorf("track 2: %+v", tr)
+	}
+}
@@ -0,0 +1,82 @@
+// Package thumbnail scales down cover art and other images for display in
+// the web interface.
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Covers may also come as PNG or GIF
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Quality is the JPEG quality of generated thumbnails
+const Quality = 85
+
+// Scale shrinks an image so that it fits within a square of the specified
+// size, preserving its aspect ratio. Images that already fit are returned
+// as they are.
+func Scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if size <= 0 || (w <= size && h <= size) {
+		return img
+	}
+
+	tw, th := size, size
+	if w > h {
+		th = (h*size + w/2) / w
+	} else {
+		tw = (w*size + h/2) / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	// Average all source pixels that fall within each target pixel
+	rv := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := b.Min.Y+ty*h/th, b.Min.Y+(ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := b.Min.X+tx*w/tw, b.Min.X+(tx+1)*w/tw
+
+			var r, g, bl, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					bl += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			rv.SetRGBA(tx, ty, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return rv
+}
+
+// JPEG reads an image, and writes a JPEG thumbnail of it that fits within a
+// square of the specified size
+func JPEG(w io.Writer, r io.Reader, size int) error {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+
+	return jpeg.Encode(w, Scale(img, size), &jpeg.Options{Quality: Quality})
+}
@@ -0,0 +1,56 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			// Alternating black and white columns average out to grey
+			if x%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	th := Scale(img, 100)
+	if b := th.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("thumbnail size is %dx%d; expected 100x50", b.Dx(), b.Dy())
+	}
+	r, _, _, _ := th.At(10, 10).RGBA()
+	if r>>8 < 120 || r>>8 > 135 {
+		t.Errorf("pixel value %d; expected about 127", r>>8)
+	}
+
+	if Scale(img, 500) != image.Image(img) {
+		t.Errorf("an image that already fits was scaled")
+	}
+}
+
+func TestJPEG(t *testing.T) {
+	var in bytes.Buffer
+	png.Encode(&in, image.NewGray(image.Rect(0, 0, 120, 300)))
+
+	var out bytes.Buffer
+	err := JPEG(&out, &in, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := jpeg.DecodeConfig(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 24 || cfg.Height != 60 {
+		t.Errorf("thumbnail size is %dx%d; expected 24x60", cfg.Width, cfg.Height)
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Package transcodecache implements a content-addressed cache for transcoded
+audio files on the local file system.
+
+Entries are identified by a key derived from a hash of the source material and
+the encoder settings used. The total size of the cache is kept under a set
+limit by evicting the least recently used entries.
+
+Usage:
+	c, err := transcodecache.New("/path/to/cache", 2<<30)
+	key := transcodecache.Key(sourceHash, "lame -V2")
+	f, err := c.GetOrCreate(key, func(w io.Writer) error {
+		// encode the source into w
+	})
+*/
+package transcodecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Cache stores transcoded files in a directory on disk
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	// mu guards evictions; entries themselves are written atomically
+	mu sync.Mutex
+}
+
+// An Entry describes one file in the cache
+type Entry struct {
+	Key      string
+	Size     int64
+	LastUsed time.Time
+}
+
+// New opens a cache in the specified directory, creating it if necessary. A
+// maxSize of 0 or less disables the size limit.
+func New(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+	}, nil
+}
+
+// Key derives a cache key from the hash of the source material and a
+// description of the encoder settings
+func Key(sourceHash, settings string) string {
+	h := sha256.New()
+	io.WriteString(h, sourceHash)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, settings)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Dir returns the cache directory
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// MaxSize returns the size limit of the cache
+func (c *Cache) MaxSize() int64 {
+	return c.maxSize
+}
+
+func (c *Cache) filename(key string) string {
+	if len(key) < 3 || strings.ContainsAny(key, "/\\.") {
+		return filepath.Join(c.dir, "invalid", key)
+	}
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Open opens a cached file for reading, and marks it as recently used. If
+// there's no entry for this key, the error satisfies os.IsNotExist.
+func (c *Cache) Open(key string) (*os.File, error) {
+	fn := c.filename(key)
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	os.Chtimes(fn, now, now)
+
+	return f, nil
+}
+
+// A Pending entry is being written to the cache. It only becomes visible to
+// readers after Commit is called.
+type Pending struct {
+	*os.File
+	cache *Cache
+	key   string
+}
+
+// Create starts writing a new cache entry
+func (c *Cache) Create(key string) (*Pending, error) {
+	fn := c.filename(key)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(fn), ".pending-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pending{
+		File:  f,
+		cache: c,
+		key:   key,
+	}, nil
+}
+
+// Commit adds the entry to the cache, and evicts older entries if needed. The
+// new entry itself is never evicted, even if it's larger than the limit.
+func (p *Pending) Commit() error {
+	if err := p.rename(); err != nil {
+		return err
+	}
+	return p.prune()
+}
+
+func (p *Pending) rename() error {
+	if err := p.File.Close(); err != nil {
+		os.Remove(p.File.Name())
+		return err
+	}
+
+	if err := os.Rename(p.File.Name(), p.cache.filename(p.key)); err != nil {
+		os.Remove(p.File.Name())
+		return err
+	}
+	return nil
+}
+
+func (p *Pending) prune() error {
+	if p.cache.maxSize <= 0 {
+		return nil
+	}
+	_, err := p.cache.evict(p.cache.maxSize, p.key)
+	return err
+}
+
+// Abort discards the pending entry
+func (p *Pending) Abort() error {
+	p.File.Close()
+	return os.Remove(p.File.Name())
+}
+
+// GetOrCreate opens the entry for this key. If it doesn't exist, it is
+// created first by calling fill.
+func (c *Cache) GetOrCreate(key string, fill func(w io.Writer) error) (*os.File, error) {
+	f, err := c.Open(key)
+	if err == nil {
+		return f, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	p, err := c.Create(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fill(p); err != nil {
+		p.Abort()
+		return nil, err
+	}
+
+	// Open the entry before making room for it, so it can still be read if
+	// another entry pushes it out right away
+	if err := p.rename(); err != nil {
+		return nil, err
+	}
+	f, err = c.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.prune(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Entries lists all entries in the cache, least recently used first
+func (c *Cache) Entries() ([]Entry, error) {
+	var rv []Entry
+
+	err := filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rv = append(rv, Entry{
+			Key:      info.Name(),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing cache entries")
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].LastUsed.Before(rv[j].LastUsed)
+	})
+	return rv, nil
+}
+
+// Size returns the total size of all entries in the cache
+func (c *Cache) Size() (int64, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	var rv int64
+	for _, e := range entries {
+		rv += e.Size
+	}
+	return rv, nil
+}
+
+// Prune evicts the least recently used entries until the cache is at most
+// maxSize bytes. A maxSize of 0 or less removes nothing; to clear the cache
+// completely, use Clear.
+func (c *Cache) Prune(maxSize int64) ([]Entry, error) {
+	if maxSize <= 0 {
+		return nil, nil
+	}
+	return c.evict(maxSize, "")
+}
+
+// Clear removes all entries from the cache
+func (c *Cache) Clear() ([]Entry, error) {
+	return c.evict(0, "")
+}
+
+// pendingMaxAge is how long a pending entry may go untouched before it is
+// assumed to be left behind by a crash
+const pendingMaxAge = 24 * time.Hour
+
+// evict removes entries until the cache is at most maxSize bytes, except for
+// the one with the key keep. Pending entries left behind are cleaned up as well.
+func (c *Cache) evict(maxSize int64, keep string) ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.removeStalePending(); err != nil {
+		return nil, err
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	var removed []Entry
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if e.Key == keep {
+			continue
+		}
+		if err := os.Remove(c.filename(e.Key)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		total -= e.Size
+		removed = append(removed, e)
+	}
+
+	return removed, nil
+}
+
+func (c *Cache) removeStalePending() error {
+	cutoff := time.Now().Add(-pendingMaxAge)
+	err := filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasPrefix(info.Name(), ".pending-") && info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "error removing pending entries")
+}
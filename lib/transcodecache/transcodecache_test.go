@@ -0,0 +1,147 @@
+package transcodecache
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetOrCreate(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Key("source", "lame -V2")
+	calls := 0
+	fill := func(w io.Writer) error {
+		calls++
+		_, err := io.WriteString(w, "encoded audio")
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		f, err := c.GetOrCreate(key, fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(b) != "encoded audio" {
+			t.Errorf("unexpected contents '%s'", b)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the entry to be created once; got %d calls", calls)
+	}
+
+	if Key("source", "lame -V0") == key {
+		t.Errorf("different settings should yield different keys")
+	}
+
+	if _, err := c.Open(Key("other", "lame -V2")); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error; got %v", err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c, err := New(t.TempDir(), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"aaa1", "bbb2", "ccc3"} {
+		p, err := c.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(p, strings.Repeat("x", 10))
+		if err := p.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Make sure the access times are ordered
+		tm := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(c.filename(name), tm, tm)
+
+		if i == 1 {
+			// Use the first entry, so it becomes the most recent one
+			f, err := c.Open("aaa1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != "ccc3" || entries[1].Key != "aaa1" {
+		t.Errorf("unexpected entries after eviction: %v", entries)
+	}
+
+	if _, err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := c.Size(); size != 0 {
+		t.Errorf("cache should be empty after clearing; size is %d", size)
+	}
+}
+
+func TestOversizedEntry(t *testing.T) {
+	c, err := New(t.TempDir(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := c.GetOrCreate("abc123", func(w io.Writer) error {
+		_, err := io.WriteString(w, "larger than the cache")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b, _ := io.ReadAll(f)
+	if string(b) != "larger than the cache" {
+		t.Errorf("unexpected contents %q", b)
+	}
+}
+
+func TestStalePending(t *testing.T) {
+	c, err := New(t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := c.Create("aaa1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Close()
+	old := time.Now().Add(-2 * pendingMaxAge)
+	os.Chtimes(stale.Name(), old, old)
+
+	fresh, err := c.Create("bbb2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Abort()
+
+	if _, err := c.Prune(c.MaxSize()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale.Name()); !os.IsNotExist(err) {
+		t.Errorf("the stale pending entry was not removed")
+	}
+	if _, err := os.Stat(fresh.Name()); err != nil {
+		t.Errorf("the pending entry that is still being written was removed: %v", err)
+	}
+}
@@ -0,0 +1,451 @@
+// Package users implements user accounts, API tokens and login sessions for
+// the speeldoos web server.
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A Role determines what a user is allowed to do. Every role includes all
+// permissions of the roles before it.
+type Role int
+
+const (
+	// RoleNone is the role of anonymous users
+	RoleNone Role = iota
+
+	// Listeners can browse the library and listen to streams
+	RoleListener
+
+	// DJs can also change what's playing
+	RoleDJ
+
+	// Admins can also change the library
+	RoleAdmin
+)
+
+var roleNames = []string{"none", "listener", "dj", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole parses a role from its name
+func ParseRole(s string) (Role, error) {
+	for i, n := range roleNames {
+		if n == s {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role '%s'", s)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (r *Role) UnmarshalText(b []byte) error {
+	rv, err := ParseRole(string(b))
+	if err != nil {
+		return err
+	}
+	*r = rv
+	return nil
+}
+
+// A User is someone who can log in to the web server
+type User struct {
+	Name string
+	Role Role
+
+	// The bcrypt hash of the user's password; empty if they can only use tokens
+	Password string `json:",omitempty"`
+
+	Tokens []Token `json:",omitempty"`
+}
+
+// Can tests if this user has at least the specified role. A nil User is
+// anonymous, and only has RoleNone.
+func (u *User) Can(r Role) bool {
+	if u == nil {
+		return r <= RoleNone
+	}
+	return u.Role >= r
+}
+
+// A Token is a secret that grants API access on behalf of a user
+type Token struct {
+	Label   string
+	Created time.Time
+
+	// The SHA-256 hash of the token. Tokens are long random strings, so a
+	// slow hash like bcrypt isn't necessary.
+	Hash string
+}
+
+var (
+	// ErrNoSuchUser is returned when referring to a user that doesn't exist
+	ErrNoSuchUser = errors.New("no such user")
+
+	// ErrInvalidCredentials is returned when a password or token is incorrect
+	ErrInvalidCredentials = errors.New("invalid user name or password")
+)
+
+// SessionDuration is the time a login session stays valid
+var SessionDuration = 30 * 24 * time.Hour
+
+// A Store holds all users from a users file, as well as their login sessions
+type Store struct {
+	filename string
+
+	mu       sync.RWMutex
+	users    []*User
+	sessions map[string]session
+}
+
+type session struct {
+	User    string
+	Expires time.Time
+}
+
+type usersFile struct {
+	Users []*User
+}
+
+// Load reads a users file. A file that doesn't exist yet yields an empty store.
+func Load(filename string) (*Store, error) {
+	rv := &Store{
+		filename: filename,
+		sessions: make(map[string]session),
+	}
+
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return rv, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f usersFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	rv.users = f.Users
+
+	return rv, nil
+}
+
+// Save writes all users back to the users file
+func (s *Store) Save() error {
+	s.mu.RLock()
+	b, err := json.MarshalIndent(usersFile{s.users}, "", "\t")
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// The file contains password hashes, so keep it private
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), ".users-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(b, '\n'))
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+// Users returns all users, ordered by name
+func (s *Store) Users() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rv := make([]User, len(s.users))
+	for i, u := range s.users {
+		rv[i] = *u
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+// Get finds a user by name
+func (s *Store) Get(name string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := s.get(name)
+	if u == nil {
+		return User{}, ErrNoSuchUser
+	}
+	return *u, nil
+}
+
+func (s *Store) get(name string) *User {
+	for _, u := range s.users {
+		if u.Name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+// Add creates a new user
+func (s *Store) Add(name string, role Role) error {
+	if name == "" {
+		return errors.New("empty user name")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.get(name) != nil {
+		return fmt.Errorf("user '%s' already exists", name)
+	}
+	s.users = append(s.users, &User{Name: name, Role: role})
+	return nil
+}
+
+// Remove deletes a user, and ends all their sessions
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, u := range s.users {
+		if u.Name == name {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			s.endSessionsFor(name)
+			return nil
+		}
+	}
+	return ErrNoSuchUser
+}
+
+// SetRole changes a user's role
+func (s *Store) SetRole(name string, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.get(name)
+	if u == nil {
+		return ErrNoSuchUser
+	}
+	u.Role = role
+	return nil
+}
+
+// SetPassword changes a user's password, and ends all their sessions
+func (s *Store) SetPassword(name, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.get(name)
+	if u == nil {
+		return ErrNoSuchUser
+	}
+	u.Password = string(hash)
+	s.endSessionsFor(name)
+	return nil
+}
+
+// NewToken creates a new API token for a user. The token itself is only
+// returned here; the store keeps just its hash.
+func (s *Store) NewToken(name, label string) (string, error) {
+	token, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.get(name)
+	if u == nil {
+		return "", ErrNoSuchUser
+	}
+	for _, t := range u.Tokens {
+		if t.Label == label {
+			return "", fmt.Errorf("user '%s' already has a token labelled '%s'", name, label)
+		}
+	}
+
+	u.Tokens = append(u.Tokens, Token{
+		Label:   label,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Hash:    hashToken(token),
+	})
+	return token, nil
+}
+
+// RevokeToken deletes one of a user's API tokens
+func (s *Store) RevokeToken(name, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.get(name)
+	if u == nil {
+		return ErrNoSuchUser
+	}
+	for i, t := range u.Tokens {
+		if t.Label == label {
+			u.Tokens = append(u.Tokens[:i], u.Tokens[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("user '%s' has no token labelled '%s'", name, label)
+}
+
+// A password hash to check against for users that don't exist
+var (
+	dummyOnce sync.Once
+	dummyHash []byte
+)
+
+// Authenticate checks a user name and password
+func (s *Store) Authenticate(name, password string) (User, error) {
+	s.mu.RLock()
+	u := s.get(name)
+	var rv User
+	if u != nil {
+		rv = *u
+	}
+	s.mu.RUnlock()
+
+	if u == nil || rv.Password == "" {
+		// Spend some time anyway, so the response time doesn't reveal which users exist
+		dummyOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(rv.Password), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return rv, nil
+}
+
+// AuthenticateToken finds the user an API token belongs to
+func (s *Store) AuthenticateToken(token string) (User, error) {
+	hash := hashToken(token)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		for _, t := range u.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+				return *u, nil
+			}
+		}
+	}
+	return User{}, ErrInvalidCredentials
+}
+
+// NewSession starts a login session for a user, and returns its ID
+func (s *Store) NewSession(name string) (string, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.get(name) == nil {
+		return "", ErrNoSuchUser
+	}
+
+	now := time.Now()
+	for k, ses := range s.sessions {
+		if now.After(ses.Expires) {
+			delete(s.sessions, k)
+		}
+	}
+
+	s.sessions[id] = session{
+		User:    name,
+		Expires: now.Add(SessionDuration),
+	}
+	return id, nil
+}
+
+// Session finds the user logged in to a session
+func (s *Store) Session(id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ses, ok := s.sessions[id]
+	if !ok || time.Now().After(ses.Expires) {
+		return User{}, ErrInvalidCredentials
+	}
+	u := s.get(ses.User)
+	if u == nil {
+		return User{}, ErrNoSuchUser
+	}
+	return *u, nil
+}
+
+// EndSession logs out of a session
+func (s *Store) EndSession(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+func (s *Store) endSessionsFor(name string) {
+	for k, ses := range s.sessions {
+		if ses.User == name {
+			delete(s.sessions, k)
+		}
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,74 @@
+package users
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "users.json")
+
+	s, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("alice", RoleDJ); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPassword("alice", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.NewToken("alice", "scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := s.Authenticate("alice", "hunter2")
+	if err != nil || u.Role != RoleDJ {
+		t.Errorf("unexpected login result %+v, %v", u, err)
+	}
+	if _, err := s.Authenticate("alice", "hunter3"); err != ErrInvalidCredentials {
+		t.Errorf("wrong password: expected %v, got %v", ErrInvalidCredentials, err)
+	}
+	if _, err := s.Authenticate("bob", "hunter2"); err != ErrInvalidCredentials {
+		t.Errorf("unknown user: expected %v, got %v", ErrInvalidCredentials, err)
+	}
+
+	if u, err := s.AuthenticateToken(token); err != nil || u.Name != "alice" {
+		t.Errorf("unexpected token result %+v, %v", u, err)
+	}
+	if _, err := s.AuthenticateToken(token + "x"); err == nil {
+		t.Errorf("accepted an invalid token")
+	}
+
+	id, err := s.NewSession("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.Session(id); err != nil || u.Name != "alice" {
+		t.Errorf("unexpected session result %+v, %v", u, err)
+	}
+
+	// Changing the password ends all sessions
+	s.SetPassword("alice", "correct horse battery staple")
+	if _, err := s.Session(id); err == nil {
+		t.Errorf("session survived a password change")
+	}
+
+	if !u.Can(RoleListener) || !u.Can(RoleDJ) || u.Can(RoleAdmin) {
+		t.Errorf("unexpected permissions for role %s", u.Role)
+	}
+
+	var anonymous *User
+	if !anonymous.Can(RoleNone) || anonymous.Can(RoleListener) {
+		t.Errorf("unexpected permissions for anonymous users")
+	}
+}
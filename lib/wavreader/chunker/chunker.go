@@ -27,6 +27,16 @@ type ChunkStream interface {
 	io.Reader
 }
 
+// An AssociatedDataStream is a ChunkStream that keeps track of the associated
+// data at its current read position
+type AssociatedDataStream interface {
+	ChunkStream
+
+	// AssociatedData returns the most recent data stored at or before the
+	// chunk that was last read
+	AssociatedData() interface{}
+}
+
 // A TimedData struct wraps arbitrary data and the time at which it can be read
 type TimedData struct {
 	T    float32
@@ -107,20 +117,25 @@ func (chcont *chunkContainer) newChunkStream(ts timeSource, offset time.Duration
 	now := ts.Now()
 	start := chcont.start
 	next := chcont.start
+	associatedData := chcont.primordialAssociatedData
 	for next != chcont.end {
 		if chcont.chunks[next].embargo.After(now) {
 			break
 		}
 		start = next
+		if chcont.chunks[start].associatedData != nil {
+			associatedData = chcont.chunks[start].associatedData
+		}
 		next = (next + 1) % len(chcont.chunks)
 	}
 
 	return &chunkReader{
-		parent:     chcont,
-		current:    start,
-		seqno:      chcont.chunks[start].seqno,
-		timeSource: ts,
-		offset:     offset,
+		parent:         chcont,
+		current:        start,
+		seqno:          chcont.chunks[start].seqno,
+		timeSource:     ts,
+		offset:         offset,
+		associatedData: associatedData,
 	}, nil
 }
 
@@ -244,6 +259,7 @@ type chunkReader struct {
 	timeSource     timeSource
 	offset         time.Duration
 	associatedData interface{}
+	adSerial       int
 }
 
 func (ch *chunkReader) readBuffer(b []byte) (n int) {
@@ -302,6 +318,7 @@ func (ch *chunkReader) getNext() (bool, error) {
 
 	if cch.associatedData != nil {
 		ch.associatedData = cch.associatedData
+		ch.adSerial++
 	}
 
 	return true, nil
@@ -332,3 +349,46 @@ func (ch *chunkReader) Read(b []byte) (n int, err error) {
 	n += ch.readBuffer(b)
 	return
 }
+
+// AssociatedData returns the most recent data stored at or before the chunk that was last read
+func (ch *chunkReader) AssociatedData() interface{} {
+	return ch.associatedData
+}
+
+// CopyWithAssociatedData copies audio from a ChunkStream into another Chunker,
+// carrying over any associated data it encounters along the way.
+func CopyWithAssociatedData(dst Chunker, src ChunkStream) (int64, error) {
+	cr, ok := src.(*chunkReader)
+	if !ok {
+		return io.Copy(dst, src)
+	}
+
+	var written int64
+	buf := make([]byte, 32*1024)
+
+	// Carry over whatever was playing when this stream started
+	if cr.associatedData != nil {
+		dst.SetAssociatedData(cr.associatedData)
+	}
+	serial := cr.adSerial
+
+	for {
+		n, err := cr.Read(buf)
+		if cr.adSerial != serial {
+			serial = cr.adSerial
+			dst.SetAssociatedData(cr.associatedData)
+		}
+		if n > 0 {
+			nw, ew := dst.Write(buf[:n])
+			written += int64(nw)
+			if ew != nil {
+				return written, ew
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+	}
+}
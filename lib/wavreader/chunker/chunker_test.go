@@ -139,6 +139,10 @@ func TestStartPoint(t *testing.T) {
 			t.Logf("T+%d: next block is %d", i, chm.current)
 			t.Fail()
 		}
+		if j, ok := chm.AssociatedData().(int); !ok || j != i {
+			t.Logf("T+%d: associated data at the start point is %v", i, chm.AssociatedData())
+			t.Fail()
+		}
 	}
 }
 
@@ -171,3 +175,33 @@ func TestAssociatedData(t *testing.T) {
 		}
 	}
 }
+
+func TestSegments(t *testing.T) {
+	now := time.Unix(6000, 0)
+	m := getInputSignal(60, 1, now)
+	clock := &dummyTime{T: now}
+
+	segs := m.segments(clock, 6*time.Second, 992)
+	if len(segs) != 8 {
+		t.Fatalf("expected 8 complete segments; got %d", len(segs))
+	}
+
+	for i, seg := range segs {
+		if seg.Sequence != int64(991+i) {
+			t.Errorf("segment %d has sequence number %d", i, seg.Sequence)
+		}
+		if seg.Duration != 6*time.Second {
+			t.Errorf("segment %d has duration %v", i, seg.Duration)
+		}
+		if !seg.Start.Equal(time.Unix(6*seg.Sequence, 0)) {
+			t.Errorf("segment %d starts at %v", i, seg.Start)
+		}
+	}
+
+	if exp := []byte{12, 13, 14, 15, 16, 17}; string(segs[1].Contents) != string(exp) {
+		t.Errorf("unexpected contents %v; expected %v", segs[1].Contents, exp)
+	}
+	if segs[0].Contents != nil {
+		t.Errorf("contents of segment %d should not be loaded", segs[0].Sequence)
+	}
+}
@@ -19,6 +19,7 @@ func init() {
 }
 
 type MP3ChunkConfig struct {
+	// If set, the encoder is killed once this context is done
 	Context context.Context
 	Audio   wavreader.Config
 }
@@ -26,15 +27,23 @@ type MP3ChunkConfig struct {
 func (m MP3ChunkConfig) NewMP3() (Chunker, error) {
 	r, w := io.Pipe()
 
-	wavin, err := m.Audio.ToMP3(w, m.Audio.PlaybackFormat)
+	audio := m.Audio
+	if m.Context != nil {
+		audio.Context = m.Context
+	}
+
+	wavin, err := audio.ToMP3(w, audio.PlaybackFormat)
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	rv := &mp3Chunker{
 		audioIn: wavin,
+		mp3in:   w,
 		mp3out:  r,
-		embargo: time.Now(),
+		embargo: now,
+		start:   now,
 		chcont: &chunkContainer{
 			chunks: make([]chunk, 4000),
 			start:  0,
@@ -49,9 +58,15 @@ func (m MP3ChunkConfig) NewMP3() (Chunker, error) {
 
 type mp3Chunker struct {
 	audioIn wavreader.Writer
+	mp3in   *io.PipeWriter
 	mp3out  *io.PipeReader
 	embargo time.Time
+	start   time.Time
 	chcont  *chunkContainer
+
+	// Associated data is attached to the first MP3 frame at or after its
+	// position in the input stream
+	pending pendingData
 }
 
 func NewMP3() (Chunker, error) {
@@ -71,14 +86,22 @@ func (m *mp3Chunker) Write(buf []byte) (int, error) {
 	if m.chcont.errorState != nil {
 		return 0, m.chcont.errorState
 	}
-	return m.audioIn.Write(buf)
+	n, err := m.audioIn.Write(buf)
+	m.pending.countInput(n)
+	return n, err
 }
 func (m *mp3Chunker) Close() error {
 	if m.chcont.errorState != nil {
 		return m.chcont.errorState
 	}
 	m.chcont.errorState = io.EOF
-	return m.audioIn.Close()
+	err := m.audioIn.Close()
+
+	// The encoder has exited, so there's no more output to split
+	if m.mp3in != nil {
+		m.mp3in.Close()
+	}
+	return err
 }
 func (m *mp3Chunker) CloseWithError(er error) error {
 	if m.chcont.errorState != nil {
@@ -86,7 +109,11 @@ func (m *mp3Chunker) CloseWithError(er error) error {
 	}
 	m.chcont.errorState = er
 	if m.audioIn != nil {
-		return m.audioIn.CloseWithError(er)
+		err := m.audioIn.CloseWithError(er)
+		if m.mp3in != nil {
+			m.mp3in.CloseWithError(er)
+		}
+		return err
 	} else {
 		return er
 	}
@@ -100,12 +127,20 @@ func (m *mp3Chunker) NewStreamWithOffset(offset time.Duration) (ChunkStream, err
 	return m.chcont.NewStreamWithOffset(offset)
 }
 
+func (m *mp3Chunker) Segments(target time.Duration) []Segment {
+	return m.chcont.Segments(target)
+}
+
+func (m *mp3Chunker) Segment(target time.Duration, sequence int64) (Segment, error) {
+	return m.chcont.Segment(target, sequence)
+}
+
 func (m *mp3Chunker) BufferStatus() BufferStatus {
 	return m.chcont.BufferStatus()
 }
 
 func (m *mp3Chunker) SetAssociatedData(data interface{}) {
-	m.chcont.SetAssociatedData(data)
+	m.pending.add(m.audioIn, data)
 }
 
 func (m *mp3Chunker) GetAssociatedData() (interface{}, error) {
@@ -143,6 +178,7 @@ func (m *mp3Chunker) splitChunks() {
 		for i >= 0 {
 			hdr = nexthdr
 			chunk := unread[:firstOffset+i]
+			m.pending.attach(m.chcont, m.embargo.Sub(m.start))
 			m.chcont.AddChunk(chunk, m.embargo)
 
 			m.embargo = m.embargo.Add(hdr.Duration())
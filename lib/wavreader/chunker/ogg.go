@@ -0,0 +1,313 @@
+package chunker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
+)
+
+const oggReadAhead time.Duration = 30 * time.Second
+
+// Opus granule positions always count samples at 48kHz, regardless of the input rate
+const opusGranuleRate = 48000
+
+type OggFLACChunkConfig struct {
+	// If set, the encoder is killed once this context is done
+	Context context.Context
+	Audio   wavreader.Config
+}
+
+// NewOggFLAC creates a Chunker that encodes its input into a lossless Ogg-FLAC stream
+func (c OggFLACChunkConfig) NewOggFLAC() (Chunker, error) {
+	r, w := io.Pipe()
+
+	audio := c.Audio
+	if c.Context != nil {
+		audio.Context = c.Context
+	}
+
+	format := audio.PlaybackFormat
+	wavin, err := audio.ToOggFLAC(w, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return newOggChunker(wavin, w, r, int64(format.Rate)), nil
+}
+
+type OpusChunkConfig struct {
+	// If set, the encoder is killed once this context is done
+	Context context.Context
+	Audio   wavreader.Config
+}
+
+// NewOpus creates a Chunker that encodes its input into an Ogg/Opus stream
+func (c OpusChunkConfig) NewOpus() (Chunker, error) {
+	r, w := io.Pipe()
+
+	audio := c.Audio
+	if c.Context != nil {
+		audio.Context = c.Context
+	}
+
+	wavin, err := audio.ToOpus(w, audio.PlaybackFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return newOggChunker(wavin, w, r, opusGranuleRate), nil
+}
+
+func newOggChunker(wavin wavreader.Writer, oggin *io.PipeWriter, oggout *io.PipeReader, granuleRate int64) *oggChunker {
+	now := time.Now()
+	rv := &oggChunker{
+		audioIn:     wavin,
+		oggin:       oggin,
+		oggout:      oggout,
+		granuleRate: granuleRate,
+		embargo:     now,
+		start:       now,
+		chcont: &chunkContainer{
+			chunks: make([]chunk, 4000),
+			start:  0,
+			end:    0,
+		},
+		headersReady: make(chan struct{}),
+	}
+
+	go rv.splitPages()
+
+	return rv
+}
+
+// An oggChunker splits the output of an Ogg encoder into chunks of one page
+// each. Every Ogg stream starts with a number of header pages that a decoder
+// needs before it can make sense of the rest; these are kept aside and
+// prepended to every new stream.
+type oggChunker struct {
+	audioIn     wavreader.Writer
+	oggin       *io.PipeWriter
+	oggout      *io.PipeReader
+	granuleRate int64
+	embargo     time.Time
+	start       time.Time
+	chcont      *chunkContainer
+
+	headers      []byte
+	headersReady chan struct{}
+	headersOnce  sync.Once
+
+	// Associated data is attached to the first Ogg page at or after its
+	// position in the input stream
+	pending pendingData
+}
+
+func (o *oggChunker) Init(fixedSize int) error {
+	if o.chcont.errorState != nil {
+		return o.chcont.errorState
+	}
+	return o.audioIn.Init(fixedSize)
+}
+func (o *oggChunker) Format() wavreader.StreamFormat {
+	return o.audioIn.Format()
+}
+func (o *oggChunker) Write(buf []byte) (int, error) {
+	if o.chcont.errorState != nil {
+		return 0, o.chcont.errorState
+	}
+	n, err := o.audioIn.Write(buf)
+	o.pending.countInput(n)
+	return n, err
+}
+func (o *oggChunker) Close() error {
+	if o.chcont.errorState != nil {
+		return o.chcont.errorState
+	}
+	o.chcont.errorState = io.EOF
+	err := o.audioIn.Close()
+
+	// The encoder has exited, so there's no more output to split
+	if o.oggin != nil {
+		o.oggin.Close()
+	}
+	return err
+}
+func (o *oggChunker) CloseWithError(er error) error {
+	o.headersOnce.Do(func() { close(o.headersReady) })
+	if o.chcont.errorState != nil {
+		return o.chcont.errorState
+	}
+	o.chcont.errorState = er
+	if o.audioIn != nil {
+		err := o.audioIn.CloseWithError(er)
+		if o.oggin != nil {
+			o.oggin.CloseWithError(er)
+		}
+		return err
+	} else {
+		return er
+	}
+}
+
+func (o *oggChunker) NewStream() (ChunkStream, error) {
+	cs, err := o.chcont.NewStream()
+	if err != nil {
+		return nil, err
+	}
+	return &oggStream{parent: o, pages: cs}, nil
+}
+
+func (o *oggChunker) NewStreamWithOffset(offset time.Duration) (ChunkStream, error) {
+	cs, err := o.chcont.NewStreamWithOffset(offset)
+	if err != nil {
+		return nil, err
+	}
+	return &oggStream{parent: o, pages: cs}, nil
+}
+
+func (o *oggChunker) BufferStatus() BufferStatus {
+	return o.chcont.BufferStatus()
+}
+
+func (o *oggChunker) SetAssociatedData(data interface{}) {
+	o.pending.add(o.audioIn, data)
+}
+
+func (o *oggChunker) GetAssociatedData() (interface{}, error) {
+	return o.chcont.GetAssociatedData()
+}
+
+func (o *oggChunker) splitPages() {
+	rd := bufio.NewReaderSize(o.oggout, 1<<16)
+	var lastGranule int64
+
+	for {
+		page, err := readOggPage(rd)
+		if err != nil {
+			if err == io.EOF {
+				o.headersOnce.Do(func() { close(o.headersReady) })
+				o.Close()
+			} else {
+				o.CloseWithError(err)
+			}
+			return
+		}
+
+		granule := page.GranulePosition()
+
+		// Header pages never contain audio, so they have granule position 0
+		// (or -1, if a header packet spans multiple pages)
+		if !o.headersDone() {
+			if granule <= 0 {
+				o.headers = append(o.headers, page...)
+				continue
+			}
+			o.headersOnce.Do(func() { close(o.headersReady) })
+		}
+
+		o.pending.attach(o.chcont, o.embargo.Sub(o.start))
+		o.chcont.AddChunk(page, o.embargo)
+
+		// Pages without a granule position don't finish any packet
+		if granule >= 0 {
+			o.embargo = o.embargo.Add(time.Duration(granule-lastGranule) * time.Second / time.Duration(o.granuleRate))
+			lastGranule = granule
+		}
+		for time.Now().Add(oggReadAhead).Before(o.embargo) {
+			time.Sleep(1 * time.Millisecond)
+		}
+	}
+}
+
+func (o *oggChunker) headersDone() bool {
+	select {
+	case <-o.headersReady:
+		return true
+	default:
+		return false
+	}
+}
+
+// An oggPage contains one complete Ogg page, including its header
+type oggPage []byte
+
+func (p oggPage) GranulePosition() int64 {
+	return int64(binary.LittleEndian.Uint64(p[6:14]))
+}
+
+// readOggPage reads the next Ogg page from the input stream
+func readOggPage(rd *bufio.Reader) (oggPage, error) {
+	hdr := make([]byte, 27)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[0:4], []byte("OggS")) {
+		return nil, fmt.Errorf("ogg capture pattern not found")
+	}
+
+	nseg := int(hdr[26])
+	segments := make([]byte, nseg)
+	if _, err := io.ReadFull(rd, segments); err != nil {
+		return nil, unexpected(err)
+	}
+
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+
+	rv := make(oggPage, 27+nseg+size)
+	copy(rv, hdr)
+	copy(rv[27:], segments)
+	if _, err := io.ReadFull(rd, rv[27+nseg:]); err != nil {
+		return nil, unexpected(err)
+	}
+
+	return rv, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// An oggStream sends a chunker's header pages, followed by the audio pages
+type oggStream struct {
+	parent      *oggChunker
+	sentHeaders bool
+	headers     []byte
+	pages       ChunkStream
+}
+
+func (s *oggStream) Read(b []byte) (int, error) {
+	if !s.sentHeaders {
+		<-s.parent.headersReady
+		s.headers = s.parent.headers
+		s.sentHeaders = true
+	}
+
+	if len(s.headers) > 0 {
+		n := copy(b, s.headers)
+		s.headers = s.headers[n:]
+		return n, nil
+	}
+
+	return s.pages.Read(b)
+}
+
+// AssociatedData returns the most recent data stored at or before the page that was last read
+func (s *oggStream) AssociatedData() interface{} {
+	if ads, ok := s.pages.(AssociatedDataStream); ok {
+		return ads.AssociatedData()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package chunker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
+)
+
+func oggTestPage(granule int64, body string) []byte {
+	rv := make([]byte, 28, 28+len(body))
+	copy(rv, "OggS")
+	binary.LittleEndian.PutUint64(rv[6:], uint64(granule))
+	rv[26] = 1
+	rv[27] = byte(len(body))
+	return append(rv, body...)
+}
+
+func TestOggSplitPages(t *testing.T) {
+	var input bytes.Buffer
+	input.Write(oggTestPage(0, "head"))
+	input.Write(oggTestPage(0, "tags"))
+	input.Write(oggTestPage(44100, "one"))
+	input.Write(oggTestPage(-1, "half"))
+	input.Write(oggTestPage(88200, "two"))
+
+	r, w := io.Pipe()
+	go func() {
+		w.Write(input.Bytes())
+		w.Close()
+	}()
+
+	now := time.Now()
+	o := &oggChunker{
+		audioIn:     wavreader.NewWriter(ioutil.Discard, wavreader.CD),
+		oggout:      r,
+		granuleRate: 44100,
+		embargo:     now,
+		start:       now,
+		chcont: &chunkContainer{
+			chunks: make([]chunk, 10),
+		},
+		headersReady: make(chan struct{}),
+	}
+	o.splitPages()
+
+	expHeaders := append(oggTestPage(0, "head"), oggTestPage(0, "tags")...)
+	if !bytes.Equal(o.headers, expHeaders) {
+		t.Errorf("unexpected headers %q", o.headers)
+	}
+
+	expChunks := []struct {
+		Body   string
+		Offset time.Duration
+	}{
+		{"one", 0},
+		{"half", 1 * time.Second},
+		{"two", 1 * time.Second},
+	}
+	if o.chcont.end != len(expChunks) {
+		t.Fatalf("expected %d chunks; got %d", len(expChunks), o.chcont.end)
+	}
+	for i, exp := range expChunks {
+		ch := o.chcont.chunks[i]
+		if body := string(ch.contents[28:]); body != exp.Body {
+			t.Errorf("chunk %d contains '%s'; expected '%s'", i, body, exp.Body)
+		}
+		if offset := ch.embargo.Sub(now); offset != exp.Offset {
+			t.Errorf("chunk %d has offset %v; expected %v", i, offset, exp.Offset)
+		}
+	}
+	if o.chcont.errorState != io.EOF {
+		t.Errorf("unexpected error state %v", o.chcont.errorState)
+	}
+}
@@ -0,0 +1,57 @@
+package chunker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
+)
+
+// pendingData keeps track of associated data for encoding chunkers. Data is
+// stored by its position in the input stream, so it can be attached to the
+// encoded output once the encoder catches up.
+type pendingData struct {
+	mu      sync.Mutex
+	bytesIn int64
+	queue   []timedPendingData
+}
+
+type timedPendingData struct {
+	Offset time.Duration
+	Data   interface{}
+}
+
+// countInput registers n more bytes of input audio
+func (p *pendingData) countInput(n int) {
+	p.mu.Lock()
+	p.bytesIn += int64(n)
+	p.mu.Unlock()
+}
+
+// add stores associated data at the current position in the input stream
+func (p *pendingData) add(audioIn wavreader.Formatter, data interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var offset time.Duration
+	if audioIn != nil {
+		f := audioIn.Format()
+		if bps := int64(f.BytesPerSample() * f.Rate); bps > 0 {
+			offset = time.Duration(p.bytesIn) * time.Second / time.Duration(bps)
+		}
+	}
+
+	p.queue = append(p.queue, timedPendingData{offset, data})
+}
+
+// attach moves any associated data that has become audible by the given
+// position in the output stream into the chunk container
+func (p *pendingData) attach(chcont *chunkContainer, position time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) > 0 && p.queue[0].Offset <= position {
+		chcont.SetAssociatedData(p.queue[0].Data)
+		p.queue = p.queue[1:]
+	}
+}
@@ -0,0 +1,98 @@
+package chunker
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Segment is a run of consecutive chunks, as used by segmented streaming
+// protocols such as HLS.
+type Segment struct {
+	// Sequence numbers are derived from the wall clock time, so they remain
+	// stable for the lifetime of the stream.
+	Sequence int64
+
+	// The embargo time of the first chunk in this segment
+	Start time.Time
+
+	// The playing time of this segment
+	Duration time.Duration
+
+	// The segment contents. This is only populated by Segment(), not by Segments().
+	Contents []byte
+}
+
+// A Segmenter divides its buffer into segments of approximately equal length
+type Segmenter interface {
+	// Segments lists all complete segments available for reading
+	Segments(target time.Duration) []Segment
+
+	// Segment retrieves one segment, including its contents
+	Segment(target time.Duration, sequence int64) (Segment, error)
+}
+
+// ErrSegmentUnavailable is returned when a requested segment is not (or no longer) in the buffer
+var ErrSegmentUnavailable error = fmt.Errorf("segment unavailable")
+
+func (chcont *chunkContainer) Segments(target time.Duration) []Segment {
+	return chcont.segments(defaultTimeSource{}, target, -1)
+}
+
+func (chcont *chunkContainer) Segment(target time.Duration, sequence int64) (Segment, error) {
+	for _, seg := range chcont.segments(defaultTimeSource{}, target, sequence) {
+		if seg.Sequence == sequence {
+			return seg, nil
+		}
+	}
+	return Segment{}, ErrSegmentUnavailable
+}
+
+// segments groups all chunks available as of now into segments. Only segments
+// followed by another segment are complete; the first segment in the buffer
+// is also discarded, as its head may already have been overwritten.
+func (chcont *chunkContainer) segments(ts timeSource, target time.Duration, withContents int64) []Segment {
+	if target <= 0 {
+		return nil
+	}
+
+	chcont.mu.RLock()
+	defer chcont.mu.RUnlock()
+
+	now := ts.Now()
+	l := len(chcont.chunks)
+	if l == 0 {
+		return nil
+	}
+
+	var rv []Segment
+	var current *Segment
+	first := true
+
+	for i := chcont.start; i != chcont.end; i = (i + 1) % l {
+		ch := chcont.chunks[i]
+		if ch.embargo.After(now) {
+			break
+		}
+
+		seq := ch.embargo.UnixNano() / int64(target)
+		if current == nil || current.Sequence != seq {
+			if current != nil {
+				current.Duration = ch.embargo.Sub(current.Start)
+				if !first {
+					rv = append(rv, *current)
+				}
+				first = false
+			}
+			current = &Segment{
+				Sequence: seq,
+				Start:    ch.embargo,
+			}
+		}
+
+		if seq == withContents {
+			current.Contents = append(current.Contents, ch.contents...)
+		}
+	}
+
+	return rv
+}
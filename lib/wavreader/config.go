@@ -1,6 +1,10 @@
 package wavreader
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
 
 // A StreamFormat wraps all options that define a PCM audio stream format
 type StreamFormat struct {
@@ -71,15 +75,35 @@ type Config struct {
 	// Path to `flac` binary
 	FlacPath string
 
+	// FLAC encoder settings: compression level (value 0-8)
+	FLACCompression int
+
+	// Path to `opusenc` binary
+	OpusencPath string
+
+	// Opus encoder settings: target bitrate in kbit/s
+	OpusBitrate int
+
 	// Path to `mplayer` binary
 	MPlayerPath string
 
 	// Stream format for audio output
 	PlaybackFormat StreamFormat
+
+	// If set, any external processes are killed once this context is done
+	Context context.Context
 }
 
 var defaultConfig Config
 
+// command prepares an external process, bound to the context if there is one
+func (c Config) command(name string, arg ...string) *exec.Cmd {
+	if c.Context != nil {
+		return exec.CommandContext(c.Context, name, arg...)
+	}
+	return exec.Command(name, arg...)
+}
+
 func (c Config) lame() string {
 	if c.LamePath != "" {
 		return c.LamePath
@@ -94,6 +118,27 @@ func (c Config) flac() string {
 	return "flac"
 }
 
+func (c Config) flacCompression() int {
+	if c.FLACCompression >= 0 && c.FLACCompression <= 8 {
+		return c.FLACCompression
+	}
+	return 5
+}
+
+func (c Config) opusenc() string {
+	if c.OpusencPath != "" {
+		return c.OpusencPath
+	}
+	return "opusenc"
+}
+
+func (c Config) opusBitrate() int {
+	if c.OpusBitrate > 0 {
+		return c.OpusBitrate
+	}
+	return 64
+}
+
 func (c Config) mplayer() string {
 	if c.MPlayerPath != "" {
 		return c.MPlayerPath
@@ -21,7 +21,7 @@ func (c Config) newFlacReader(flacIn io.ReadCloser) (*flacReader, error) {
 		flacIn:          flacIn,
 		finishedReading: make(chan struct{}),
 	}
-	fr.cmd = exec.Command(c.flac(), "-s", "-c", "-d", "-")
+	fr.cmd = c.command(c.flac(), "-s", "-c", "-d", "-")
 
 	fr.output, err = fr.cmd.StdoutPipe()
 	if err != nil {
@@ -32,7 +32,7 @@ func (c Config) newFlacReader(flacIn io.ReadCloser) (*flacReader, error) {
 		return nil, err
 	}
 
-	err = fr.cmd.Start()
+	err = startProcess(fr.cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +44,7 @@ func (c Config) newFlacReader(flacIn io.ReadCloser) (*flacReader, error) {
 		fr.flacIn.Close()
 		for range fr.finishedReading {
 		}
-		fr.cmd.Wait()
+		waitProcess(fr.cmd)
 	}()
 
 	return fr, nil
@@ -81,7 +81,7 @@ func (fr *flacReader) Close() error {
 	fr.flacIn.Close()
 	fr.output.Close()
 
-	return fr.cmd.Wait()
+	return waitProcess(fr.cmd)
 }
 
 // FromFLAC creates a WAV Reader from a handle to a FLAC stream
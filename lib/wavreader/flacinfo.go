@@ -0,0 +1,169 @@
+package wavreader
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// FLACInfo contains the stream properties stored in a FLAC file's STREAMINFO block
+type FLACInfo struct {
+	Format StreamFormat
+
+	// TotalSamples is the number of samples per channel in the stream, or 0 if unknown
+	TotalSamples int64
+
+	// MD5 is the signature of the unencoded audio data, or all zeroes if unknown
+	MD5 [16]byte
+}
+
+// Duration returns the playing time of the FLAC stream
+func (f FLACInfo) Duration() time.Duration {
+	if f.Format.Rate == 0 {
+		return 0
+	}
+	return time.Duration(f.TotalSamples) * time.Second / time.Duration(f.Format.Rate)
+}
+
+// Size returns the size (in bytes) of the decoded PCM stream
+func (f FLACInfo) Size() int {
+	return int(f.TotalSamples) * f.Format.BytesPerSample()
+}
+
+// ReadFLACInfo parses the STREAMINFO metadata block at the start of a FLAC stream
+func ReadFLACInfo(r io.Reader) (FLACInfo, error) {
+	var rv FLACInfo
+
+	if err := readFLACMarker(r); err != nil {
+		return rv, err
+	}
+
+	// The first metadata block is mandated to be STREAMINFO
+	hdr := make([]byte, 4+34)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return rv, err
+	}
+	if hdr[0]&0x7f != 0 {
+		return rv, fmt.Errorf("first metadata block is not STREAMINFO")
+	}
+	if blockLength := int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3]); blockLength != 34 {
+		return rv, fmt.Errorf("unexpected STREAMINFO length %d", blockLength)
+	}
+
+	si := hdr[4:]
+
+	// Bits 80-99: sample rate; 100-102: channels-1; 103-107: bits per sample-1; 108-143: total samples
+	rv.Format.Format = 1
+	rv.Format.Rate = int(si[10])<<12 | int(si[11])<<4 | int(si[12])>>4
+	rv.Format.Channels = int(si[12]>>1&0x07) + 1
+	rv.Format.Bits = int(si[12]&0x01)<<4 | int(si[13]>>4) + 1
+	rv.TotalSamples = int64(si[13]&0x0f)<<32 | int64(si[14])<<24 | int64(si[15])<<16 | int64(si[16])<<8 | int64(si[17])
+	copy(rv.MD5[:], si[18:34])
+
+	if rv.Format.Rate == 0 {
+		return rv, fmt.Errorf("invalid sample rate")
+	}
+
+	return rv, nil
+}
+
+// readFLACMarker reads up to and including the "fLaC" marker at the start of a FLAC stream
+func readFLACMarker(r io.Reader) error {
+	b := make([]byte, 10)
+	if _, err := io.ReadFull(r, b[:4]); err != nil {
+		return err
+	}
+
+	// Skip over any ID3v2 tag some taggers prepend to the stream
+	if string(b[0:3]) == "ID3" {
+		if _, err := io.ReadFull(r, b[4:10]); err != nil {
+			return err
+		}
+		tagSize := int64(b[6]&0x7f)<<21 | int64(b[7]&0x7f)<<14 | int64(b[8]&0x7f)<<7 | int64(b[9]&0x7f)
+		if _, err := io.CopyN(io.Discard, r, tagSize); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, b[:4]); err != nil {
+			return err
+		}
+	}
+
+	if string(b[0:4]) != "fLaC" {
+		return errParse
+	}
+	return nil
+}
+
+// ReadFLACTags parses the VORBIS_COMMENT metadata block in a FLAC stream.
+// The tag names are converted to upper case, and each tag may occur more than once.
+func ReadFLACTags(r io.Reader) (map[string][]string, error) {
+	rv := make(map[string][]string)
+
+	if err := readFLACMarker(r); err != nil {
+		return rv, err
+	}
+
+	hdr := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return rv, err
+		}
+		last := hdr[0]&0x80 != 0
+		blockType := hdr[0] & 0x7f
+		blockLength := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+
+		if blockType == 4 {
+			block := make([]byte, blockLength)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return rv, err
+			}
+			return rv, parseVorbisComment(block, rv)
+		}
+
+		if last {
+			return rv, nil
+		}
+		if _, err := io.CopyN(io.Discard, r, blockLength); err != nil {
+			return rv, err
+		}
+	}
+}
+
+func parseVorbisComment(b []byte, tags map[string][]string) error {
+	// Vorbis comments are length-prefixed strings, with little-endian lengths
+	next := func() (string, error) {
+		if len(b) < 4 {
+			return "", errParse
+		}
+		l := int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+		if l < 0 || l > len(b)-4 {
+			return "", errParse
+		}
+		rv := string(b[4 : 4+l])
+		b = b[4+l:]
+		return rv, nil
+	}
+
+	// Skip the vendor string
+	if _, err := next(); err != nil {
+		return err
+	}
+	if len(b) < 4 {
+		return errParse
+	}
+	n := int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+	b = b[4:]
+
+	for i := 0; i < n; i++ {
+		c, err := next()
+		if err != nil {
+			return err
+		}
+		if eq := strings.IndexByte(c, '='); eq > 0 {
+			name := strings.ToUpper(c[:eq])
+			tags[name] = append(tags[name], c[eq+1:])
+		}
+	}
+	return nil
+}
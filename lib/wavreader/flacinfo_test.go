@@ -0,0 +1,73 @@
+package wavreader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFLACInfo(t *testing.T) {
+	// 44.1kHz stereo 16 bit, 441000 samples
+	streamInfo := "\x10\x00\x10\x00\x00\x00\x0e\x00\x34\x12\x0a\xc4\x42\xf0\x00\x06\xba\xa8" + string(make([]byte, 16))
+
+	for _, prefix := range []string{"", "ID3\x04\x00\x00\x00\x00\x00\x05hello"} {
+		fi, err := ReadFLACInfo(bytes.NewBufferString(prefix + "fLaC\x00\x00\x00\x22" + streamInfo))
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+
+		if fi.Format != CD {
+			t.Errorf("expected format %s, got %s", CD, fi.Format)
+		}
+		if fi.TotalSamples != 441000 {
+			t.Errorf("expected %d samples, got %d", 441000, fi.TotalSamples)
+		}
+		if fi.Duration() != 10*time.Second {
+			t.Errorf("expected a duration of %s, got %s", 10*time.Second, fi.Duration())
+		}
+		if fi.Size() != 1764000 {
+			t.Errorf("expected a size of %d, got %d", 1764000, fi.Size())
+		}
+	}
+
+	_, err := ReadFLACInfo(bytes.NewBufferString("RIFF\x00\x00\x00\x22" + streamInfo))
+	if err == nil {
+		t.Errorf("a WAV file should not parse as FLAC")
+	}
+}
+
+func TestFLACTags(t *testing.T) {
+	le := func(n int) string {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, uint32(n))
+		return string(b)
+	}
+	comment := le(6) + "vendor" + le(3)
+	for _, c := range []string{"TITLE=Symphony No. 5: I. Allegro con brio", "performer=Wiener Philharmoniker", "Performer=Carlos Kleiber"} {
+		comment += le(len(c)) + c
+	}
+
+	streamInfo := "\x00\x00\x00\x22" + string(make([]byte, 34))
+	padding := "\x01\x00\x00\x04" + string(make([]byte, 4))
+	block := "\x84" + string([]byte{0, byte(len(comment) >> 8), byte(len(comment))}) + comment
+
+	tags, err := ReadFLACTags(bytes.NewBufferString("fLaC" + streamInfo + padding + block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"TITLE":     {"Symphony No. 5: I. Allegro con brio"},
+		"PERFORMER": {"Wiener Philharmoniker", "Carlos Kleiber"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+
+	tags, err = ReadFLACTags(bytes.NewBufferString("fLaC" + "\x80\x00\x00\x22" + string(make([]byte, 34))))
+	if err != nil || len(tags) != 0 {
+		t.Errorf("expected no tags; got %v (%v)", tags, err)
+	}
+}
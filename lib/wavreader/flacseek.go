@@ -0,0 +1,416 @@
+package wavreader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FromSeekableFLAC creates a Seeker from a FLAC stream that supports random access
+func FromSeekableFLAC(in RandomAccessSource) (Seeker, error) {
+	return defaultConfig.FromSeekableFLAC(in)
+}
+
+// FromSeekableFLAC creates a Seeker from a FLAC stream that supports random
+// access. Seeking uses the stream's SEEKTABLE if it has one, and scans frame
+// headers from the nearest seek point onwards to find the exact frame. The
+// decoder is then restarted at that frame, and any samples before the target
+// are discarded.
+func (c Config) FromSeekableFLAC(in RandomAccessSource) (Seeker, error) {
+	rv := &flacSeeker{
+		conf: c,
+		src:  in,
+	}
+
+	err := rv.readMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+type flacSeeker struct {
+	conf Config
+	src  RandomAccessSource
+
+	info       FLACInfo
+	streamInfo []byte
+	seekTable  []flacSeekPoint
+	firstFrame int64
+
+	// The block size of fixed-blocksize streams
+	blockSize int64
+
+	current Reader
+	skip    int64
+	err     error
+}
+
+type flacSeekPoint struct {
+	Sample int64
+	Offset int64
+}
+
+// readMetadata parses all metadata blocks preceding the first audio frame
+func (f *flacSeeker) readMetadata() error {
+	var offset int64
+	b := make([]byte, 10)
+
+	if _, err := f.src.ReadAt(b, 0); err != nil {
+		return err
+	}
+
+	// Skip over any ID3v2 tag some taggers prepend to the stream
+	if string(b[0:3]) == "ID3" {
+		offset = 10 + (int64(b[6]&0x7f)<<21 | int64(b[7]&0x7f)<<14 | int64(b[8]&0x7f)<<7 | int64(b[9]&0x7f))
+		if _, err := f.src.ReadAt(b[:4], offset); err != nil {
+			return err
+		}
+	}
+	if string(b[0:4]) != "fLaC" {
+		return errParse
+	}
+	offset += 4
+
+	last := false
+	for !last {
+		hdr := make([]byte, 4)
+		if _, err := f.src.ReadAt(hdr, offset); err != nil {
+			return err
+		}
+		last = hdr[0]&0x80 != 0
+		blockType := hdr[0] & 0x7f
+		blockLength := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		offset += 4
+
+		if blockType == 0 || blockType == 3 {
+			block := make([]byte, blockLength)
+			if _, err := f.src.ReadAt(block, offset); err != nil {
+				return err
+			}
+
+			if blockType == 0 {
+				info, err := ReadFLACInfo(io.MultiReader(bytes.NewReader([]byte("fLaC")), bytes.NewReader(hdr), bytes.NewReader(block)))
+				if err != nil {
+					return err
+				}
+				f.info = info
+				f.streamInfo = block
+				f.blockSize = int64(binary.BigEndian.Uint16(block[2:4]))
+			} else {
+				f.seekTable = parseSeekTable(block)
+			}
+		}
+
+		offset += blockLength
+	}
+
+	if f.streamInfo == nil {
+		return fmt.Errorf("no STREAMINFO block found")
+	}
+
+	f.firstFrame = offset
+	return nil
+}
+
+func parseSeekTable(block []byte) []flacSeekPoint {
+	var rv []flacSeekPoint
+	for len(block) >= 18 {
+		sample := binary.BigEndian.Uint64(block[0:8])
+		offset := binary.BigEndian.Uint64(block[8:16])
+		block = block[18:]
+
+		// Skip placeholder points
+		if sample == 0xffffffffffffffff {
+			continue
+		}
+		rv = append(rv, flacSeekPoint{int64(sample), int64(offset)})
+	}
+	return rv
+}
+
+// Init starts decoding at the start of the stream
+func (f *flacSeeker) Init() {
+	if f.current == nil && f.err == nil {
+		f.err = f.SeekSample(0)
+	}
+}
+
+func (f *flacSeeker) Format() StreamFormat {
+	return f.info.Format
+}
+
+func (f *flacSeeker) Size() int {
+	return f.info.Size()
+}
+
+func (f *flacSeeker) SetSize(int) {
+}
+
+func (f *flacSeeker) SeekSample(n int64) error {
+	if n < 0 || (f.info.TotalSamples > 0 && n > f.info.TotalSamples) {
+		return fmt.Errorf("sample %d out of range", n)
+	}
+
+	f.closeCurrent()
+
+	if f.info.TotalSamples > 0 && n == f.info.TotalSamples {
+		f.err = io.EOF
+		return nil
+	}
+
+	var input io.Reader
+	var frameSample int64
+	if n == 0 {
+		input = io.NewSectionReader(f.src, 0, f.src.Size())
+	} else {
+		offset, sample, err := f.locate(n)
+		if err != nil {
+			return err
+		}
+		frameSample = sample
+
+		input = io.MultiReader(
+			bytes.NewReader(f.headerFrom(frameSample)),
+			io.NewSectionReader(f.src, offset, f.src.Size()-offset),
+		)
+	}
+
+	dec, err := f.conf.FromFLAC(io.NopCloser(input))
+	if err != nil {
+		return err
+	}
+	dec.Init()
+
+	f.current = dec
+	f.skip = (n - frameSample) * int64(f.info.Format.BytesPerSample())
+	f.err = nil
+	return nil
+}
+
+// headerFrom creates a minimal FLAC header for a stream that starts at the
+// given sample. The MD5 signature is cleared, so the decoder won't check it.
+func (f *flacSeeker) headerFrom(sample int64) []byte {
+	si := make([]byte, len(f.streamInfo))
+	copy(si, f.streamInfo)
+
+	if f.info.TotalSamples > 0 {
+		remaining := f.info.TotalSamples - sample
+		si[13] = si[13]&0xf0 | byte(remaining>>32)&0x0f
+		binary.BigEndian.PutUint32(si[14:18], uint32(remaining))
+	}
+	for i := 18; i < 34; i++ {
+		si[i] = 0
+	}
+
+	rv := []byte("fLaC")
+	rv = append(rv, 0x80, 0, 0, byte(len(si)))
+	return append(rv, si...)
+}
+
+// locate finds the offset and first sample of the frame containing sample n
+func (f *flacSeeker) locate(n int64) (int64, int64, error) {
+	offset, sample := f.firstFrame, int64(0)
+	for _, sp := range f.seekTable {
+		if sp.Sample <= n && sp.Sample >= sample {
+			offset, sample = f.firstFrame+sp.Offset, sp.Sample
+		}
+	}
+
+	hdr, err := f.frameAt(offset)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hdr.Sample != sample {
+		return 0, 0, fmt.Errorf("seek point mismatch: expected sample %d, found %d", sample, hdr.Sample)
+	}
+
+	const window = 1 << 16
+	buf := make([]byte, window)
+
+	for n >= hdr.Sample+hdr.BlockSize {
+		next := hdr.Sample + hdr.BlockSize
+		found := false
+
+		// Scan for the next frame header. Frames have no length field, so
+		// this looks for a sync code followed by a valid header.
+		pos := offset + 2
+		for !found {
+			m, err := f.src.ReadAt(buf, pos)
+			if m < 2 {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, 0, err
+			}
+
+			for i := 0; i+1 < m; i++ {
+				if buf[i] != 0xff || buf[i+1]&0xfe != 0xf8 {
+					continue
+				}
+				h, err := f.frameAt(pos + int64(i))
+				if err == nil && h.Sample == next {
+					offset, hdr = pos+int64(i), h
+					found = true
+					break
+				}
+			}
+
+			pos += int64(m) - 1
+		}
+	}
+
+	return offset, hdr.Sample, nil
+}
+
+type flacFrameHeader struct {
+	Sample    int64
+	BlockSize int64
+}
+
+// frameAt parses the frame header at the specified offset
+func (f *flacSeeker) frameAt(offset int64) (flacFrameHeader, error) {
+	var rv flacFrameHeader
+
+	b := make([]byte, 16)
+	m, err := f.src.ReadAt(b, offset)
+	if m < 6 {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return rv, err
+	}
+	b = b[:m]
+
+	if b[0] != 0xff || b[1]&0xfe != 0xf8 {
+		return rv, errParse
+	}
+	variable := b[1]&0x01 != 0
+	bsCode := b[2] >> 4
+	srCode := b[2] & 0x0f
+	if bsCode == 0 || srCode == 0x0f || b[3]>>4 > 10 || b[3]>>1&0x07 == 3 || b[3]&0x01 != 0 {
+		return rv, errParse
+	}
+
+	// The frame or sample number, in UTF-8-like coding
+	num, l := decodeFLACNumber(b[4:])
+	if l == 0 {
+		return rv, errParse
+	}
+	i := 4 + l
+
+	switch {
+	case bsCode == 1:
+		rv.BlockSize = 192
+	case bsCode <= 5:
+		rv.BlockSize = 576 << (bsCode - 2)
+	case bsCode == 6:
+		if i >= len(b) {
+			return rv, errParse
+		}
+		rv.BlockSize = int64(b[i]) + 1
+		i++
+	case bsCode == 7:
+		if i+1 >= len(b) {
+			return rv, errParse
+		}
+		rv.BlockSize = int64(binary.BigEndian.Uint16(b[i:])) + 1
+		i += 2
+	default:
+		rv.BlockSize = 256 << (bsCode - 8)
+	}
+
+	if srCode == 12 {
+		i++
+	} else if srCode == 13 || srCode == 14 {
+		i += 2
+	}
+	if i >= len(b) || crc8(b[:i]) != b[i] {
+		return rv, errParse
+	}
+
+	if variable {
+		rv.Sample = num
+	} else {
+		rv.Sample = num * f.blockSize
+	}
+
+	return rv, nil
+}
+
+// decodeFLACNumber decodes a number in FLAC's extended UTF-8 coding. It
+// returns the number of bytes used, or 0 if the coding is invalid.
+func decodeFLACNumber(b []byte) (int64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+
+	l := 0
+	for l < 8 && b[0]&(0x80>>l) != 0 {
+		l++
+	}
+	if l == 0 {
+		return int64(b[0]), 1
+	}
+	if l == 1 || l > 7 || len(b) < l {
+		return 0, 0
+	}
+
+	rv := int64(b[0] & (0x7f >> l))
+	for _, c := range b[1:l] {
+		if c&0xc0 != 0x80 {
+			return 0, 0
+		}
+		rv = rv<<6 | int64(c&0x3f)
+	}
+	return rv, l
+}
+
+// crc8 computes the CRC-8 checksum used in FLAC frame headers (polynomial 0x07)
+func crc8(b []byte) byte {
+	var crc byte
+	for _, c := range b {
+		crc ^= c
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func (f *flacSeeker) Read(b []byte) (int, error) {
+	f.Init()
+	if f.err != nil || f.current == nil {
+		return 0, f.err
+	}
+
+	for f.skip > 0 {
+		n, err := io.CopyN(io.Discard, f.current, f.skip)
+		f.skip -= n
+		if err != nil {
+			f.err = err
+			return 0, err
+		}
+	}
+
+	return f.current.Read(b)
+}
+
+func (f *flacSeeker) closeCurrent() {
+	if f.current != nil {
+		f.current.Close()
+		f.current = nil
+	}
+}
+
+// Close closes the reader and frees up any held resources
+func (f *flacSeeker) Close() error {
+	f.closeCurrent()
+	return f.src.Close()
+}
@@ -0,0 +1,159 @@
+package wavreader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+type testSource struct {
+	*bytes.Reader
+}
+
+func (testSource) Close() error {
+	return nil
+}
+
+// testFLACStream creates a FLAC stream with fixed-size frames of 256 samples.
+// Frame contents are garbage, apart from a false sync code in each frame.
+func testFLACStream(frames int, seekTable []flacSeekPoint) ([]byte, []int64) {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+
+	si := make([]byte, 34)
+	binary.BigEndian.PutUint16(si[0:2], 256)
+	binary.BigEndian.PutUint16(si[2:4], 256)
+	// 44.1kHz stereo 16 bit
+	si[10], si[11], si[12], si[13] = 0x0a, 0xc4, 0x42, 0xf0
+	binary.BigEndian.PutUint32(si[14:18], uint32(256*frames))
+
+	last := byte(0x80)
+	if seekTable != nil {
+		last = 0
+	}
+	b.Write([]byte{last, 0, 0, 34})
+	b.Write(si)
+
+	if seekTable != nil {
+		b.Write([]byte{0x83, 0, 0, byte(18 * (len(seekTable) + 1))})
+		for _, sp := range seekTable {
+			binary.Write(&b, binary.BigEndian, uint64(sp.Sample))
+			binary.Write(&b, binary.BigEndian, uint64(sp.Offset))
+			b.Write([]byte{1, 0})
+		}
+		// A placeholder point
+		b.Write(bytes.Repeat([]byte{0xff}, 8))
+		b.Write(make([]byte, 10))
+	}
+
+	first := int64(b.Len())
+	var offsets []int64
+	for i := 0; i < frames; i++ {
+		offsets = append(offsets, int64(b.Len())-first)
+
+		// Block size 256, 44.1kHz, stereo, 16 bit
+		hdr := []byte{0xff, 0xf8, 0x89, 0x18, byte(i)}
+		hdr = append(hdr, crc8(hdr))
+		b.Write(hdr)
+		b.Write(bytes.Repeat([]byte{byte(i + 1)}, 20+i))
+		b.Write([]byte{0xff, 0xf8, 0x89, 0x18, byte(i + 1), 0x00})
+		b.Write(bytes.Repeat([]byte{0x42}, 30))
+	}
+
+	return b.Bytes(), offsets
+}
+
+func TestFLACLocate(t *testing.T) {
+	_, offsets := testFLACStream(10, nil)
+	tables := [][]flacSeekPoint{
+		nil,
+		{{0, 0}, {1024, offsets[4]}, {2048, offsets[8]}},
+	}
+
+	for _, table := range tables {
+		stream, offsets := testFLACStream(10, table)
+		fs, err := FromSeekableFLAC(testSource{bytes.NewReader(stream)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := fs.(*flacSeeker)
+
+		if f.info.TotalSamples != 2560 || f.info.Format != CD {
+			t.Errorf("unexpected stream info: %d samples, %s", f.info.TotalSamples, f.info.Format)
+		}
+		if len(f.seekTable) != len(table) {
+			t.Errorf("expected %d seek points; got %d", len(table), len(f.seekTable))
+		}
+
+		for _, n := range []int64{0, 255, 256, 1000, 1024, 2100, 2559} {
+			offset, sample, err := f.locate(n)
+			if err != nil {
+				t.Errorf("sample %d: %v", n, err)
+				continue
+			}
+			frame := n / 256
+			if sample != frame*256 || offset != f.firstFrame+offsets[frame] {
+				t.Errorf("sample %d: got frame at offset %d starting at sample %d; expected %d, %d", n, offset, sample, f.firstFrame+offsets[frame], frame*256)
+			}
+		}
+
+		if _, _, err := f.locate(2560); err == nil {
+			t.Errorf("expected an error when locating a sample past the end")
+		}
+	}
+}
+
+func TestFLACHeaderFrom(t *testing.T) {
+	stream, _ := testFLACStream(10, nil)
+	fs, err := FromSeekableFLAC(testSource{bytes.NewReader(stream)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := ReadFLACInfo(bytes.NewReader(fs.(*flacSeeker).headerFrom(1024)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.TotalSamples != 1536 {
+		t.Errorf("expected 1536 remaining samples; got %d", fi.TotalSamples)
+	}
+}
+
+func TestSeekableWAV(t *testing.T) {
+	var b bytes.Buffer
+	ww := NewWriter(&b, CD)
+	ww.Init(400)
+	for i := 0; i < 100; i++ {
+		b.Write([]byte{byte(i), 0, byte(i), 0})
+	}
+
+	r := New(io.NopCloser(bytes.NewReader(b.Bytes())))
+	if _, ok := r.(Seeker); ok {
+		t.Errorf("a reader on a non-seekable source should not be a Seeker")
+	}
+
+	r = New(testSource{bytes.NewReader(b.Bytes())})
+	sk, ok := r.(Seeker)
+	if !ok {
+		t.Fatalf("a reader on a seekable source should be a Seeker")
+	}
+	sk.Init()
+
+	for _, n := range []int64{42, 7, 99} {
+		if err := sk.SeekSample(n); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(sk, buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] != byte(n) {
+			t.Errorf("after seeking to sample %d, read sample %d", n, buf[0])
+		}
+	}
+
+	if err := sk.SeekSample(101); err == nil {
+		t.Errorf("expected an error when seeking past the end")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 )
 
 // ToMP3 creates a WAV Writer that encodes the output into an MP3 stream
@@ -42,7 +41,7 @@ func (c Config) ToMP3(mp3Out io.Writer, format StreamFormat) (Writer, error) {
 		initialized: true,
 		format:      format,
 	}
-	mw.targetProcess = exec.Command(c.lame(), lamecmd...)
+	mw.targetProcess = c.command(c.lame(), lamecmd...)
 
 	mw.targetProcess.Stderr = os.Stderr
 	mw.targetProcess.Stdout = mp3Out
@@ -52,10 +51,18 @@ func (c Config) ToMP3(mp3Out io.Writer, format StreamFormat) (Writer, error) {
 		return nil, err
 	}
 
-	err = mw.targetProcess.Start()
+	err = startProcess(mw.targetProcess)
 	if err != nil {
 		return nil, err
 	}
 
 	return mw, nil
 }
+
+// MP3Settings describes the MP3 encoder settings, e.g. for use in cache keys
+func (c Config) MP3Settings() string {
+	if c.MaxBitrate > 0 {
+		return fmt.Sprintf("lame --abr %d", c.MaxBitrate)
+	}
+	return fmt.Sprintf("lame --vbr-new -V%d", c.VBRQuality)
+}
@@ -0,0 +1,78 @@
+package wavreader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// ToOggFLAC creates a WAV Writer that encodes the output into an Ogg-FLAC stream
+func ToOggFLAC(oggOut io.Writer, format StreamFormat) (Writer, error) {
+	return defaultConfig.ToOggFLAC(oggOut, format)
+}
+
+// ToOggFLAC creates a WAV Writer that encodes the output into an Ogg-FLAC stream
+func (c Config) ToOggFLAC(oggOut io.Writer, format StreamFormat) (Writer, error) {
+	flaccmd := []string{
+		"--silent", "--ogg", "--force-raw-format",
+		"--endian=little", "--sign=signed",
+		fmt.Sprintf("--channels=%d", format.Channels),
+		fmt.Sprintf("--bps=%d", format.Bits),
+		fmt.Sprintf("--sample-rate=%d", format.Rate),
+		fmt.Sprintf("--compression-level-%d", c.flacCompression()),
+		"--stdout", "-",
+	}
+
+	return startEncoder(c.command(c.flac(), flaccmd...), oggOut, format)
+}
+
+// ToOpus creates a WAV Writer that encodes the output into an Ogg/Opus stream
+func ToOpus(opusOut io.Writer, format StreamFormat) (Writer, error) {
+	return defaultConfig.ToOpus(opusOut, format)
+}
+
+// ToOpus creates a WAV Writer that encodes the output into an Ogg/Opus stream
+func (c Config) ToOpus(opusOut io.Writer, format StreamFormat) (Writer, error) {
+	if format.Channels < 1 || format.Channels > 2 {
+		return nil, fmt.Errorf("unsupported number of channels %d", format.Channels)
+	}
+
+	opuscmd := []string{
+		"--quiet", "--raw",
+		"--raw-bits", fmt.Sprintf("%d", format.Bits),
+		"--raw-rate", fmt.Sprintf("%d", format.Rate),
+		"--raw-chan", fmt.Sprintf("%d", format.Channels),
+		"--raw-endianness", "0",
+		"--bitrate", fmt.Sprintf("%d", c.opusBitrate()),
+		"-", "-",
+	}
+
+	return startEncoder(c.command(c.opusenc(), opuscmd...), opusOut, format)
+}
+
+// startEncoder runs an external encoder that reads raw PCM audio on stdin
+func startEncoder(cmd *exec.Cmd, out io.Writer, format StreamFormat) (Writer, error) {
+	var err error
+
+	ew := &wavWriter{
+		initialized: true,
+		format:      format,
+	}
+	ew.targetProcess = cmd
+
+	ew.targetProcess.Stderr = os.Stderr
+	ew.targetProcess.Stdout = out
+
+	ew.target, err = ew.targetProcess.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = startProcess(ew.targetProcess)
+	if err != nil {
+		return nil, err
+	}
+
+	return ew, nil
+}
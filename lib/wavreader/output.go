@@ -3,7 +3,6 @@ package wavreader
 import (
 	"fmt"
 	"os"
-	"os/exec"
 )
 
 // AudioOutput creates a WAV Writer that pipes the audio stream to the local sound card
@@ -24,7 +23,7 @@ func (c Config) AudioOutput() (Writer, error) {
 		format.Rate,
 		(format.Bits+7)/8,
 	)
-	mpl := exec.Command(c.mplayer(),
+	mpl := c.command(c.mplayer(),
 		"-really-quiet",
 		"-noconsolecontrols", "-nomouseinput", "-nolirc",
 		"-cache", "1024",
@@ -41,7 +40,7 @@ func (c Config) AudioOutput() (Writer, error) {
 		return nil, err
 	}
 
-	mpl.Start()
+	startProcess(mpl)
 
 	rv := &wavWriter{
 		target:        stdin,
@@ -0,0 +1,77 @@
+package wavreader
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ProcessStat counts the runs of one external program
+type ProcessStat struct {
+	Program string
+
+	// The number of times the program was started
+	Starts int64
+
+	// The number of runs that exited with a non-zero status
+	Failures int64
+}
+
+var processStats struct {
+	mu    sync.Mutex
+	stats map[string]*ProcessStat
+}
+
+// ProcessStats returns the run counts of all external programs started so
+// far, ordered by program name
+func ProcessStats() []ProcessStat {
+	processStats.mu.Lock()
+	defer processStats.mu.Unlock()
+
+	rv := make([]ProcessStat, 0, len(processStats.stats))
+	for _, st := range processStats.stats {
+		rv = append(rv, *st)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Program < rv[j].Program
+	})
+	return rv
+}
+
+func processStat(cmd *exec.Cmd) *ProcessStat {
+	name := filepath.Base(cmd.Args[0])
+	if processStats.stats == nil {
+		processStats.stats = make(map[string]*ProcessStat)
+	}
+	st, ok := processStats.stats[name]
+	if !ok {
+		st = &ProcessStat{Program: name}
+		processStats.stats[name] = st
+	}
+	return st
+}
+
+// startProcess starts an external program, and keeps count
+func startProcess(cmd *exec.Cmd) error {
+	err := cmd.Start()
+	if err == nil {
+		processStats.mu.Lock()
+		processStat(cmd).Starts++
+		processStats.mu.Unlock()
+	}
+	return err
+}
+
+// waitProcess waits for an external program to exit, and counts failed runs.
+// Programs that were killed, e.g. because we stopped reading their output,
+// don't count as failures.
+func waitProcess(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if ee, ok := err.(*exec.ExitError); ok && ee.Exited() {
+		processStats.mu.Lock()
+		processStat(cmd).Failures++
+		processStats.mu.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package wavreader
+
+import (
+	"fmt"
+	"io"
+)
+
+// A Seeker is a Reader that can move its read position to any sample frame
+type Seeker interface {
+	Reader
+
+	// SeekSample moves the read position to the start of sample frame n
+	SeekSample(n int64) error
+}
+
+// A RandomAccessSource is an input stream that supports random access, such
+// as a file on disk or a file stored without compression in a zip archive.
+type RandomAccessSource interface {
+	io.ReaderAt
+	io.Closer
+
+	// Size returns the size of the stream in bytes
+	Size() int64
+}
+
+// A seekableWAVReader reads WAV from a seekable source, locating samples by
+// offset arithmetic
+type seekableWAVReader struct {
+	*wavReader
+	seeker io.Seeker
+}
+
+func (w *seekableWAVReader) SeekSample(n int64) error {
+	w.Init()
+	if w.errorState != nil && w.errorState != io.EOF {
+		return w.errorState
+	}
+
+	bps := int64(w.format.BytesPerSample())
+	if n < 0 || (w.size > 0 && n*bps > int64(w.size)) {
+		return fmt.Errorf("sample %d out of range", n)
+	}
+
+	_, err := w.seeker.Seek(w.dataStart+n*bps, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	w.bytesRead = int(n * bps)
+	w.errorState = nil
+	return nil
+}
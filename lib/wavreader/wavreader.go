@@ -32,11 +32,18 @@ type wavReader struct {
 	size        int
 	bytesRead   int
 	format      StreamFormat
+
+	// The offset of the audio data within the source stream
+	dataStart int64
 }
 
-// New creates a Reader from a stream encoded in the WAV file format
+// New creates a Reader from a stream encoded in the WAV file format. If the
+// source stream is seekable, the resulting Reader is a Seeker.
 func New(source io.ReadCloser) Reader {
 	rv := &wavReader{source: source, initialized: false}
+	if sk, ok := source.(io.Seeker); ok {
+		return &seekableWAVReader{rv, sk}
+	}
 	return rv
 }
 
@@ -170,6 +177,7 @@ func (w *wavReader) Init() {
 	}
 
 	w.size = atoi(dc[4:8])
+	w.dataStart = int64(dataChunkStart + 8)
 
 	if totalLength != w.size+headerLength+20 {
 		w.errorState = errParse
@@ -138,9 +138,9 @@ func (w *wavWriter) CloseWithError(er error) error {
 
 	if w.targetProcess != nil {
 		if rv == nil {
-			rv = w.targetProcess.Wait()
+			rv = waitProcess(w.targetProcess)
 		} else {
-			w.targetProcess.Wait()
+			waitProcess(w.targetProcess)
 		}
 	}
 
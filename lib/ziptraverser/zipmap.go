@@ -103,17 +103,75 @@ func (z *zipMap) Exists(filename string) bool {
 func (z *zipMap) Get(filename string) (io.ReadCloser, error) {
 	rv, _ := os.Open(os.DevNull)
 
-	var err error
-
 	// Try opening the file itself, maybe that works...
-	fi, err := os.Stat(filename)
-	if err == nil {
-		// Is it a regular file?
-		if (fi.Mode() & os.ModeType) == 0 {
-			return os.Open(filename)
+	if isRegularFile(filename) {
+		return os.Open(filename)
+	}
+
+	_, zfp, err := z.find(filename)
+	if err != nil {
+		return rv, err
+	}
+
+	return zfp.Open()
+}
+
+func (z *zipMap) GetReaderAt(filename string) (RandomAccessFile, error) {
+	if isRegularFile(filename) {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
 		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return sectionFile{io.NewSectionReader(f, 0, fi.Size()), f}, nil
+	}
+
+	zipfile, zfp, err := z.find(filename)
+	if err != nil {
+		return nil, err
 	}
 
+	if zfp.Method != zip.Store {
+		return nil, errors.Wrapf(ErrCompressed, "file '%s' in '%s'", zfp.Name, zipfile)
+	}
+
+	offset, err := zfp.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	// The zip reader doesn't expose its file handle, so open another one
+	f, err := os.Open(zipfile)
+	if err != nil {
+		return nil, err
+	}
+
+	return sectionFile{io.NewSectionReader(f, offset, int64(zfp.UncompressedSize64)), f}, nil
+}
+
+func (z *zipMap) Stat(filename string) (os.FileInfo, error) {
+	if isRegularFile(filename) {
+		return os.Stat(filename)
+	}
+
+	_, zfp, err := z.find(filename)
+	if err != nil {
+		return nil, err
+	}
+	return zfp.FileInfo(), nil
+}
+
+func isRegularFile(filename string) bool {
+	fi, err := os.Stat(filename)
+	return err == nil && (fi.Mode()&os.ModeType) == 0
+}
+
+// find locates a file inside a zip archive somewhere along its path
+func (z *zipMap) find(filename string) (string, *zip.File, error) {
 	// FIXME: I'm of the opinion that this should work: elems := filepath.SplitList(filename)
 	abs := ""
 	elems := strings.Split(filename, "/")
@@ -139,14 +197,24 @@ func (z *zipMap) Get(filename string) (io.ReadCloser, error) {
 
 		for _, zfp := range read.File {
 			if zfp.Name == localfile {
-				return zfp.Open()
+				return zipfile, zfp, nil
 			}
 		}
 
-		return rv, errors.Wrapf(os.ErrNotExist, "file '%s' does not exist in '%s'", localfile, zipfile)
+		return zipfile, nil, errors.Wrapf(os.ErrNotExist, "file '%s' does not exist in '%s'", localfile, zipfile)
 	}
 
-	return rv, errors.Wrapf(os.ErrNotExist, "file '%s' does not exist", filename) // os.ErrNotExist
+	return "", nil, errors.Wrapf(os.ErrNotExist, "file '%s' does not exist", filename) // os.ErrNotExist
+}
+
+// A sectionFile is a section of a file on disk
+type sectionFile struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (s sectionFile) Close() error {
+	return s.file.Close()
 }
 
 func (z *zipMap) CopyTo(filename, destination string) error {
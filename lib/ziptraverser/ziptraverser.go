@@ -24,9 +24,23 @@ not thread-safe in any way.
 package ziptraverser
 
 import (
+	"errors"
 	"io"
+	"os"
 )
 
+// ErrCompressed is returned when random access is requested to a compressed file
+var ErrCompressed = errors.New("random access is not possible for compressed files")
+
+// A RandomAccessFile provides random access to a file's contents
+type RandomAccessFile interface {
+	io.ReaderAt
+	io.ReadSeekCloser
+
+	// Size returns the file size in bytes
+	Size() int64
+}
+
 // A ZipTraverser provides a transparent way of opening files by path name,
 // where some of the directory names are actually zip archive files.
 type ZipTraverser interface {
@@ -36,6 +50,14 @@ type ZipTraverser interface {
 	// Get opens the specified file name and provides a reader into its contents
 	Get(filename string) (io.ReadCloser, error)
 
+	// GetReaderAt opens the specified file name for random access. Files
+	// inside a zip archive must have been stored without compression.
+	GetReaderAt(filename string) (RandomAccessFile, error)
+
+	// Stat describes the specified file. For files inside a zip archive,
+	// Sys() returns its *zip.FileHeader.
+	Stat(filename string) (os.FileInfo, error)
+
 	// CopyTo copies the source file to a destination on the local file system
 	CopyTo(filename, destination string) error
 
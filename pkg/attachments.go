@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/thijzert/speeldoos/lib/ziptraverser"
+)
+
+// The types of attachment that accompany a carrier
+const (
+	AttachmentCover    = "cover"
+	AttachmentInlay    = "inlay"
+	AttachmentDisc     = "disc"
+	AttachmentBooklet  = "booklet"
+	AttachmentEACLog   = "eac-log"
+	AttachmentCuesheet = "cuesheet"
+)
+
+// AttachmentTypes lists all types of attachment
+var AttachmentTypes = []string{
+	AttachmentCover,
+	AttachmentInlay,
+	AttachmentDisc,
+	AttachmentBooklet,
+	AttachmentEACLog,
+	AttachmentCuesheet,
+}
+
+// An Attachment is a file that accompanies a carrier's audio, such as its
+// cover art or booklet
+type Attachment struct {
+	// One of the Attachment* constants
+	Type string `xml:"type,attr"`
+
+	// The disc this attachment belongs to, if any
+	Disc int `xml:"disc,attr,omitempty" json:",omitempty"`
+
+	// The file name, relative to the library directory
+	Filename string `xml:",chardata"`
+}
+
+// ErrNoAttachment is returned when a carrier has no attachment of the requested type
+var ErrNoAttachment = errors.New("attachment not found")
+
+// attachmentNames lists the file names under which each type of attachment
+// is stored, in order of preference. These match the names used by `sd
+// seedvault`. Some attachments may differ for each disc; disc directories
+// also contain a copy of the carrier's cover, but that's the same everywhere.
+var attachmentNames = []struct {
+	Type    string
+	PerDisc bool
+	Names   []string
+}{
+	{AttachmentCover, false, []string{"folder.jpg", "cover.jpg", "cover.jpeg", "cover.png"}},
+	{AttachmentInlay, false, []string{"inlay.jpg", "inlay.jpeg", "back.jpg"}},
+	{AttachmentDisc, true, []string{"disc.jpg", "disc.jpeg", "cd.jpg"}},
+	{AttachmentBooklet, false, []string{"booklet.pdf"}},
+	{AttachmentEACLog, true, []string{"eac.log", "rip.log"}},
+	{AttachmentCuesheet, true, []string{"cuesheet.cue"}},
+}
+
+var discDir = regexp.MustCompile(`^disc_?\d+$`)
+
+// Attachments returns the cover art, booklet and other attachments of a
+// carrier. If the carrier doesn't list them, they are looked for alongside
+// its audio files.
+func (l *Library) Attachments(c *Carrier) []Attachment {
+	if len(c.Attachments) > 0 {
+		return c.Attachments
+	}
+
+	l.attachmentMu.Lock()
+	defer l.attachmentMu.Unlock()
+
+	if rv, ok := l.attachments[c.ID]; ok {
+		return rv
+	}
+
+	// The carrier's root directory holds the attachments for the whole
+	// carrier; any disc directories below it those for individual discs.
+	var root string
+	discs := make(map[int]string)
+	for _, pf := range c.Performances {
+		for _, sf := range pf.SourceFiles {
+			dir := path.Dir(sf.Filename)
+			if discDir.MatchString(path.Base(dir)) {
+				discs[sf.Disc] = dir
+				dir = path.Dir(dir)
+			}
+			if root == "" {
+				root = dir
+			}
+		}
+	}
+
+	var rv []Attachment
+	if root != "" {
+		zm := ziptraverser.New()
+		defer zm.Close()
+
+		find := func(dir string, names []string) string {
+			for _, name := range names {
+				fn := path.Join(dir, name)
+				if zm.Exists(path.Join(l.LibraryDir, fn)) {
+					return fn
+				}
+			}
+			return ""
+		}
+
+		discNumbers := make([]int, 0, len(discs))
+		for d := range discs {
+			discNumbers = append(discNumbers, d)
+		}
+		sort.Ints(discNumbers)
+
+		for _, an := range attachmentNames {
+			if fn := find(root, an.Names); fn != "" {
+				rv = append(rv, Attachment{Type: an.Type, Filename: fn})
+			}
+
+			if an.PerDisc {
+				for _, d := range discNumbers {
+					if fn := find(discs[d], an.Names); fn != "" {
+						rv = append(rv, Attachment{Type: an.Type, Disc: d, Filename: fn})
+					}
+				}
+			}
+		}
+	}
+
+	if l.attachments == nil {
+		l.attachments = make(map[string][]Attachment)
+	}
+	l.attachments[c.ID] = rv
+
+	return rv
+}
+
+// FindAttachment returns a carrier's attachment of the specified type. If
+// there's none for the specified disc, it falls back on the one for the
+// whole carrier.
+func (l *Library) FindAttachment(c *Carrier, attachmentType string, disc int) (Attachment, error) {
+	var rv Attachment
+	found := false
+	for _, a := range l.Attachments(c) {
+		if a.Type != attachmentType {
+			continue
+		}
+		if a.Disc == disc {
+			return a, nil
+		}
+		if !found || a.Disc == 0 {
+			rv, found = a, true
+		}
+	}
+
+	if !found {
+		return rv, ErrNoAttachment
+	}
+	return rv, nil
+}
+
+// OpenAttachment opens an attachment for reading
+func (l *Library) OpenAttachment(a Attachment) (io.ReadCloser, error) {
+	zm := ziptraverser.New()
+	f, err := zm.Get(path.Join(l.LibraryDir, a.Filename))
+	if err != nil {
+		zm.Close()
+		return nil, err
+	}
+	return attachmentReader{f, zm}, nil
+}
+
+// OpenAttachmentSeeker opens an attachment for random access, and describes
+// the file. Compressed files inside a zip archive can't be read that way, so
+// those are read into memory instead.
+func (l *Library) OpenAttachmentSeeker(a Attachment) (io.ReadSeekCloser, os.FileInfo, error) {
+	zm := ziptraverser.New()
+	filename := path.Join(l.LibraryDir, a.Filename)
+
+	fi, err := zm.Stat(filename)
+	if err != nil {
+		zm.Close()
+		return nil, nil, err
+	}
+
+	f, err := zm.GetReaderAt(filename)
+	if err == nil {
+		return attachmentSeeker{f, zm}, fi, nil
+	}
+	if !errors.Is(err, ziptraverser.ErrCompressed) {
+		zm.Close()
+		return nil, nil, err
+	}
+
+	rd, err := zm.Get(filename)
+	if err != nil {
+		zm.Close()
+		return nil, nil, err
+	}
+	b, err := io.ReadAll(rd)
+	rd.Close()
+	zm.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(b)}, fi, nil
+}
+
+// An attachmentSeeker closes its ziptraverser along with the file
+type attachmentSeeker struct {
+	ziptraverser.RandomAccessFile
+	zm ziptraverser.ZipTraverser
+}
+
+func (a attachmentSeeker) Close() error {
+	err := a.RandomAccessFile.Close()
+	a.zm.Close()
+	return err
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// An attachmentReader closes its ziptraverser along with the file
+type attachmentReader struct {
+	io.ReadCloser
+	zm ziptraverser.ZipTraverser
+}
+
+func (a attachmentReader) Close() error {
+	err := a.ReadCloser.Close()
+	a.zm.Close()
+	return err
+}
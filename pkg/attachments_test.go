@@ -0,0 +1,159 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(dir, "ABC-1.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{
+		"ABC-1/folder.jpg",
+		"ABC-1/booklet.pdf",
+		"ABC-1/disc_1/01.flac",
+		"ABC-1/disc_1/disc.jpg",
+		"ABC-1/disc_2/01.flac",
+		"ABC-1/disc_2/folder.jpg",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	l := &Library{LibraryDir: dir}
+	c := &Carrier{
+		ID: "ABC-1",
+		Performances: []Performance{
+			{SourceFiles: []SourceFile{
+				{Filename: "ABC-1.zip/ABC-1/disc_1/01.flac", Disc: 1},
+				{Filename: "ABC-1.zip/ABC-1/disc_2/01.flac", Disc: 2},
+			}},
+		},
+	}
+
+	expected := []Attachment{
+		{Type: AttachmentCover, Filename: "ABC-1.zip/ABC-1/folder.jpg"},
+		{Type: AttachmentDisc, Disc: 1, Filename: "ABC-1.zip/ABC-1/disc_1/disc.jpg"},
+		{Type: AttachmentBooklet, Filename: "ABC-1.zip/ABC-1/booklet.pdf"},
+	}
+	if got := l.Attachments(c); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got attachments %v; expected %v", got, expected)
+	}
+
+	if a, err := l.FindAttachment(c, AttachmentCover, 2); err != nil || a.Filename != expected[0].Filename {
+		t.Errorf("cover for disc 2: got %v (%v); expected the carrier's cover", a, err)
+	}
+	if _, err := l.FindAttachment(c, AttachmentDisc, 2); err != nil {
+		t.Errorf("disc image for disc 2: got error %v; expected a fallback to disc 1", err)
+	}
+	if _, err := l.FindAttachment(c, AttachmentInlay, 0); err != ErrNoAttachment {
+		t.Errorf("inlay: got error %v; expected %v", err, ErrNoAttachment)
+	}
+
+	rd, err := l.OpenAttachment(expected[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	b := make([]byte, 64)
+	n, _ := rd.Read(b)
+	if string(b[:n]) != "ABC-1/booklet.pdf" {
+		t.Errorf("read '%s' from the booklet", b[:n])
+	}
+}
+
+func TestOpenAttachmentSeeker(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "eac.log"), []byte("Exact Audio Copy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "ABC-1.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, method := range map[string]uint16{"folder.jpg": zip.Store, "eac.log": zip.Deflate} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("Exact Audio Copy"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	l := &Library{LibraryDir: dir}
+	for _, fn := range []string{"eac.log", "ABC-1.zip/folder.jpg", "ABC-1.zip/eac.log"} {
+		rd, fi, err := l.OpenAttachmentSeeker(Attachment{Type: AttachmentEACLog, Filename: fn})
+		if err != nil {
+			t.Errorf("%s: %v", fn, err)
+			continue
+		}
+		if fi.Size() != 16 {
+			t.Errorf("%s: size is %d", fn, fi.Size())
+		}
+		if _, err := rd.Seek(6, io.SeekStart); err != nil {
+			t.Errorf("%s: %v", fn, err)
+		}
+		b, _ := io.ReadAll(rd)
+		rd.Close()
+		if string(b) != "Audio Copy" {
+			t.Errorf("%s: read '%s' after seeking", fn, b)
+		}
+	}
+}
+
+func TestCarrierAttachmentsXML(t *testing.T) {
+	in := []byte(`<Carrier xmlns="https://www.inurbanus.nl/NS/speeldoos/1.0"><ID>ABC-1</ID>` +
+		`<Performances><Performance><SourceFiles><File>ABC-1.zip/01.flac</File></SourceFiles></Performance></Performances>` +
+		`<Attachments><Attachment type="cover">ABC-1.zip/folder.jpg</Attachment><Attachment type="eac-log" disc="2">ABC-1.zip/disc_02/eac.log</Attachment></Attachments>` +
+		`</Carrier>`)
+
+	c := &Carrier{}
+	if err := xml.Unmarshal(in, c); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Attachment{
+		{Type: AttachmentCover, Filename: "ABC-1.zip/folder.jpg"},
+		{Type: AttachmentEACLog, Disc: 2, Filename: "ABC-1.zip/disc_02/eac.log"},
+	}
+	if !reflect.DeepEqual(c.Attachments, expected) {
+		t.Errorf("got attachments %v; expected %v", c.Attachments, expected)
+	}
+
+	// Listed attachments take precedence over the ones found by convention
+	l := &Library{LibraryDir: t.TempDir()}
+	if got := l.Attachments(c); !reflect.DeepEqual(got, expected) {
+		t.Errorf("library returned attachments %v; expected %v", got, expected)
+	}
+
+	out, err := xml.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte(`<Attachment type="eac-log" disc="2">ABC-1.zip/disc_02/eac.log</Attachment>`)) {
+		t.Errorf("unexpected XML output: %s", out)
+	}
+}
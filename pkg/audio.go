@@ -0,0 +1,427 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
+	"github.com/thijzert/speeldoos/lib/ziptraverser"
+)
+
+// A PerformanceAudio provides random access to the decoded audio of one
+// performance, presented as a single WAV file. Source files are decoded on
+// demand. Where possible, seeking restarts the decoder at the exact sample;
+// source files that don't support random access (e.g. if they're compressed
+// inside a zip archive) are decoded from the start of the part instead.
+type PerformanceAudio struct {
+	format wavreader.StreamFormat
+	parts  []audioPart
+	conf   wavreader.Config
+	zm     ziptraverser.ZipTraverser
+
+	// The WAV header, which precedes the audio data
+	header []byte
+
+	// The offset (in bytes) within the audio data of the first byte served
+	start int64
+
+	// The current read position in the WAV file
+	pos int64
+
+	// The currently open decoder, and the audio data offset it's at
+	current     wavreader.Reader
+	currentPart int
+	currentPos  int64
+}
+
+type audioPart struct {
+	Filename string
+	Offset   int64
+	Size     int64
+
+	// The number of bytes at the start of the decoded file that aren't part of this one
+	Skip int64
+}
+
+// OpenAudio prepares a performance for random access to its audio
+func (l *Library) OpenAudio(pf Performance) (*PerformanceAudio, error) {
+	if len(pf.SourceFiles) == 0 {
+		return nil, errors.New("this performance has no source files")
+	}
+
+	rv := &PerformanceAudio{
+		conf:        l.WAVConf,
+		zm:          ziptraverser.New(),
+		currentPart: -1,
+	}
+
+	var offset int64
+	for i, f := range pf.SourceFiles {
+		filename := path.Join(l.LibraryDir, f.Filename)
+		fl, err := rv.zm.Get(filename)
+		if err != nil {
+			rv.Close()
+			return nil, err
+		}
+
+		fi, err := wavreader.ReadFLACInfo(fl)
+		fl.Close()
+		if err != nil {
+			rv.Close()
+			return nil, fmt.Errorf("%s: %v", f.Filename, err)
+		}
+		if fi.TotalSamples == 0 {
+			rv.Close()
+			return nil, fmt.Errorf("%s: unknown stream length", f.Filename)
+		}
+
+		if i == 0 {
+			rv.format = fi.Format
+		} else if fi.Format != rv.format {
+			rv.Close()
+			return nil, fmt.Errorf("audio format mismatch: part %d is %s; previously it was %s", i+1, fi.Format, rv.format)
+		}
+
+		start, end, err := f.sampleRange(fi.TotalSamples)
+		if err != nil {
+			rv.Close()
+			return nil, err
+		}
+		bps := int64(fi.Format.BytesPerSample())
+
+		rv.parts = append(rv.parts, audioPart{
+			Filename: filename,
+			Offset:   offset,
+			Size:     (end - start) * bps,
+			Skip:     start * bps,
+		})
+		offset += (end - start) * bps
+	}
+
+	rv.setHeader()
+	return rv, nil
+}
+
+func (a *PerformanceAudio) setHeader() {
+	var b bytes.Buffer
+	wavreader.NewWriter(&b, a.format).Init(int(a.dataSize() - a.start))
+	a.header = b.Bytes()
+}
+
+func (a *PerformanceAudio) dataSize() int64 {
+	last := a.parts[len(a.parts)-1]
+	return last.Offset + last.Size
+}
+
+// Format returns the audio format of this performance
+func (a *PerformanceAudio) Format() wavreader.StreamFormat {
+	return a.format
+}
+
+// Duration returns the playing time from the start point onwards
+func (a *PerformanceAudio) Duration() time.Duration {
+	return a.bytesToDuration(a.dataSize() - a.start)
+}
+
+// Parts returns the number of parts (source files) in this performance
+func (a *PerformanceAudio) Parts() int {
+	return len(a.parts)
+}
+
+// PartStart returns the time at which part n (counting from 0) starts
+func (a *PerformanceAudio) PartStart(n int) (time.Duration, error) {
+	if n < 0 || n >= len(a.parts) {
+		return 0, fmt.Errorf("part %d out of range", n+1)
+	}
+	return a.bytesToDuration(a.parts[n].Offset), nil
+}
+
+// StartAt moves the start of the WAV file to the specified time offset. This
+// discards any audio before that point, and resets the read position.
+func (a *PerformanceAudio) StartAt(t time.Duration) error {
+	bps := int64(a.format.BytesPerSample())
+	start := int64(t) * int64(a.format.Rate) / int64(time.Second) * bps
+	if start < 0 || start >= a.dataSize() {
+		return fmt.Errorf("start time %v out of range", t)
+	}
+
+	a.start = start
+	a.pos = 0
+	a.setHeader()
+	return nil
+}
+
+// DataOffset returns the offset of the first byte of audio in the WAV file
+func (a *PerformanceAudio) DataOffset() int64 {
+	return int64(len(a.header))
+}
+
+// Size returns the total size of the WAV file
+func (a *PerformanceAudio) Size() int64 {
+	return int64(len(a.header)) + a.dataSize() - a.start
+}
+
+func (a *PerformanceAudio) bytesToDuration(n int64) time.Duration {
+	bps := int64(a.format.BytesPerSample() * a.format.Rate)
+	return time.Duration(n) * time.Second / time.Duration(bps)
+}
+
+// Seek implements io.Seeker
+func (a *PerformanceAudio) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += a.pos
+	case io.SeekEnd:
+		offset += a.Size()
+	default:
+		return a.pos, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return a.pos, errors.New("negative position")
+	}
+	a.pos = offset
+	return a.pos, nil
+}
+
+func (a *PerformanceAudio) Read(b []byte) (int, error) {
+	if a.pos >= a.Size() {
+		return 0, io.EOF
+	}
+
+	if a.pos < int64(len(a.header)) {
+		n := copy(b, a.header[a.pos:])
+		a.pos += int64(n)
+		return n, nil
+	}
+
+	d := a.start + a.pos - int64(len(a.header))
+	part := 0
+	for part+1 < len(a.parts) && a.parts[part+1].Offset <= d {
+		part++
+	}
+
+	if err := a.decodeFrom(part, d); err != nil {
+		return 0, err
+	}
+
+	if rest := a.parts[part].Offset + a.parts[part].Size - d; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+
+	n, err := a.current.Read(b)
+	a.pos += int64(n)
+	a.currentPos += int64(n)
+	if err == io.EOF {
+		if n == 0 && a.currentPos < a.parts[part].Offset+a.parts[part].Size {
+			return 0, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+
+	return n, err
+}
+
+// decodeFrom ensures the current decoder is positioned at data offset d in the given part
+func (a *PerformanceAudio) decodeFrom(part int, d int64) error {
+	// Skipping ahead a little is cheaper than restarting the decoder
+	maxSkip := int64(a.format.BytesPerSample() * a.format.Rate)
+
+	if a.current == nil || a.currentPart != part || a.currentPos > d || a.currentPos+maxSkip < d {
+		a.closeCurrent()
+
+		err := a.openSeekable(part, d)
+		if err != nil {
+			err = a.openSequential(part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if skip := d - a.currentPos; skip > 0 {
+		n, err := io.CopyN(ioutil.Discard, a.current, skip)
+		a.currentPos += n
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openSeekable starts decoding a part at data offset d
+func (a *PerformanceAudio) openSeekable(part int, d int64) error {
+	fl, err := a.zm.GetReaderAt(a.parts[part].Filename)
+	if err != nil {
+		return err
+	}
+
+	ww, err := a.conf.FromSeekableFLAC(fl)
+	if err != nil {
+		fl.Close()
+		return err
+	}
+
+	bps := int64(a.format.BytesPerSample())
+	err = ww.SeekSample((d - a.parts[part].Offset + a.parts[part].Skip) / bps)
+	if err != nil {
+		ww.Close()
+		return err
+	}
+
+	a.current = ww
+	a.currentPart = part
+	a.currentPos = d
+	return nil
+}
+
+// openSequential starts decoding a part from its start
+func (a *PerformanceAudio) openSequential(part int) error {
+	fl, err := a.zm.Get(a.parts[part].Filename)
+	if err != nil {
+		return err
+	}
+
+	ww, err := a.conf.FromFLAC(fl)
+	if err != nil {
+		fl.Close()
+		return err
+	}
+	ww.Init()
+
+	// Decoding starts at the start of the file, which may be before the start of the part
+	a.current = ww
+	a.currentPart = part
+	a.currentPos = a.parts[part].Offset - a.parts[part].Skip
+	return nil
+}
+
+// DecodeSourceFile decodes the audio in a source file, limited to the range
+// of samples that belongs to it
+func DecodeSourceFile(conf wavreader.Config, fl io.ReadCloser, sf SourceFile) (wavreader.Reader, error) {
+	ww, err := conf.FromFLAC(fl)
+	if err != nil {
+		return nil, err
+	}
+	ww.Init()
+	if !sf.Ranged() {
+		return ww, nil
+	}
+
+	bps := int64(ww.Format().BytesPerSample())
+	if bps == 0 {
+		ww.Close()
+		return nil, fmt.Errorf("%s: invalid audio format", sf.Filename)
+	}
+	start, end, err := sf.sampleRange(int64(ww.Size()) / bps)
+	if err != nil {
+		ww.Close()
+		return nil, err
+	}
+
+	_, err = io.CopyN(ioutil.Discard, ww, start*bps)
+	if err != nil {
+		ww.Close()
+		return nil, err
+	}
+
+	return &trimmedReader{
+		Reader: ww,
+		size:   (end - start) * bps,
+	}, nil
+}
+
+// A trimmedReader stops reading after a number of bytes
+type trimmedReader struct {
+	wavreader.Reader
+	size, read int64
+}
+
+func (t *trimmedReader) Init() {
+}
+
+func (t *trimmedReader) Size() int {
+	return int(t.size)
+}
+
+func (t *trimmedReader) SetSize(int) {
+}
+
+func (t *trimmedReader) Read(b []byte) (int, error) {
+	if t.read >= t.size {
+		return 0, io.EOF
+	}
+	if rest := t.size - t.read; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	n, err := t.Reader.Read(b)
+	t.read += int64(n)
+	return n, err
+}
+
+func (a *PerformanceAudio) closeCurrent() {
+	if a.current != nil {
+		a.current.Close()
+		a.current = nil
+		a.currentPart = -1
+	}
+}
+
+// Close frees any held resources
+func (a *PerformanceAudio) Close() error {
+	a.closeCurrent()
+	a.zm.Close()
+	return nil
+}
+
+// A performanceReader presents the audio data of a performance as a
+// wavreader.Seeker, where sample frames are counted across all parts.
+type performanceReader struct {
+	audio *PerformanceAudio
+}
+
+func newPerformanceReader(audio *PerformanceAudio) (*performanceReader, error) {
+	_, err := audio.Seek(audio.DataOffset(), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return &performanceReader{audio}, nil
+}
+
+func (p *performanceReader) Init() {
+}
+
+func (p *performanceReader) Format() wavreader.StreamFormat {
+	return p.audio.Format()
+}
+
+func (p *performanceReader) Size() int {
+	return int(p.audio.Size() - p.audio.DataOffset())
+}
+
+func (p *performanceReader) SetSize(int) {
+}
+
+func (p *performanceReader) Read(b []byte) (int, error) {
+	return p.audio.Read(b)
+}
+
+func (p *performanceReader) SeekSample(n int64) error {
+	bps := int64(p.audio.Format().BytesPerSample())
+	if n < 0 || n*bps > int64(p.Size()) {
+		return fmt.Errorf("sample %d out of range", n)
+	}
+	_, err := p.audio.Seek(p.audio.DataOffset()+n*bps, io.SeekStart)
+	return err
+}
+
+func (p *performanceReader) Close() error {
+	return p.audio.Close()
+}
@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
+)
+
+func TestPerformanceAudioLayout(t *testing.T) {
+	a := &PerformanceAudio{
+		format: wavreader.CD,
+		parts: []audioPart{
+			{Filename: "1.flac", Offset: 0, Size: 4 * 44100 * 10},
+			{Filename: "2.flac", Offset: 4 * 44100 * 10, Size: 4 * 44100 * 5},
+		},
+		currentPart: -1,
+	}
+	a.setHeader()
+
+	if a.Duration() != 15*time.Second {
+		t.Errorf("unexpected duration %v", a.Duration())
+	}
+	if a.Size() != 44+4*44100*15 {
+		t.Errorf("unexpected size %d", a.Size())
+	}
+	if ps, err := a.PartStart(1); err != nil || ps != 10*time.Second {
+		t.Errorf("unexpected part start %v (%v)", ps, err)
+	}
+	if _, err := a.PartStart(2); err == nil {
+		t.Errorf("expected an error for a nonexistent part")
+	}
+
+	if err := a.StartAt(12 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if a.Duration() != 3*time.Second || a.Size() != 44+4*44100*3 {
+		t.Errorf("unexpected duration %v or size %d after seeking", a.Duration(), a.Size())
+	}
+
+	hdr := make([]byte, 44)
+	if _, err := io.ReadFull(a, hdr); err != nil {
+		t.Fatal(err)
+	}
+	wr := wavreader.New(io.NopCloser(bytes.NewReader(hdr)))
+	wr.Init()
+	if wr.Format() != wavreader.CD || wr.Size() != 4*44100*3 {
+		t.Errorf("unexpected WAV header: format %s, size %d", wr.Format(), wr.Size())
+	}
+
+	if pos, _ := a.Seek(0, io.SeekEnd); pos != a.Size() {
+		t.Errorf("seeking to the end got position %d", pos)
+	}
+	if n, err := a.Read(hdr); n != 0 || err != io.EOF {
+		t.Errorf("expected EOF at the end of the stream; got %d, %v", n, err)
+	}
+}
+
+func TestSourceFileRange(t *testing.T) {
+	whole := SourceFile{Filename: "1.flac"}
+	if whole.Ranged() {
+		t.Errorf("a source file without a range should cover the whole file")
+	}
+	if start, end, err := whole.sampleRange(1000); err != nil || start != 0 || end != 1000 {
+		t.Errorf("whole file: %d to %d (%v)", start, end, err)
+	}
+
+	track := SourceFile{Filename: "disc.flac", Start: 588 * 75, End: 588 * 150}
+	if start, end, err := track.sampleRange(588 * 200); err != nil || start != 588*75 || end != 588*150 {
+		t.Errorf("track: %d to %d (%v)", start, end, err)
+	}
+	if _, _, err := track.sampleRange(588 * 100); err == nil {
+		t.Errorf("expected an error for a range past the end of the file")
+	}
+
+	last := SourceFile{Filename: "disc.flac", Start: 588 * 150}
+	if start, end, err := last.sampleRange(588 * 200); err != nil || start != 588*150 || end != 588*200 {
+		t.Errorf("last track: %d to %d (%v)", start, end, err)
+	}
+	if _, _, err := last.sampleRange(588 * 150); err == nil {
+		t.Errorf("expected an error for an empty range")
+	}
+
+	if !rangesOverlap(track, SourceFile{Start: 588 * 100, End: 588 * 120}) {
+		t.Errorf("expected the ranges to overlap")
+	}
+	if rangesOverlap(track, last) {
+		t.Errorf("consecutive tracks should not overlap")
+	}
+	if !rangesOverlap(last, SourceFile{Start: 588 * 180}) {
+		t.Errorf("two ranges that end at the end of the file should overlap")
+	}
+}
@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
+	"github.com/thijzert/speeldoos/lib/ziptraverser"
+)
+
+// A FixableError is a problem with a carrier that was fixed automatically
+type FixableError string
+
+func (f FixableError) Error() string {
+	return string(f)
+}
+
+func fixErr(format string, a ...interface{}) FixableError {
+	return FixableError(fmt.Sprintf(format, a...))
+}
+
+type checkF func(c *Carrier, libraryDir string) []error
+
+var allChecks []checkF = []checkF{
+	checkCarrierID,
+	checkSourceFiles,
+	checkAttachments,
+	checkComposers,
+}
+
+// CheckCarrier checks a carrier for missing information or other errors.
+// Problems that can be fixed automatically are fixed in place, and reported
+// as a FixableError.
+func CheckCarrier(c *Carrier, libraryDir string) []error {
+	var rv []error
+	for _, f := range allChecks {
+		rv = append(rv, f(c, libraryDir)...)
+	}
+	return rv
+}
+
+func checkCarrierID(c *Carrier, libraryDir string) []error {
+	if c.ID == "" {
+		return []error{fmt.Errorf("no carrier ID")}
+	}
+	return nil
+}
+
+func checkSourceFiles(c *Carrier, libraryDir string) []error {
+	rv := []error{}
+
+	seen := make([]SourceFile, 0)
+	ztr := ziptraverser.New()
+	defer ztr.Close()
+
+	for _, perf := range c.Performances {
+		for _, sf := range perf.SourceFiles {
+			if !ztr.Exists(path.Join(libraryDir, sf.Filename)) {
+				rv = append(rv, fmt.Errorf("source file missing: %s", sf))
+			} else if sf.Ranged() {
+				if err := checkSampleRange(ztr, libraryDir, sf); err != nil {
+					rv = append(rv, err)
+				}
+			}
+
+			for _, ssf := range seen {
+				if sf.Filename != ssf.Filename {
+					continue
+				}
+				if !sf.Ranged() || !ssf.Ranged() {
+					rv = append(rv, fmt.Errorf("duplicate source file: %s", sf))
+				} else if rangesOverlap(sf, ssf) {
+					rv = append(rv, fmt.Errorf("overlapping source files: %s (samples %d to %d) and samples %d to %d", sf, sf.Start, sf.End, ssf.Start, ssf.End))
+				}
+			}
+			seen = append(seen, sf)
+		}
+	}
+
+	return rv
+}
+
+// checkSampleRange checks that the range of a source file fits within its file
+func checkSampleRange(ztr ziptraverser.ZipTraverser, libraryDir string, sf SourceFile) error {
+	fl, err := ztr.Get(path.Join(libraryDir, sf.Filename))
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	fi, err := wavreader.ReadFLACInfo(fl)
+	if err != nil {
+		return fmt.Errorf("%s: %v", sf.Filename, err)
+	}
+	if fi.TotalSamples == 0 {
+		return fmt.Errorf("%s: unknown stream length", sf.Filename)
+	}
+	_, _, err = sf.sampleRange(fi.TotalSamples)
+	return err
+}
+
+// rangesOverlap returns true if two ranged source files share any samples
+func rangesOverlap(a, b SourceFile) bool {
+	// An end of 0 means the end of the file
+	after := func(end, start int64) bool {
+		return end != 0 && end <= start
+	}
+	return !after(a.End, b.Start) && !after(b.End, a.Start)
+}
+
+func checkAttachments(c *Carrier, libraryDir string) []error {
+	rv := []error{}
+
+	ztr := ziptraverser.New()
+	defer ztr.Close()
+
+	for _, a := range c.Attachments {
+		known := false
+		for _, t := range AttachmentTypes {
+			if a.Type == t {
+				known = true
+			}
+		}
+		if !known {
+			rv = append(rv, fmt.Errorf("unknown attachment type '%s' for %s", a.Type, a.Filename))
+		}
+
+		if !ztr.Exists(path.Join(libraryDir, a.Filename)) {
+			rv = append(rv, fmt.Errorf("attachment missing: %s", a.Filename))
+		}
+	}
+
+	return rv
+}
+
+func checkComposers(c *Carrier, libraryDir string) []error {
+	rv := []error{}
+	for i, perf := range c.Performances {
+		if perf.Work.Composer.ID == "" || perf.Work.Composer.ID == "2222" {
+			name := perf.Work.Composer.Name
+
+			if name == "" && perf.Work.Composer.ID == "" {
+				continue
+			} else if name == "Anonymous" {
+				c.Performances[i].Work.Composer.ID = "Anonymous_work"
+			} else {
+				c.Performances[i].Work.Composer.ID = strings.Replace(name, " ", "_", -1)
+			}
+
+			rv = append(rv, fixErr("empty composer ID for '%s'", name))
+		}
+	}
+
+	return rv
+}
@@ -2,11 +2,15 @@ package pkg
 
 import (
 	"archive/zip"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"sort"
 	"strings"
+
+	"github.com/thijzert/speeldoos/lib/wavreader"
 )
 
 type detectedFile struct {
@@ -14,6 +18,29 @@ type detectedFile struct {
 	Parts     []string
 	Extension string
 	Disc      int
+
+	// Vorbis comments, for FLAC files
+	Tags map[string][]string
+}
+
+// Tag returns the first value of a Vorbis comment, if present
+func (f detectedFile) Tag(name string) string {
+	if v := f.Tags[name]; len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
+
+// readTags reads the tags from a file's contents. Failing that, the file
+// simply doesn't have any.
+func (f *detectedFile) readTags(r io.Reader) {
+	if f.Extension != "flac" {
+		return
+	}
+	tags, err := wavreader.ReadFLACTags(r)
+	if err == nil && len(tags) > 0 {
+		f.Tags = tags
+	}
 }
 
 func detectFile(filename string) detectedFile {
@@ -34,6 +61,61 @@ type preliminaryCarrier struct {
 	SourceFiles []detectedFile
 	Carrier     Carrier
 	Errors      []error
+	Notes       []InferenceNote
+}
+
+// note records a conclusion drawn by an inference
+func (pc *preliminaryCarrier) note(c Confidence, format string, args ...interface{}) {
+	pc.Notes = append(pc.Notes, InferenceNote{
+		Confidence: c,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+// file returns the detected file a source file refers to
+func (pc preliminaryCarrier) file(filename string) (detectedFile, bool) {
+	for _, f := range pc.SourceFiles {
+		if f.Path == filename {
+			return f, true
+		}
+	}
+	return detectedFile{}, false
+}
+
+// Confidence indicates how sure an inference is of its conclusions
+type Confidence int
+
+// Confidence levels
+const (
+	ConfidenceLow Confidence = iota
+	ConfidenceMedium
+	ConfidenceHigh
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceHigh:
+		return "high"
+	case ConfidenceMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// An InferenceNote explains a conclusion drawn about an item in the inbox
+type InferenceNote struct {
+	Confidence Confidence
+	Message    string
+}
+
+func (n InferenceNote) String() string {
+	return fmt.Sprintf("%s (%s confidence)", n.Message, n.Confidence)
 }
 
 type inference interface {
@@ -41,11 +123,16 @@ type inference interface {
 }
 
 var defaultInferences = []inference{
+	discFolders{},
 	oneGiantPerformance{},
+	titlePrefixWorks{},
+	vorbisComments{},
+	catalogueNumbers{},
 }
 
-// importInboxCarrier tries to initialise a carrier from a given file path
-func (l *Library) importInboxCarrier(filename string) (Carrier, error) {
+// importInboxCarrier tries to initialise a carrier from a given file path.
+// Along with it, it returns notes on how it came to its conclusions.
+func (l *Library) importInboxCarrier(filename string) (Carrier, []InferenceNote, error) {
 	carrierID := filename
 	if len(carrierID) > 4 && carrierID[len(carrierID)-4:] == ".zip" {
 		carrierID = carrierID[:len(carrierID)-4]
@@ -71,12 +158,19 @@ func (l *Library) importInboxCarrier(filename string) (Carrier, error) {
 		rv = inf.Infer(rv)
 	}
 
-	// TODO: import inferences from a saved xml file, and apply those
+	// Apply any corrections that were saved for this item
+	draft, err := loadInboxDraft(inboxDraftFile(filename))
+	if err == nil {
+		rv = draft.Infer(rv)
+		rv.note(ConfidenceHigh, "applied the corrections in %s", path.Base(inboxDraftFile(filename)))
+	} else if !os.IsNotExist(err) {
+		rv.Errors = append(rv.Errors, err)
+	}
 
 	// Cleanup
 	rv = stripSourcePrefix{l.LibraryDir}.Infer(rv)
 
-	return rv.Carrier, multiError(rv.Errors)
+	return rv.Carrier, rv.Notes, multiError(rv.Errors)
 }
 
 func listFiles(filename string) ([]detectedFile, error) {
@@ -138,7 +232,12 @@ func scanDirectory(dirname string) ([]detectedFile, error) {
 		rv = append(rv, subf...)
 	}
 	for _, fullpath := range files {
-		rv = append(rv, detectFile(fullpath))
+		f := detectFile(fullpath)
+		if fp, err := os.Open(fullpath); err == nil {
+			f.readTags(fp)
+			fp.Close()
+		}
+		rv = append(rv, f)
 	}
 
 	return rv, nil
@@ -151,8 +250,15 @@ func scanZip(archivePath string) ([]detectedFile, error) {
 		return rv, err
 	}
 
+	defer zf.Close()
+
 	for _, fi := range zf.File {
-		rv = append(rv, detectFile(path.Join(archivePath, fi.Name)))
+		f := detectFile(path.Join(archivePath, fi.Name))
+		if fp, err := fi.Open(); err == nil {
+			f.readTags(fp)
+			fp.Close()
+		}
+		rv = append(rv, f)
 	}
 
 	return rv, nil
@@ -171,37 +277,342 @@ func multiError(constituentErrors []error) error {
 	return fmt.Errorf("%s", str)
 }
 
-// refreshInbox reads all carriers yet to be tagged properly, and adds them to the library
-func (l *Library) refreshInbox() error {
+// readInbox reads all carriers yet to be tagged properly
+func (l *Library) readInbox() ([]ParsedCarrier, error) {
 	rv := []ParsedCarrier{}
 
 	d, err := os.Open(path.Join(l.LibraryDir, "inbox"))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer d.Close()
 
 	files, err := d.Readdir(0)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, f := range files {
 		fn := f.Name()
+		if strings.HasSuffix(fn, draftSuffix) {
+			// Drafts are applied to the item they belong to
+			continue
+		}
 		if !f.IsDir() && len(fn) > 4 && fn[len(fn)-4:] == ".xml" {
-			// Ignore xml files
+			// Carriers that were tagged in the inbox
+			pc := ParsedCarrier{Filename: path.Join(l.LibraryDir, "inbox", fn)}
+			pc.Carrier, pc.Error = ImportCarrier(pc.Filename)
+			rv = append(rv, pc)
 			continue
 		}
 
 		fileName := path.Join(l.LibraryDir, "inbox", fn)
-		carrier, err := l.importInboxCarrier(fileName)
+		if _, err := os.Stat(inboxCarrierFile(fileName)); err == nil {
+			// This item has been tagged already
+			continue
+		}
+
+		carrier, notes, err := l.importInboxCarrier(fileName)
 
 		rv = append(rv, ParsedCarrier{
 			Filename: fileName,
 			Carrier:  &carrier,
 			Error:    err,
+			Notes:    notes,
 		})
 	}
 
-	l.Carriers = append(l.Carriers, rv...)
+	return rv, nil
+}
+
+// inboxCarrierFile returns the name of the carrier XML for an inbox item
+func inboxCarrierFile(item string) string {
+	return strings.TrimSuffix(item, ".zip") + ".xml"
+}
+
+// InboxItems returns the items in the inbox that haven't been tagged yet
+func (l *Library) InboxItems() []ParsedCarrier {
+	inbox := path.Join(l.LibraryDir, "inbox") + "/"
+
+	var rv []ParsedCarrier
+	for _, pc := range l.ParsedCarriers() {
+		if strings.HasPrefix(pc.Filename, inbox) && !strings.HasSuffix(pc.Filename, ".xml") {
+			rv = append(rv, pc)
+		}
+	}
+	return rv
+}
+
+// InboxItem returns the inbox item a carrier was inferred for, if it was
+func (l *Library) InboxItem(carrierID string) (ParsedCarrier, bool) {
+	for _, pc := range l.InboxItems() {
+		if pc.Carrier != nil && pc.Carrier.ID == carrierID {
+			return pc, true
+		}
+	}
+	return ParsedCarrier{}, false
+}
+
+// TagInboxItem saves a carrier for an item in the inbox. The carrier XML is
+// written next to the item, and replaces it in the library.
+func (l *Library) TagInboxItem(item ParsedCarrier, c *Carrier) (string, error) {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	filename := inboxCarrierFile(item.Filename)
+	if _, err := os.Stat(filename); err == nil {
+		return "", fmt.Errorf("%s already exists", filename)
+	}
+
+	err := c.Write(filename)
+	if err != nil {
+		return "", err
+	}
+
+	// Read the carrier back, so it's exactly what the next Refresh would find
+	pc := ParsedCarrier{Filename: filename}
+	pc.Carrier, pc.Error = ImportCarrier(filename)
+	l.replaceCarrier(item.Filename, pc)
+
+	// The draft has served its purpose
+	err = os.Remove(inboxDraftFile(item.Filename))
+	if err != nil && !os.IsNotExist(err) {
+		return filename, err
+	}
+
+	return filename, pc.Error
+}
+
+// draftSuffix is the file extension for inbox drafts
+const draftSuffix = ".draft.xml"
+
+// inboxDraftFile returns the name of the draft for an inbox item
+func inboxDraftFile(item string) string {
+	return strings.TrimSuffix(item, ".zip") + draftSuffix
+}
+
+// An inboxDraft records corrections to the carrier that was inferred for an
+// inbox item. It is saved next to the item, so that tagging a large inbox
+// can be done bit by bit. Anything left out of it is left as inferred.
+type inboxDraft struct {
+	XMLName xml.Name `xml:"https://www.inurbanus.nl/NS/speeldoos/1.0 InboxDraft"`
+
+	Name   string `xml:",omitempty"`
+	Source string `xml:"source,attr,omitempty"`
+
+	// The works in this item. Each starts at a track, and runs until the
+	// next one starts.
+	Works []draftWork `xml:"Works>Work,omitempty"`
+
+	// Part titles for individual tracks
+	Parts []draftPart `xml:"Parts>Part,omitempty"`
+}
+
+type draftWork struct {
+	// The track at which this work starts, counting from 1
+	Track int `xml:"track,attr"`
+
+	Composer   *Composer    `xml:",omitempty"`
+	Title      []Title      `xml:",omitempty"`
+	OpusNumber []OpusNumber `xml:",omitempty"`
+	Year       int          `xml:",omitempty"`
+
+	Performers      []Performer `xml:"Performers>Performer,omitempty"`
+	PerformanceYear int         `xml:",omitempty"`
+}
+
+type draftPart struct {
+	Part  string `xml:",chardata"`
+	Track int    `xml:"track,attr"`
+}
+
+func loadInboxDraft(filename string) (inboxDraft, error) {
+	var rv inboxDraft
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return rv, err
+	}
+	err = xml.Unmarshal(b, &rv)
+	if err != nil {
+		return rv, fmt.Errorf("%s: %v", filename, err)
+	}
+	return rv, nil
+}
+
+// Infer applies the draft to the carrier inferred so far
+func (d inboxDraft) Infer(pc preliminaryCarrier) preliminaryCarrier {
+	if d.Name != "" {
+		pc.Carrier.Name = d.Name
+	}
+	if d.Source != "" {
+		pc.Carrier.Source = d.Source
+	}
+
+	// Flatten the inferred performances into a list of tracks
+	type track struct {
+		SourceFile  SourceFile
+		Part        Part
+		Performance int
+	}
+	var tracks []track
+	starts := make(map[int]bool)
+	for i, pf := range pc.Carrier.Performances {
+		starts[len(tracks)] = true
+		for k, sf := range pf.SourceFiles {
+			t := track{SourceFile: sf, Performance: i}
+			if k < len(pf.Work.Parts) {
+				t.Part = pf.Work.Parts[k]
+			}
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return pc
+	}
+
+	for _, p := range d.Parts {
+		if p.Track < 1 || p.Track > len(tracks) {
+			pc.Errors = append(pc.Errors, fmt.Errorf("draft: there is no track %d", p.Track))
+			continue
+		}
+		tracks[p.Track-1].Part.Part = p.Part
+	}
+
+	// Any works in the draft replace the ones that were inferred
+	works := make(map[int]draftWork)
+	if len(d.Works) > 0 {
+		starts = map[int]bool{0: true}
+	}
+	for _, w := range d.Works {
+		if w.Track < 1 || w.Track > len(tracks) {
+			pc.Errors = append(pc.Errors, fmt.Errorf("draft: there is no track %d", w.Track))
+			continue
+		}
+		starts[w.Track-1] = true
+		works[w.Track-1] = w
+	}
+
+	var performances []Performance
+	for i := 0; i < len(tracks); {
+		end := i + 1
+		for end < len(tracks) && !starts[end] {
+			end++
+		}
+
+		// Start from the inferred performance this work's first track was in
+		orig := pc.Carrier.Performances[tracks[i].Performance]
+		pf := orig
+		if i > 0 && tracks[i-1].Performance == tracks[i].Performance {
+			pf.ID = PerformanceID{pc.Carrier.ID, i + 1}
+		}
+		pf.Work.Parts = nil
+		pf.SourceFiles = nil
+		for _, t := range tracks[i:end] {
+			pf.Work.Parts = append(pf.Work.Parts, t.Part)
+			pf.SourceFiles = append(pf.SourceFiles, t.SourceFile)
+		}
+
+		if w, ok := works[i]; ok {
+			if w.Composer != nil {
+				pf.Work.Composer = *w.Composer
+			}
+			if len(w.Title) > 0 {
+				// A proper title replaces the placeholder, including its years
+				pf.Work.Title = w.Title
+				pf.Work.Year = 0
+				pf.Year = 0
+			}
+			if len(w.OpusNumber) > 0 {
+				pf.Work.OpusNumber = w.OpusNumber
+			}
+			if w.Year != 0 {
+				pf.Work.Year = w.Year
+			}
+			if len(w.Performers) > 0 {
+				pf.Performers = w.Performers
+			}
+			if w.PerformanceYear != 0 {
+				pf.Year = w.PerformanceYear
+			}
+		}
+
+		performances = append(performances, pf)
+		i = end
+	}
+	pc.Carrier.Performances = performances
+
+	return pc
+}
+
+// SaveInboxDraft records the works and part titles in a draft carrier for an
+// inbox item, so that they are applied every time the inbox is refreshed.
+func (l *Library) SaveInboxDraft(item ParsedCarrier, c *Carrier) error {
+	d := inboxDraft{
+		Name:   c.Name,
+		Source: c.Source,
+	}
+
+	track := 1
+	for _, pf := range c.Performances {
+		w := draftWork{
+			Track:           track,
+			Title:           pf.Work.Title,
+			OpusNumber:      pf.Work.OpusNumber,
+			Year:            pf.Work.Year,
+			Performers:      pf.Performers,
+			PerformanceYear: pf.Year,
+		}
+		if pf.Work.Composer != (Composer{}) {
+			composer := pf.Work.Composer
+			w.Composer = &composer
+		}
+		d.Works = append(d.Works, w)
+
+		for k, p := range pf.Work.Parts {
+			if k < len(pf.SourceFiles) && p.Part != "" {
+				d.Parts = append(d.Parts, draftPart{Part: p.Part, Track: track + k})
+			}
+		}
+		track += len(pf.SourceFiles)
+	}
+
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	// Write to a temporary file first, so a crash halfway doesn't wipe the
+	// previous draft. Its name ends in the draft suffix, so a leftover is never
+	// mistaken for an inbox item.
+	filename := inboxDraftFile(item.Filename)
+	tmp, err := os.CreateTemp(path.Dir(filename), ".*"+draftSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := xml.NewEncoder(tmp)
+	w.Indent("", "	")
+	err = w.Encode(d)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		return err
+	}
+
+	// Only this item needs to be inferred again
+	carrier, notes, err := l.importInboxCarrier(item.Filename)
+	l.replaceCarrier(item.Filename, ParsedCarrier{
+		Filename: item.Filename,
+		Carrier:  &carrier,
+		Error:    err,
+		Notes:    notes,
+	})
 	return nil
 }
 
@@ -224,13 +635,33 @@ func (oneGiantPerformance) Infer(pc preliminaryCarrier) preliminaryCarrier {
 		Year: 2222,
 	}
 
-	// Find the longest common prefix of all path-parts
+	offset := commonPrefix(pc.SourceFiles)
+	for _, f := range pc.SourceFiles {
+		if f.Extension != "flac" {
+			continue
+		}
+		pt := strings.Join(f.Parts[offset:], " - ")
+		pf.Work.Parts = append(pf.Work.Parts, Part{
+			Part: pt[:len(pt)-5],
+		})
+		pf.SourceFiles = append(pf.SourceFiles, SourceFile{
+			Disc:     f.Disc,
+			Filename: f.Path,
+		})
+	}
+
+	pc.Carrier.Performances = append(pc.Carrier.Performances, pf)
+	return pc
+}
+
+// commonPrefix finds the number of folders all FLAC files have in common
+func commonPrefix(files []detectedFile) int {
 	offset := 0
 	ok := true
 	var firstFlac detectedFile
 	for ok {
 		ok = false
-		for _, f := range pc.SourceFiles {
+		for _, f := range files {
 			if f.Extension != "flac" {
 				continue
 			}
@@ -238,7 +669,7 @@ func (oneGiantPerformance) Infer(pc preliminaryCarrier) preliminaryCarrier {
 			if firstFlac.Path == "" {
 				firstFlac = f
 			}
-			if len(f.Parts) <= offset || f.Parts[offset] != firstFlac.Parts[offset] {
+			if len(f.Parts) <= offset+1 || f.Parts[offset] != firstFlac.Parts[offset] {
 				ok = false
 				break
 			}
@@ -247,23 +678,7 @@ func (oneGiantPerformance) Infer(pc preliminaryCarrier) preliminaryCarrier {
 			offset++
 		}
 	}
-
-	for _, f := range pc.SourceFiles {
-		if f.Extension != "flac" {
-			continue
-		}
-		pt := strings.Join(f.Parts[offset:], " - ")
-		pf.Work.Parts = append(pf.Work.Parts, Part{
-			Part: pt[:len(pt)-5],
-		})
-		pf.SourceFiles = append(pf.SourceFiles, SourceFile{
-			Disc:     f.Disc,
-			Filename: f.Path,
-		})
-	}
-
-	pc.Carrier.Performances = append(pc.Carrier.Performances, pf)
-	return pc
+	return offset
 }
 
 type stripSourcePrefix struct {
@@ -0,0 +1,357 @@
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// discFolders detects disc numbers from folder names such as 'CD1', 'disc_02'
+// or 'Disc 2', falling back to DISCNUMBER tags.
+type discFolders struct{}
+
+var discFolderPattern = regexp.MustCompile(`(?i)^(?:cd|dis[ck])[ _.-]*0*([0-9]+)$`)
+
+func (discFolders) Infer(pc preliminaryCarrier) preliminaryCarrier {
+	offset := commonPrefix(pc.SourceFiles)
+
+	total, fromFolders, fromTags := 0, 0, 0
+	discs := make(map[int]bool)
+	for i, f := range pc.SourceFiles {
+		if f.Extension != "flac" {
+			continue
+		}
+		total++
+
+		// Only look at the folders within this inbox item
+		if len(f.Parts)-1 > offset {
+			for _, folder := range f.Parts[offset : len(f.Parts)-1] {
+				if m := discFolderPattern.FindStringSubmatch(folder); m != nil {
+					f.Disc, _ = strconv.Atoi(m[1])
+				}
+			}
+		}
+
+		if f.Disc != 0 {
+			fromFolders++
+		} else if t := f.Tag("DISCNUMBER"); t != "" {
+			// Disc numbers are often written as '2/3'
+			fmt.Sscanf(t, "%d", &f.Disc)
+			if f.Disc != 0 {
+				fromTags++
+			}
+		}
+
+		if f.Disc != 0 {
+			discs[f.Disc] = true
+		}
+		pc.SourceFiles[i] = f
+	}
+
+	if len(discs) < 2 {
+		// Everything is on one disc, which doesn't need numbering
+		for i := range pc.SourceFiles {
+			pc.SourceFiles[i].Disc = 0
+		}
+		return pc
+	}
+
+	if fromFolders == total {
+		pc.note(ConfidenceHigh, "found %d discs in folder names", len(discs))
+	} else if fromFolders+fromTags == total {
+		pc.note(ConfidenceMedium, "found %d discs in folder names and DISCNUMBER tags", len(discs))
+	} else {
+		pc.note(ConfidenceLow, "found %d discs, but %d of %d files are not on any of them", len(discs), total-fromFolders-fromTags, total)
+	}
+	return pc
+}
+
+// titlePrefixWorks divides performances into works, by grouping consecutive
+// tracks whose titles start with the same work title, such as in
+// "Symphony No. 5: I. Allegro con brio"
+type titlePrefixWorks struct{}
+
+var trackNumberPattern = regexp.MustCompile(`^[0-9]+(?:[ ._-]+|$)`)
+
+// SplitTitle divides a track title, such as "Symphony No. 5: I. Allegro con
+// brio", into a work title and a part title. If it can't be divided, both
+// are the entire title.
+func SplitTitle(title string) (string, string, bool) {
+	for _, sep := range []string{": ", " - "} {
+		if i := strings.Index(title, sep); i > 0 {
+			work := strings.TrimSpace(title[:i])
+			part := strings.TrimSpace(title[i+len(sep):])
+			if work != "" && part != "" {
+				return work, part, true
+			}
+		}
+	}
+	return title, title, false
+}
+
+func (titlePrefixWorks) Infer(pc preliminaryCarrier) preliminaryCarrier {
+	var performances []Performance
+	track := 1
+
+	for _, pf := range pc.Carrier.Performances {
+		n := len(pf.SourceFiles)
+		if n < 2 {
+			performances = append(performances, pf)
+			track += n
+			continue
+		}
+
+		// Prefer titles from the tags over the file names
+		titles := make([]string, n)
+		fromTags, split := 0, 0
+		for k, sf := range pf.SourceFiles {
+			f, _ := pc.file(sf.Filename)
+			if t := f.Tag("TITLE"); t != "" {
+				titles[k] = t
+				fromTags++
+			} else {
+				name := path.Base(sf.Filename)
+				name = strings.TrimSuffix(name, path.Ext(name))
+				titles[k] = trackNumberPattern.ReplaceAllString(name, "")
+			}
+			if _, _, ok := SplitTitle(titles[k]); ok {
+				split++
+			}
+		}
+
+		if split == 0 {
+			pc.note(ConfidenceLow, "could not find any work titles in the track titles")
+			performances = append(performances, pf)
+			track += n
+			continue
+		}
+
+		works := 0
+		for k := 0; k < n; {
+			work, _, _ := SplitTitle(titles[k])
+			end := k + 1
+			for end < n {
+				if w, _, ok := SplitTitle(titles[end]); !ok || w != work {
+					break
+				}
+				end++
+			}
+
+			npf := pf
+			npf.ID = PerformanceID{pc.Carrier.ID, track + k}
+			npf.Work.Title = []Title{{Title: work}}
+			npf.Work.Year = 0
+			npf.Work.Parts = nil
+			npf.SourceFiles = append([]SourceFile{}, pf.SourceFiles[k:end]...)
+			for _, t := range titles[k:end] {
+				_, part, _ := SplitTitle(t)
+				npf.Work.Parts = append(npf.Work.Parts, Part{Part: part})
+			}
+			performances = append(performances, npf)
+			works++
+			k = end
+		}
+		track += n
+
+		c := ConfidenceHigh
+		if split < n {
+			c = ConfidenceLow
+		} else if fromTags < n {
+			c = ConfidenceMedium
+		}
+		pc.note(c, "divided %d tracks into %d works by their titles", n, works)
+	}
+
+	pc.Carrier.Performances = performances
+	return pc
+}
+
+// vorbisComments fills in composers, performers and the carrier name from
+// the tags in the FLAC files
+type vorbisComments struct{}
+
+// performerTags maps Vorbis comments to performer roles
+var performerTags = []struct {
+	Tag  string
+	Role string
+}{
+	{"PERFORMER", ""},
+	{"CONDUCTOR", "conductor"},
+	{"ORCHESTRA", "orchestra"},
+	{"ENSEMBLE", "ensemble"},
+}
+
+var performerRolePattern = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)$`)
+
+// parsePerformer reads a performer in the form of 'Name (role)'
+func parsePerformer(s, role string) Performer {
+	rv := Performer{Name: s, Role: role}
+	if m := performerRolePattern.FindStringSubmatch(s); m != nil && m[1] != "" {
+		rv.Name = m[1]
+		switch r := strings.ToLower(m[2]); r {
+		case "performer", "soloist", "orchestra", "ensemble", "conductor":
+			rv.Role = r
+		default:
+			// Probably an instrument
+			if rv.Role == "" {
+				rv.Role = "soloist"
+			}
+		}
+	}
+	if rv.Role == "" {
+		rv.Role = "performer"
+	}
+	return rv
+}
+
+func (vorbisComments) Infer(pc preliminaryCarrier) preliminaryCarrier {
+	composers, composersAgreed, performers, artists := 0, 0, 0, 0
+
+	for i, pf := range pc.Carrier.Performances {
+		var files []detectedFile
+		for _, sf := range pf.SourceFiles {
+			if f, ok := pc.file(sf.Filename); ok && f.Tags != nil {
+				files = append(files, f)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		if pf.Work.Composer.Name == "" {
+			// Go with the composer most tracks agree on
+			count := make(map[string]int)
+			best := ""
+			for _, f := range files {
+				if c := f.Tag("COMPOSER"); c != "" {
+					count[c]++
+					if count[c] > count[best] {
+						best = c
+					}
+				}
+			}
+			if best != "" {
+				pf.Work.Composer.Name = best
+				composers++
+				if count[best] == len(pf.SourceFiles) {
+					composersAgreed++
+				}
+			}
+		}
+
+		if len(pf.Performers) == 0 {
+			seen := make(map[string]bool)
+			add := func(p Performer) {
+				if p.Name != "" && p.Name != pf.Work.Composer.Name && !seen[p.Name] {
+					seen[p.Name] = true
+					pf.Performers = append(pf.Performers, p)
+				}
+			}
+			for _, f := range files {
+				for _, pt := range performerTags {
+					for _, v := range f.Tags[pt.Tag] {
+						add(parsePerformer(strings.TrimSpace(v), pt.Role))
+					}
+				}
+			}
+			if len(pf.Performers) > 0 {
+				performers++
+			} else {
+				// The artist could just as well be the composer, so this is a last resort
+				for _, f := range files {
+					for _, v := range f.Tags["ARTIST"] {
+						add(parsePerformer(strings.TrimSpace(v), ""))
+					}
+				}
+				if len(pf.Performers) > 0 {
+					artists++
+				}
+			}
+		}
+
+		if pc.Carrier.Name == "" {
+			pc.Carrier.Name = files[0].Tag("ALBUM")
+		}
+
+		pc.Carrier.Performances[i] = pf
+	}
+
+	works := len(pc.Carrier.Performances)
+	if composers > 0 {
+		c := ConfidenceHigh
+		if composersAgreed < composers {
+			c = ConfidenceMedium
+		}
+		pc.note(c, "found composers for %d of %d works in COMPOSER tags", composers, works)
+	}
+	if performers > 0 {
+		pc.note(ConfidenceMedium, "found performers for %d of %d works in PERFORMER, CONDUCTOR, ORCHESTRA and ENSEMBLE tags", performers, works)
+	}
+	if artists > 0 {
+		pc.note(ConfidenceLow, "assumed the ARTIST tag holds the performers for %d of %d works", artists, works)
+	}
+	return pc
+}
+
+// catalogueNumbers finds opus numbers and catalogue numbers in work titles
+type catalogueNumbers struct{}
+
+var cataloguePattern = regexp.MustCompile(`\b(Op(?:us)?|BWV|BuxWV|HWV|TWV|RV|Hob|KV|K|D|WoO|Wq|Sz|S|L)\.?\s*((?:[IVX]+[:/])?[0-9]+[a-z]?)(?:,?\s+(No\.?\s*[0-9]+))?`)
+
+// ambiguousIndexes are catalogue names that could just as well be something else
+var ambiguousIndexes = map[string]bool{"KV": true, "D": true, "S": true, "L": true}
+
+// ParseCatalogueNumbers finds the opus numbers and catalogue numbers (such as
+// 'BWV 232' or 'Op. 27 No. 2') in a title
+func ParseCatalogueNumbers(title string) []OpusNumber {
+	var rv []OpusNumber
+	for _, m := range cataloguePattern.FindAllStringSubmatch(title, -1) {
+		op := OpusNumber{Number: m[2]}
+		switch m[1] {
+		case "Op", "Opus":
+		case "K":
+			op.IndexName = "KV"
+		default:
+			op.IndexName = m[1]
+		}
+		if m[3] != "" {
+			op.Number += " " + m[3]
+		}
+		rv = append(rv, op)
+	}
+	return rv
+}
+
+func (catalogueNumbers) Infer(pc preliminaryCarrier) preliminaryCarrier {
+	found, ambiguous := 0, 0
+
+	for i, pf := range pc.Carrier.Performances {
+		if len(pf.Work.OpusNumber) > 0 || pf.Work.Year == 2222 {
+			// Leave existing numbers and placeholder titles alone
+			continue
+		}
+
+		for _, t := range pf.Work.Title {
+			for _, op := range ParseCatalogueNumbers(t.Title) {
+				pf.Work.OpusNumber = append(pf.Work.OpusNumber, op)
+				found++
+				if ambiguousIndexes[op.IndexName] {
+					ambiguous++
+				}
+			}
+		}
+
+		pc.Carrier.Performances[i] = pf
+	}
+
+	if found > 0 {
+		c := ConfidenceHigh
+		if ambiguous > 0 {
+			c = ConfidenceMedium
+		}
+		pc.note(c, "found %d catalogue numbers in work titles", found)
+	}
+	return pc
+}
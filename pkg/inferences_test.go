@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func inferFiles(files []detectedFile, inferences ...inference) preliminaryCarrier {
+	pc := preliminaryCarrier{
+		Carrier:     Carrier{ID: "inbox|test"},
+		SourceFiles: files,
+	}
+	for _, inf := range inferences {
+		pc = inf.Infer(pc)
+	}
+	return pc
+}
+
+func TestDiscFolders(t *testing.T) {
+	var files []detectedFile
+	for _, fn := range []string{"inbox/test/CD1/01.flac", "inbox/test/CD1/02.flac", "inbox/test/disc_02/01.flac", "inbox/test/cover.jpg"} {
+		files = append(files, detectFile(fn))
+	}
+
+	pc := inferFiles(files, discFolders{}, oneGiantPerformance{})
+	var discs []int
+	for _, sf := range pc.Carrier.Performances[0].SourceFiles {
+		discs = append(discs, sf.Disc)
+	}
+	if !reflect.DeepEqual(discs, []int{1, 1, 2}) {
+		t.Errorf("detected discs %v", discs)
+	}
+	if len(pc.Notes) != 1 || pc.Notes[0].Confidence != ConfidenceHigh {
+		t.Errorf("notes: %v", pc.Notes)
+	}
+
+	// One disc doesn't need numbering
+	pc = inferFiles(files[:2], discFolders{})
+	if pc.SourceFiles[0].Disc != 0 || len(pc.Notes) != 0 {
+		t.Errorf("a single disc got numbered: %v", pc.SourceFiles)
+	}
+}
+
+func TestTitlePrefixWorks(t *testing.T) {
+	titles := []string{
+		"Symphony No. 5 in C minor, Op. 67: I. Allegro con brio",
+		"Symphony No. 5 in C minor, Op. 67: II. Andante con moto",
+		"Egmont Overture",
+	}
+	var files []detectedFile
+	for i, title := range titles {
+		f := detectFile("inbox/test/0" + string(rune('1'+i)) + " Track.flac")
+		f.Tags = map[string][]string{
+			"TITLE":     {title},
+			"COMPOSER":  {"Ludwig van Beethoven"},
+			"PERFORMER": {"Wiener Philharmoniker (orchestra)", "Carlos Kleiber (conductor)"},
+		}
+		files = append(files, f)
+	}
+
+	pc := inferFiles(files, oneGiantPerformance{}, titlePrefixWorks{}, vorbisComments{}, catalogueNumbers{})
+	if len(pc.Carrier.Performances) != 2 {
+		t.Fatalf("expected 2 works; got %d", len(pc.Carrier.Performances))
+	}
+
+	pf := pc.Carrier.Performances[0]
+	if pf.Work.Title[0].Title != "Symphony No. 5 in C minor, Op. 67" {
+		t.Errorf("work title '%s'", pf.Work.Title[0].Title)
+	}
+	if len(pf.Work.Parts) != 2 || pf.Work.Parts[1].Part != "II. Andante con moto" {
+		t.Errorf("parts %v", pf.Work.Parts)
+	}
+	if !reflect.DeepEqual(pf.Work.OpusNumber, []OpusNumber{{Number: "67"}}) {
+		t.Errorf("opus numbers %v", pf.Work.OpusNumber)
+	}
+	if pf.Work.Composer.Name != "Ludwig van Beethoven" {
+		t.Errorf("composer '%s'", pf.Work.Composer.Name)
+	}
+	expected := []Performer{{Name: "Wiener Philharmoniker", Role: "orchestra"}, {Name: "Carlos Kleiber", Role: "conductor"}}
+	if !reflect.DeepEqual(pf.Performers, expected) {
+		t.Errorf("performers %v", pf.Performers)
+	}
+
+	pf = pc.Carrier.Performances[1]
+	if pf.ID.String() != "inbox|test-3" || pf.Work.Title[0].Title != "Egmont Overture" || len(pf.SourceFiles) != 1 {
+		t.Errorf("second work %+v", pf)
+	}
+
+	// A track without a work title makes the division doubtful
+	if len(pc.Notes) == 0 || pc.Notes[0].Confidence != ConfidenceLow {
+		t.Errorf("notes: %v", pc.Notes)
+	}
+}
+
+func TestCatalogueNumbers(t *testing.T) {
+	tests := []struct {
+		Title    string
+		Expected []OpusNumber
+	}{
+		{"Mass in B minor, BWV 232", []OpusNumber{{IndexName: "BWV", Number: "232"}}},
+		{"Piano Sonata No. 11, K. 331", []OpusNumber{{IndexName: "KV", Number: "331"}}},
+		{"Nocturne, Op. 27 No. 2", []OpusNumber{{Number: "27 No. 2"}}},
+		{"String Quartet, Hob. III:77", []OpusNumber{{IndexName: "Hob", Number: "III:77"}}},
+		{"Symphony No. 9 in D minor", nil},
+	}
+	for _, tc := range tests {
+		pc := preliminaryCarrier{
+			Carrier: Carrier{Performances: []Performance{{Work: Work{Title: []Title{{Title: tc.Title}}}}}},
+		}
+		pc = catalogueNumbers{}.Infer(pc)
+		if got := pc.Carrier.Performances[0].Work.OpusNumber; !reflect.DeepEqual(got, tc.Expected) {
+			t.Errorf("%s: expected %v, got %v", tc.Title, tc.Expected, got)
+		}
+	}
+}
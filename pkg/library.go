@@ -1,11 +1,16 @@
 package pkg
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/thijzert/speeldoos/lib/wavreader"
 	"github.com/thijzert/speeldoos/lib/ziptraverser"
@@ -15,8 +20,26 @@ import (
 type Library struct {
 	LibraryDir string
 	WAVConf    wavreader.Config
-	Carriers   []ParsedCarrier
-	zip        ziptraverser.ZipTraverser
+
+	// The carriers are replaced as a whole rather than modified in place,
+	// so a slice obtained under the read lock stays valid
+	mu       sync.RWMutex
+	carriers []ParsedCarrier
+
+	// Changes to carriers are written one at a time, so none of them get lost
+	saveMu sync.Mutex
+
+	// The cache of durations is bumped to a new generation whenever it is
+	// invalidated, so a duration that was read just before that isn't stored
+	durationMu  sync.Mutex
+	durations   map[PerformanceID]time.Duration
+	durationGen int
+
+	attachmentMu sync.Mutex
+	attachments  map[string][]Attachment
+
+	// OnRefresh, if set, is called after every successful Refresh
+	OnRefresh func()
 }
 
 // A ParsedCarrier wraps a Carrier object together with the file name it came from
@@ -29,19 +52,25 @@ type ParsedCarrier struct {
 
 	// The parse error, if applicable
 	Error error
+
+	// Notes on how the carrier was detected, for items in the inbox
+	Notes []InferenceNote
 }
 
 // NewLibrary instantiates a new Library with the specified base directory
 func NewLibrary(dir string) *Library {
 	rv := &Library{
 		LibraryDir: dir,
-		zip:        ziptraverser.New(),
 	}
 	return rv
 }
 
 // Refresh (re-)reads all XML files from disk, parsing any speeldoos files
 func (l *Library) Refresh() error {
+	// Don't let a carrier that is being saved reappear in its previous state
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
 	rv := []ParsedCarrier{}
 
 	d, err := os.Open(l.LibraryDir)
@@ -68,15 +97,43 @@ func (l *Library) Refresh() error {
 		rv = append(rv, pc)
 	}
 
-	l.Carriers = rv
+	// Publish the library and the inbox in one go, so nobody sees one without the
+	// other
+	inbox, err := l.readInbox()
+	rv = append(rv, inbox...)
 
-	return l.refreshInbox()
+	l.mu.Lock()
+	l.carriers = rv
+	l.mu.Unlock()
+
+	l.durationMu.Lock()
+	l.durations = nil
+	l.durationGen++
+	l.durationMu.Unlock()
+
+	l.attachmentMu.Lock()
+	l.attachments = nil
+	l.attachmentMu.Unlock()
+
+	if err == nil && l.OnRefresh != nil {
+		l.OnRefresh()
+	}
+	return err
+}
+
+// ParsedCarriers returns all carriers in the library, including those that
+// could not be parsed. The slice must not be modified.
+func (l *Library) ParsedCarriers() []ParsedCarrier {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.carriers
 }
 
 // AllCarriers filters all Carriers in the library, and returns those that are error-free
 func (l *Library) AllCarriers() []ParsedCarrier {
-	rv := make([]ParsedCarrier, 0, len(l.Carriers))
-	for _, pc := range l.Carriers {
+	carriers := l.ParsedCarriers()
+	rv := make([]ParsedCarrier, 0, len(carriers))
+	for _, pc := range carriers {
 		if pc.Error == nil {
 			rv = append(rv, pc)
 		}
@@ -84,9 +141,123 @@ func (l *Library) AllCarriers() []ParsedCarrier {
 	return rv
 }
 
+// GetCarrier finds a carrier in the library by its ID
+func (l *Library) GetCarrier(id string) (*Carrier, error) {
+	for _, pc := range l.ParsedCarriers() {
+		if pc.Error == nil && pc.Carrier.ID == id {
+			return pc.Carrier, nil
+		}
+	}
+	return nil, fmt.Errorf("carrier '%s' not found", id)
+}
+
+// ErrNotCarrierFile is returned when saving a carrier that wasn't read from a
+// carrier file, such as one inferred for an item in the inbox. Those are
+// saved with TagInboxItem instead.
+var ErrNotCarrierFile = errors.New("not read from a carrier file")
+
+// SaveCarrier writes a modified carrier back to the file it came from, and
+// replaces it in the library. The previous version of the file is kept with
+// a .bak extension.
+func (l *Library) SaveCarrier(c *Carrier) error {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	filename := ""
+	for _, pc := range l.ParsedCarriers() {
+		if pc.Error == nil && pc.Carrier.ID == c.ID {
+			filename = pc.Filename
+		}
+	}
+	if filename == "" {
+		return fmt.Errorf("carrier '%s' not found", c.ID)
+	}
+	if !strings.HasSuffix(filename, ".xml") {
+		return fmt.Errorf("carrier '%s': %w", c.ID, ErrNotCarrierFile)
+	}
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filename+".bak", b, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = c.Write(filename)
+	if err != nil {
+		return err
+	}
+
+	// Read the carrier back, so it's exactly what the next Refresh would find
+	pc := ParsedCarrier{Filename: filename}
+	pc.Carrier, pc.Error = ImportCarrier(filename)
+
+	l.replaceCarrier(filename, pc)
+	return pc.Error
+}
+
+// replaceCarrier swaps the carrier read from a file for another one, without
+// rescanning the library. If the library doesn't have that file, the carrier
+// is added instead.
+func (l *Library) replaceCarrier(filename string, pc ParsedCarrier) {
+	var ids []string
+	if pc.Carrier != nil {
+		ids = append(ids, pc.Carrier.ID)
+	}
+
+	l.mu.Lock()
+	carriers := make([]ParsedCarrier, 0, len(l.carriers)+1)
+	replaced := false
+	for _, old := range l.carriers {
+		if old.Filename != filename {
+			carriers = append(carriers, old)
+			continue
+		}
+		if old.Carrier != nil {
+			ids = append(ids, old.Carrier.ID)
+		}
+		if !replaced {
+			carriers = append(carriers, pc)
+			replaced = true
+		}
+	}
+	if !replaced {
+		carriers = append(carriers, pc)
+	}
+	l.carriers = carriers
+	l.mu.Unlock()
+
+	l.durationMu.Lock()
+	for id := range l.durations {
+		for _, carrierID := range ids {
+			if id.Carrier() == carrierID {
+				delete(l.durations, id)
+			}
+		}
+	}
+	l.durationGen++
+	l.durationMu.Unlock()
+
+	l.attachmentMu.Lock()
+	for _, carrierID := range ids {
+		delete(l.attachments, carrierID)
+	}
+	l.attachmentMu.Unlock()
+
+	if l.OnRefresh != nil {
+		l.OnRefresh()
+	}
+}
+
 // GetPerformance finds a performance in the library by its ID
 func (l *Library) GetPerformance(id PerformanceID) (Performance, error) {
-	for _, pc := range l.Carriers {
+	for _, pc := range l.ParsedCarriers() {
 		if pc.Error != nil {
 			continue
 		}
@@ -111,24 +282,47 @@ func (l *Library) GetWAVFromID(id PerformanceID) (wavreader.Reader, error) {
 	return l.GetWAV(pf)
 }
 
-// GetWAV opens one performance in the library and returns its raw audio data
+// GetWAV opens one performance in the library and returns its raw audio data.
+// If the length of every part is known in advance, the result is a
+// wavreader.Seeker that can seek across part boundaries.
 func (l *Library) GetWAV(pf Performance) (wavreader.Reader, error) {
+	audio, err := l.OpenAudio(pf)
+	if err == nil {
+		return newPerformanceReader(audio)
+	}
+
+	return l.getWAVSequential(pf)
+}
+
+// getWAVSequential decodes all parts of a performance in order
+func (l *Library) getWAVSequential(pf Performance) (wavreader.Reader, error) {
+	// The returned reader gets a zip traverser of its own, as they can't be
+	// shared between goroutines. It's closed once all parts have been read.
+	zm := ziptraverser.New()
+	decoding := false
+	defer func() {
+		if !decoding {
+			zm.Close()
+		}
+	}()
+
 	var format wavreader.StreamFormat
 	bps := 0
 	fixedSize := 0
 	for i, f := range pf.SourceFiles {
-		fl, er := l.zip.Get(path.Join(l.LibraryDir, f.Filename))
+		fl, er := zm.Get(path.Join(l.LibraryDir, f.Filename))
 		if er != nil {
 			return nil, er
 		}
-		defer fl.Close()
 
 		ww, er := l.WAVConf.FromFLAC(fl)
 		if er != nil {
+			fl.Close()
 			return nil, er
 		}
 		ww.Init()
 		ww.Close()
+		fl.Close()
 
 		if i == 0 {
 			format = ww.Format()
@@ -142,35 +336,142 @@ func (l *Library) GetWAV(pf Performance) (wavreader.Reader, error) {
 		if ww.Size() == 0 || (ww.Size()%bps) != 0 {
 			return nil, fmt.Errorf("wav length (%d) is not a multiple of bytes per sample (%d)", ww.Size(), bps)
 		}
-		fixedSize += ww.Size()
+		start, end, er := f.sampleRange(int64(ww.Size() / bps))
+		if er != nil {
+			return nil, er
+		}
+		fixedSize += int(end-start) * bps
 	}
 
 	rv, wri := wavreader.Pipe(format)
 	rv.SetSize(fixedSize)
 
+	decoding = true
 	go func() {
+		defer zm.Close()
+
 		for _, f := range pf.SourceFiles {
-			fl, er := l.zip.Get(path.Join(l.LibraryDir, f.Filename))
+			fl, er := zm.Get(path.Join(l.LibraryDir, f.Filename))
 			if er != nil {
 				wri.CloseWithError(er)
+				return
 			}
-			defer fl.Close()
 
-			ww, er := l.WAVConf.FromFLAC(fl)
+			ww, er := DecodeSourceFile(l.WAVConf, fl, f)
 			if er != nil {
+				fl.Close()
 				wri.CloseWithError(er)
+				return
 			}
-			ww.Init()
 
 			_, er = io.Copy(wri, ww)
+			ww.Close()
+			fl.Close()
 			if er != nil {
 				wri.CloseWithError(er)
+				return
 			}
-
-			ww.Close()
 		}
 
 		wri.Close()
 	}()
 	return rv, nil
 }
+
+// Duration returns the playing time of a performance, as recorded in the
+// metadata of its source files. Durations are cached, since establishing them
+// involves opening every source file.
+func (l *Library) Duration(pf Performance) (time.Duration, error) {
+	l.durationMu.Lock()
+	d, ok := l.durations[pf.ID]
+	gen := l.durationGen
+	l.durationMu.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	// Don't keep others waiting while the source files are read
+	zm := ziptraverser.New()
+	defer zm.Close()
+
+	var rv time.Duration
+	for _, f := range pf.SourceFiles {
+		fl, err := zm.Get(path.Join(l.LibraryDir, f.Filename))
+		if err != nil {
+			return 0, err
+		}
+
+		fi, err := wavreader.ReadFLACInfo(fl)
+		fl.Close()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", f.Filename, err)
+		}
+		if fi.TotalSamples == 0 {
+			return 0, fmt.Errorf("%s: unknown stream length", f.Filename)
+		}
+
+		start, end, err := f.sampleRange(fi.TotalSamples)
+		if err != nil {
+			return 0, err
+		}
+		rv += time.Duration(end-start) * time.Second / time.Duration(fi.Format.Rate)
+	}
+
+	l.durationMu.Lock()
+	if l.durationGen == gen {
+		if l.durations == nil {
+			l.durations = make(map[PerformanceID]time.Duration)
+		}
+		l.durations[pf.ID] = rv
+	}
+	l.durationMu.Unlock()
+
+	return rv, nil
+}
+
+// SourceHash returns a hash that identifies the audio content of a
+// performance. Where possible, it uses the MD5 signatures stored in the FLAC
+// headers; source files without one are hashed in their entirety.
+func (l *Library) SourceHash(pf Performance) (string, error) {
+	zm := ziptraverser.New()
+	defer zm.Close()
+
+	h := sha256.New()
+	for _, f := range pf.SourceFiles {
+		filename := path.Join(l.LibraryDir, f.Filename)
+		fl, err := zm.Get(filename)
+		if err != nil {
+			return "", err
+		}
+
+		fi, err := wavreader.ReadFLACInfo(fl)
+		fl.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", f.Filename, err)
+		}
+
+		if f.Ranged() {
+			// Several tracks may share one file
+			fmt.Fprintf(h, "range:%d:%d\n", f.Start, f.End)
+		}
+
+		if fi.MD5 != [16]byte{} {
+			fmt.Fprintf(h, "md5:%x:%d:%s\n", fi.MD5, fi.TotalSamples, fi.Format)
+			continue
+		}
+
+		fl, err = zm.Get(filename)
+		if err != nil {
+			return "", err
+		}
+		fh := sha256.New()
+		_, err = io.Copy(fh, fl)
+		fl.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", f.Filename, err)
+		}
+		fmt.Fprintf(h, "sha256:%x\n", fh.Sum(nil))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,352 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveCarrier(t *testing.T) {
+	dir := t.TempDir()
+	orig := []byte(`<Carrier xmlns="https://www.inurbanus.nl/NS/speeldoos/1.0"><Name>Test</Name><ID>ABC-1</ID>` +
+		`<Performances><Performance><Work><Composer><Name>Bach</Name></Composer><Title>Mass</Title></Work><SourceFiles><File>a.flac</File></SourceFiles></Performance></Performances>` +
+		`</Carrier>`)
+	filename := filepath.Join(dir, "abc.xml")
+	if err := os.WriteFile(filename, orig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.flac"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLibrary(dir)
+	if err := os.Mkdir(filepath.Join(dir, "inbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	refreshed := 0
+	l.OnRefresh = func() { refreshed++ }
+
+	c, err := l.GetCarrier("ABC-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := *c
+	edited.Performances = append([]Performance{}, c.Performances...)
+	edited.Performances[0].Work.Composer.Name = "J.S. Bach"
+
+	errs := CheckCarrier(&edited, dir)
+	if len(errs) != 1 {
+		t.Fatalf("expected one problem; got %v", errs)
+	} else if _, ok := errs[0].(FixableError); !ok {
+		t.Errorf("expected the missing composer ID to be fixed; got %v", errs[0])
+	}
+	if id := edited.Performances[0].Work.Composer.ID; id != "J.S._Bach" {
+		t.Errorf("composer ID is '%s'", id)
+	}
+	if c.Performances[0].Work.Composer.Name != "Bach" {
+		t.Errorf("the carrier in the library changed before saving")
+	}
+
+	if err := l.SaveCarrier(&edited); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(filename + ".bak"); err != nil || string(b) != string(orig) {
+		t.Errorf("backup: got '%s' (%v)", b, err)
+	}
+
+	c, err = l.GetCarrier("ABC-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Performances[0].Work.Composer.Name != "J.S. Bach" {
+		t.Errorf("the library still contains the old version of the carrier")
+	}
+	if c.Performances[0].ID.String() != "ABC-1-1" {
+		t.Errorf("performance ID is '%s'", c.Performances[0].ID)
+	}
+	if refreshed != 1 {
+		t.Errorf("OnRefresh was called %d times", refreshed)
+	}
+
+	if err := l.SaveCarrier(&Carrier{ID: "DEF-2"}); err == nil {
+		t.Errorf("saved a carrier that isn't in the library")
+	}
+}
+
+func TestTagInboxItem(t *testing.T) {
+	dir := t.TempDir()
+	album := filepath.Join(dir, "inbox", "My Album")
+	if err := os.MkdirAll(album, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"01 Track.flac", "02 Track.flac"} {
+		if err := os.WriteFile(filepath.Join(album, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := NewLibrary(dir)
+	if err := l.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	items := l.InboxItems()
+	if len(items) != 1 {
+		t.Fatalf("expected one inbox item; got %d", len(items))
+	}
+
+	c := &Carrier{
+		ID:   "XYZ-1",
+		Name: "My Album",
+		Performances: []Performance{
+			{
+				Work:        Work{Composer: Composer{Name: "Bach", ID: "Bach"}, Title: []Title{{Title: "Mass"}}},
+				SourceFiles: items[0].Carrier.Performances[0].SourceFiles,
+			},
+		},
+	}
+	filename, err := l.TagInboxItem(items[0], c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != album+".xml" {
+		t.Errorf("carrier was written to '%s'", filename)
+	}
+
+	if items := l.InboxItems(); len(items) != 0 {
+		t.Errorf("the tagged item is still in the inbox")
+	}
+	if _, err := l.GetCarrier("XYZ-1"); err != nil {
+		t.Errorf("the tagged carrier is not in the library: %v", err)
+	}
+
+	if _, err := l.TagInboxItem(items[0], c); err == nil {
+		t.Errorf("overwrote an existing carrier")
+	}
+}
+
+func TestSaveInboxCarrier(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "inbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	album := filepath.Join(dir, "inbox", "My Album.zip")
+	f, err := os.Create(album)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	if _, err := zw.Create("01 Track.flac"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	orig, err := os.ReadFile(album)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLibrary(dir)
+	if err := l.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	items := l.InboxItems()
+	if len(items) != 1 || items[0].Carrier == nil {
+		t.Fatalf("expected one inbox item; got %v", items)
+	}
+
+	if item, ok := l.InboxItem(items[0].Carrier.ID); !ok || item.Filename != album {
+		t.Errorf("carrier '%s' was not recognised as an inbox item", items[0].Carrier.ID)
+	}
+
+	c := *items[0].Carrier
+	c.Name = "My Album"
+	if err := l.SaveCarrier(&c); !errors.Is(err, ErrNotCarrierFile) {
+		t.Errorf("saving an inbox carrier: got error %v; expected %v", err, ErrNotCarrierFile)
+	}
+	if b, err := os.ReadFile(album); err != nil || !bytes.Equal(b, orig) {
+		t.Errorf("the inbox item was overwritten")
+	}
+	if _, err := os.Stat(album + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("a backup was made of the inbox item")
+	}
+}
+
+func TestInboxDraft(t *testing.T) {
+	dir := t.TempDir()
+	album := filepath.Join(dir, "inbox", "My Album")
+	if err := os.MkdirAll(album, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"01 Kyrie.flac", "02 Gloria.flac", "03 Prelude.flac", "04 Fugue.flac"} {
+		if err := os.WriteFile(filepath.Join(album, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Corrections can be partial: only the works and one part title are given here
+	draft := []byte(`<InboxDraft xmlns="https://www.inurbanus.nl/NS/speeldoos/1.0">` +
+		`<Works><Work track="1"><Composer><Name>Bach</Name></Composer><Title>Mass</Title></Work><Work track="3"></Work></Works>` +
+		`<Parts><Part track="2">Gloria in excelsis</Part></Parts>` +
+		`</InboxDraft>`)
+	if err := os.WriteFile(album+".draft.xml", draft, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLibrary(dir)
+	if err := l.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	items := l.InboxItems()
+	if len(items) != 1 {
+		t.Fatalf("expected one inbox item; got %d", len(items))
+	}
+	if items[0].Error != nil {
+		t.Fatal(items[0].Error)
+	}
+	c := items[0].Carrier
+	if len(c.Performances) != 2 {
+		t.Fatalf("expected 2 works; got %d", len(c.Performances))
+	}
+
+	pf := c.Performances[0]
+	if pf.Work.Composer.Name != "Bach" || len(pf.Work.Title) != 1 || pf.Work.Title[0].Title != "Mass" || pf.Work.Year != 0 {
+		t.Errorf("the first work is %+v", pf.Work)
+	}
+	if len(pf.Work.Parts) != 2 || pf.Work.Parts[0].Part != "01 Kyrie" || pf.Work.Parts[1].Part != "Gloria in excelsis" {
+		t.Errorf("the first work has parts %v", pf.Work.Parts)
+	}
+
+	pf = c.Performances[1]
+	if pf.Work.Year != 2222 || len(pf.SourceFiles) != 2 || pf.SourceFiles[0].Filename != "inbox/My Album/03 Prelude.flac" {
+		t.Errorf("the second work is %+v", pf)
+	}
+	if pf.ID.String() != "inbox|My Album-3" {
+		t.Errorf("the second work has ID '%s'", pf.ID)
+	}
+
+	// Saving a draft replaces the previous one
+	edited := *c
+	edited.Name = "Mass and fugue"
+	edited.Performances = append([]Performance{}, c.Performances...)
+	edited.Performances[1].Work.Title = []Title{{Title: "Prelude and fugue"}}
+	if err := l.SaveInboxDraft(items[0], &edited); err != nil {
+		t.Fatal(err)
+	}
+
+	c = l.InboxItems()[0].Carrier
+	if c.Name != "Mass and fugue" || len(c.Performances) != 2 || c.Performances[1].Work.Title[0].Title != "Prelude and fugue" {
+		t.Errorf("the saved draft was not applied: %+v", c)
+	}
+	if c.Performances[0].Work.Parts[1].Part != "Gloria in excelsis" {
+		t.Errorf("part titles were lost")
+	}
+
+	// Once the item is tagged, the draft is no longer needed
+	if _, err := l.TagInboxItem(l.InboxItems()[0], &Carrier{ID: "XYZ-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(album + ".draft.xml"); !os.IsNotExist(err) {
+		t.Errorf("the draft still exists")
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	dir := t.TempDir()
+	carrier := []byte(`<Carrier xmlns="https://www.inurbanus.nl/NS/speeldoos/1.0"><Name>Test</Name><ID>ABC-1</ID>` +
+		`<Performances><Performance><Work><Composer><Name>Bach</Name></Composer><Title>Mass</Title></Work><SourceFiles><File>a.flac</File></SourceFiles></Performance></Performances>` +
+		`</Carrier>`)
+	if err := os.WriteFile(filepath.Join(dir, "abc.xml"), carrier, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "inbox", "Some Album"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "inbox", "Some Album", "01.flac"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLibrary(dir)
+	if err := l.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers should always see the entire library, inbox included
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := l.Refresh(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if n := len(l.ParsedCarriers()); n != 2 {
+			t.Errorf("expected 2 carriers; got %d", n)
+			<-done
+			return
+		}
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"ABC-1", "DEF-2"} {
+		carrier := []byte(`<Carrier xmlns="https://www.inurbanus.nl/NS/speeldoos/1.0"><Name>Test</Name><ID>` + id + `</ID>` +
+			`<Performances><Performance><Work><Composer><Name>Bach</Name></Composer><Title>Mass</Title></Work><SourceFiles><File>a.flac</File></SourceFiles></Performance></Performances>` +
+			`</Carrier>`)
+		if err := os.WriteFile(filepath.Join(dir, id+".xml"), carrier, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "inbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLibrary(dir)
+	if err := l.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing two carriers at once should keep both edits
+	errs := make(chan error, 2)
+	for _, id := range []string{"ABC-1", "DEF-2"} {
+		c, err := l.GetCarrier(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edited := *c
+		edited.Name = "Edited " + id
+		go func() {
+			errs <- l.SaveCarrier(&edited)
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, id := range []string{"ABC-1", "DEF-2"} {
+		if c, err := l.GetCarrier(id); err != nil || c.Name != "Edited "+id {
+			t.Errorf("%s: %v (%v)", id, c, err)
+		}
+	}
+}
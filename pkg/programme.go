@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	rand "github.com/thijzert/speeldoos/lib/properrandom"
+)
+
+// The maximum number of performances considered when filling a time slot
+const maxProgrammeCandidates = 250
+
+// A Programme is a selection of performances that fills a time slot
+type Programme struct {
+	// Window is the length of the time slot
+	Window time.Duration
+
+	// Queued is the playing time taken up by performances that were already queued
+	Queued time.Duration
+
+	// The performances selected to fill the remainder of the time slot
+	Performances []Performance
+
+	// Scheduled is the total playing time of the selected performances
+	Scheduled time.Duration
+}
+
+// Slack returns the part of the time slot left unfilled
+func (p Programme) Slack() time.Duration {
+	return p.Window - p.Queued - p.Scheduled
+}
+
+// Fill returns the fraction of the time slot that will be filled
+func (p Programme) Fill() float64 {
+	if p.Window <= 0 {
+		return 0
+	}
+	return float64(p.Queued+p.Scheduled) / float64(p.Window)
+}
+
+func (p Programme) String() string {
+	return fmt.Sprintf("%d performances in %s; %s left unfilled (%.1f%% filled)", len(p.Performances), p.Window, p.Slack(), 100.0*p.Fill())
+}
+
+// ParseWindow interprets a time slot specification. This is either a
+// duration (e.g. "90m" or "1h30m"), or a wall clock time (e.g. "23:00") at
+// which the time slot should end.
+func ParseWindow(spec string, now time.Time) (time.Duration, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return 0, errors.New("the time slot must be positive")
+		}
+		return d, nil
+	}
+
+	t, err := time.ParseInLocation("15:04", spec, now.Location())
+	if err != nil {
+		return 0, fmt.Errorf("invalid time slot '%s': use a duration like '90m' or a time like '23:00'", spec)
+	}
+
+	end := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end.Sub(now), nil
+}
+
+// FillWindow selects performances from the library that fill a time slot as
+// completely as possible. Performances that are already queued count towards
+// the time slot, and will not be selected again.
+func (l *Library) FillWindow(window time.Duration, queued []PerformanceID) (Programme, error) {
+	rv := Programme{
+		Window: window,
+	}
+
+	skip := make(map[PerformanceID]bool)
+	for _, id := range queued {
+		skip[id] = true
+
+		pf, err := l.GetPerformance(id)
+		if err != nil {
+			continue
+		}
+		d, err := l.Duration(pf)
+		if err != nil {
+			return rv, err
+		}
+		rv.Queued += d
+	}
+
+	remaining := window - rv.Queued
+	if remaining <= 0 {
+		return rv, nil
+	}
+
+	var pool []Performance
+	for _, pc := range l.AllCarriers() {
+		for _, pf := range pc.Carrier.Performances {
+			if !skip[pf.ID] {
+				pool = append(pool, pf)
+			}
+		}
+	}
+	if len(pool) == 0 {
+		return rv, errors.New("no performances found in your library")
+	}
+
+	rand.Shuffle(len(pool), func(i, j int) {
+		pool[i], pool[j] = pool[j], pool[i]
+	})
+
+	var candidates []Performance
+	var durations []time.Duration
+	for _, pf := range pool {
+		if len(candidates) >= maxProgrammeCandidates {
+			break
+		}
+		d, err := l.Duration(pf)
+		if err != nil || d <= 0 || d > remaining {
+			continue
+		}
+		candidates = append(candidates, pf)
+		durations = append(durations, d)
+	}
+
+	for _, i := range fillKnapsack(durations, remaining) {
+		rv.Performances = append(rv.Performances, candidates[i])
+		rv.Scheduled += durations[i]
+	}
+
+	return rv, nil
+}
+
+// fillKnapsack selects a subset of items whose combined duration fits within
+// the window and comes as close to it as possible. The indices of the
+// selected items are returned in ascending order.
+func fillKnapsack(durations []time.Duration, window time.Duration) []int {
+	// Round durations up to whole seconds, so the selection never overruns
+	W := int(window / time.Second)
+	weights := make([]int, len(durations))
+	for i, d := range durations {
+		weights[i] = int((d + time.Second - 1) / time.Second)
+	}
+
+	// reachedBy[w] holds the index of the first item with which a total of
+	// exactly w seconds could be reached, or -1 if it can't be reached.
+	// Because each item is only considered once, w-weights[reachedBy[w]] was
+	// necessarily reached by an earlier item.
+	reachedBy := make([]int, W+1)
+	for w := range reachedBy {
+		reachedBy[w] = -1
+	}
+
+	best := 0
+	for i, wt := range weights {
+		if wt <= 0 || wt > W {
+			continue
+		}
+		for w := W; w >= wt; w-- {
+			if reachedBy[w] >= 0 || (w != wt && reachedBy[w-wt] < 0) {
+				continue
+			}
+			reachedBy[w] = i
+			if w > best {
+				best = w
+			}
+		}
+		if best == W {
+			break
+		}
+	}
+
+	var rv []int
+	for w := best; w > 0; w -= weights[reachedBy[w]] {
+		rv = append(rv, reachedBy[w])
+	}
+	sort.Ints(rv)
+
+	return rv
+}
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFillKnapsack(t *testing.T) {
+	min := time.Minute
+
+	tests := []struct {
+		Durations []time.Duration
+		Window    time.Duration
+		Expected  time.Duration
+	}{
+		{[]time.Duration{50 * min, 35 * min, 25 * min, 45 * min}, 90 * min, 85 * min},
+		{[]time.Duration{80 * min, 30 * min, 20 * min, 40 * min}, 90 * min, 90 * min},
+		{[]time.Duration{100 * min, 120 * min}, 90 * min, 0},
+		{[]time.Duration{45 * min, 45 * min, 45 * min}, 90 * min, 90 * min},
+		{[]time.Duration{10*min + 500*time.Millisecond, 80 * min}, 90 * min, 80 * min},
+		{nil, 90 * min, 0},
+	}
+
+	for _, tc := range tests {
+		sel := fillKnapsack(tc.Durations, tc.Window)
+
+		var total time.Duration
+		seen := make(map[int]bool)
+		for _, i := range sel {
+			if seen[i] {
+				t.Errorf("%v: item %d selected twice", tc.Durations, i)
+			}
+			seen[i] = true
+			total += tc.Durations[i]
+		}
+
+		if total != tc.Expected {
+			t.Errorf("%v: expected to fill %s of %s, got %s (%v)", tc.Durations, tc.Expected, tc.Window, total, sel)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	now := time.Date(2021, 3, 14, 21, 55, 0, 0, time.UTC)
+
+	tests := []struct {
+		Spec     string
+		Expected time.Duration
+	}{
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"23:00", 65 * time.Minute},
+		{"07:30", 9*time.Hour + 35*time.Minute},
+	}
+
+	for _, tc := range tests {
+		d, err := ParseWindow(tc.Spec, now)
+		if err != nil {
+			t.Errorf("%s: %v", tc.Spec, err)
+		} else if d != tc.Expected {
+			t.Errorf("%s: expected %s, got %s", tc.Spec, tc.Expected, d)
+		}
+	}
+
+	for _, spec := range []string{"", "-5m", "25:00", "eventually"} {
+		if _, err := ParseWindow(spec, now); err == nil {
+			t.Errorf("'%s' should not parse as a time slot", spec)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"io"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	rand "github.com/thijzert/speeldoos/lib/properrandom"
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
@@ -16,8 +18,28 @@ type Scheduler struct {
 
 	QueueMutex sync.RWMutex
 	PlayQueue  []PerformanceID
+
+	// The performances scheduled most recently, oldest first. This is
+	// guarded by QueueMutex as well.
+	History []PerformanceID
+
+	// If set, Filter restricts which performances are picked once the play
+	// queue runs out
+	Filter func(Performance) bool
+
+	// If StopAfterQueue is set, the scheduler closes the audio stream once the
+	// play queue runs out, rather than continuing with random performances.
+	StopAfterQueue bool
+
+	decodeErrors int64
+
+	// Only one FillWindow at a time, so they don't schedule the same thing
+	fillMutex sync.Mutex
 }
 
+// HistoryLength is the number of performances a Scheduler remembers
+const HistoryLength = 100
+
 func (l *Library) NewScheduler(wc chunker.WAVChunkConfig) (*Scheduler, error) {
 	var err error
 	rv := &Scheduler{
@@ -32,28 +54,102 @@ func (l *Library) NewScheduler(wc chunker.WAVChunkConfig) (*Scheduler, error) {
 	return rv, nil
 }
 
+// Run keeps the audio stream fed until ctx is done, after which the audio
+// stream is closed.
 func (s *Scheduler) Run(ctx context.Context) {
+	defer s.AudioStream.Close()
+
 	for ctx.Err() == nil {
+		if s.StopAfterQueue && s.queueLength() == 0 {
+			return
+		}
+
 		performance := s.NextPerformance()
 
 		w, err := s.Library.GetWAV(performance)
 		if err != nil {
+			atomic.AddInt64(&s.decodeErrors, 1)
 			log.Printf("%v", err)
 			continue
 		}
 
 		s.AudioStream.SetAssociatedData(performance)
+		s.remember(performance.ID)
 		log.Printf("Queued: %s - %s", performance.Work.Composer.Name, performance.Work.Title[0].Title)
 
-		_, err = io.Copy(s.AudioStream, w)
+		_, err = io.Copy(s.AudioStream, contextReader{ctx, w})
+		w.Close()
 
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
-		w.Close()
 	}
 }
 
+// A contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(buf []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(buf)
+}
+
+// remember adds a performance to the history
+func (s *Scheduler) remember(id PerformanceID) {
+	s.QueueMutex.Lock()
+	defer s.QueueMutex.Unlock()
+
+	s.History = append(s.History, id)
+	if len(s.History) > HistoryLength {
+		s.History = append(s.History[:0], s.History[len(s.History)-HistoryLength:]...)
+	}
+}
+
+// DecodeErrors returns the number of performances that couldn't be played
+func (s *Scheduler) DecodeErrors() int64 {
+	return atomic.LoadInt64(&s.decodeErrors)
+}
+
+func (s *Scheduler) queueLength() int {
+	s.QueueMutex.RLock()
+	defer s.QueueMutex.RUnlock()
+	return len(s.PlayQueue)
+}
+
+// FillWindow appends performances to the play queue that fill a time slot,
+// starting after anything that's already queued.
+func (s *Scheduler) FillWindow(window time.Duration) (Programme, error) {
+	// Working out the programme means reading source files, so do that on a
+	// copy of the queue. The queue keeps playing in the meantime.
+	s.fillMutex.Lock()
+	defer s.fillMutex.Unlock()
+
+	s.QueueMutex.RLock()
+	queued := append([]PerformanceID{}, s.PlayQueue...)
+	s.QueueMutex.RUnlock()
+
+	prog, err := s.Library.FillWindow(window, queued)
+	if err != nil {
+		return prog, err
+	}
+
+	s.QueueMutex.Lock()
+	for _, pf := range prog.Performances {
+		s.PlayQueue = append(s.PlayQueue, pf.ID)
+	}
+	s.QueueMutex.Unlock()
+
+	return prog, nil
+}
+
 func (s *Scheduler) NextPerformance() Performance {
 	s.QueueMutex.Lock()
 	for len(s.PlayQueue) > 0 {
@@ -73,7 +169,16 @@ func (s *Scheduler) NextPerformance() Performance {
 
 	for _, car := range s.Library.AllCarriers() {
 		for _, pf := range car.Carrier.Performances {
-			pfii = append(pfii, pf)
+			if s.Filter == nil || s.Filter(pf) {
+				pfii = append(pfii, pf)
+			}
+		}
+	}
+
+	if len(pfii) == 0 && s.Filter != nil {
+		log.Printf("No performances match this scheduler's filter; picking from the whole library instead")
+		for _, car := range s.Library.AllCarriers() {
+			pfii = append(pfii, car.Carrier.Performances...)
 		}
 	}
 
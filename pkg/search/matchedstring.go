@@ -169,6 +169,12 @@ func (ms MatchedString) String() string {
 	return ms.base
 }
 
+// MarshalText implements encoding.TextMarshaler. Only the base string is
+// encoded; highlights are lost.
+func (ms MatchedString) MarshalText() ([]byte, error) {
+	return []byte(ms.base), nil
+}
+
 func (ms MatchedString) IsEmpty() bool {
 	return len(ms.highlights) == 0
 }
@@ -35,7 +35,7 @@ func (q Query) Search(lib *speeldoos.Library) []Result {
 		for _, perf := range carrier.Carrier.Performances {
 			res := q.rootMatcher.GetResult(perf)
 
-			if res.Relevance.Match > 0 && res.Relevance.Relevance() >= q.MinimalRelevance {
+			if q.relevant(res) {
 				rv.Results = append(rv.Results, res)
 			}
 		}
@@ -46,6 +46,15 @@ func (q Query) Search(lib *speeldoos.Library) []Result {
 	return rv.Results
 }
 
+// Matches tests if a single performance matches the query
+func (q Query) Matches(perf speeldoos.Performance) bool {
+	return q.relevant(q.rootMatcher.GetResult(perf))
+}
+
+func (q Query) relevant(res Result) bool {
+	return res.Relevance.Match > 0 && res.Relevance.Relevance() >= q.MinimalRelevance
+}
+
 type matcherNode struct {
 	f StringMatcher
 }
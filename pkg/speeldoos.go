@@ -91,6 +91,34 @@ type SourceFile struct {
 
 	// The disc number, if applicable.
 	Disc int `xml:"disc,attr,omitempty"`
+
+	// The International Standard Recording Code of this track, if known
+	ISRC string `xml:"isrc,attr,omitempty"`
+
+	// If only part of the file belongs to this track (e.g. in a single-file
+	// rip), the first sample of that part, and the sample after its last.
+	// Samples are counted per channel from the start of the file, and an end
+	// of 0 means the end of the file.
+	Start int64 `xml:"start,attr,omitempty"`
+	End   int64 `xml:"end,attr,omitempty"`
+}
+
+// Ranged returns true if only part of the file belongs to this source file
+func (s SourceFile) Ranged() bool {
+	return s.Start != 0 || s.End != 0
+}
+
+// sampleRange returns the range of samples that belong to this source file,
+// given the total number of samples in the file
+func (s SourceFile) sampleRange(total int64) (int64, int64, error) {
+	start, end := s.Start, total
+	if s.End != 0 {
+		end = s.End
+	}
+	if start < 0 || end > total || start >= end {
+		return 0, 0, fmt.Errorf("%s: samples %d to %d are outside of the file, which has %d samples", s.Filename, start, end, total)
+	}
+	return start, end, nil
 }
 
 func (s SourceFile) String() string {
@@ -121,6 +149,21 @@ func (p PerformanceID) String() string {
 	return fmt.Sprintf("%s-%d", p.carrierID, p.track)
 }
 
+// MarshalText implements encoding.TextMarshaler
+func (p PerformanceID) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (p *PerformanceID) UnmarshalText(b []byte) error {
+	rv, err := ParsePerformanceID(string(b))
+	if err != nil {
+		return err
+	}
+	*p = rv
+	return nil
+}
+
 // Carrier returns the Carrier ID
 func (p PerformanceID) Carrier() string {
 	return p.carrierID
@@ -166,6 +209,12 @@ type Carrier struct {
 
 	// The performances on this carrier
 	Performances []Performance `xml:"Performances>Performance"`
+
+	// Artwork, booklets and other files that accompany the audio
+	Attachments []Attachment `xml:"Attachments>Attachment,omitempty"`
+
+	// The results of checking the audio against the logs of the rips it came from
+	Rips []RipVerification `xml:"Rips>Rip,omitempty"`
 }
 
 // ImportCarrier reads a serialized Carrier from a file
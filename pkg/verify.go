@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/cdrip"
+	"github.com/thijzert/speeldoos/lib/wavreader"
+	"github.com/thijzert/speeldoos/lib/ziptraverser"
+)
+
+// A RipVerification records how the audio of one disc compares to the log of
+// the rip it came from
+type RipVerification struct {
+	// The disc number, if applicable.
+	Disc int `xml:"disc,attr,omitempty"`
+
+	// The log file, relative to the library directory
+	Log string `xml:"log,attr"`
+
+	// The program that ripped the disc
+	Ripper string `xml:"ripper,attr,omitempty"`
+
+	// Whether the ripper signed the log, and if so, if the signature holds:
+	// "valid", "invalid", "missing" or "unsupported"
+	LogChecksum string `xml:"log-checksum,attr"`
+
+	// For discs that were ripped to one file, whether the CRC in the log
+	// matches all tracks together
+	CRC Verdict `xml:"crc,attr,omitempty"`
+
+	// When the audio was checked
+	Date string `xml:"date,attr"`
+
+	Tracks []TrackVerification `xml:"Track"`
+}
+
+// A TrackVerification records how the audio of one track compares to the
+// checksums in the log
+type TrackVerification struct {
+	Number   int    `xml:"number,attr"`
+	Filename string `xml:",chardata"`
+
+	// The checksums of the audio in the library
+	CRC32         string `xml:"crc32,attr"`
+	AccurateRipV1 string `xml:"accuraterip-v1,attr"`
+	AccurateRipV2 string `xml:"accuraterip-v2,attr"`
+
+	// The CRC of the copy in the log, and whether it matches
+	LogCRC32 string  `xml:"log-crc32,attr,omitempty"`
+	CRC      Verdict `xml:"crc,attr,omitempty"`
+
+	// Whether the AccurateRip checksums match the ones in the log, and if
+	// so, the confidence the ripper found in the AccurateRip database
+	AccurateRip Verdict `xml:"accuraterip,attr,omitempty"`
+	Confidence  int     `xml:"confidence,attr,omitempty"`
+}
+
+// A Verdict tells if a checksum matches the one in the log. It's empty if the
+// log doesn't have one.
+type Verdict string
+
+// The possible verdicts
+const (
+	VerdictMatch    Verdict = "match"
+	VerdictMismatch Verdict = "mismatch"
+)
+
+// OK returns false if the log has been tampered with, or if any checksum
+// doesn't match
+func (r RipVerification) OK() bool {
+	if r.LogChecksum == cdrip.ChecksumInvalid.String() || r.CRC == VerdictMismatch {
+		return false
+	}
+	for _, t := range r.Tracks {
+		if t.CRC == VerdictMismatch || t.AccurateRip == VerdictMismatch {
+			return false
+		}
+	}
+	return true
+}
+
+// SetRipVerification records the results of a verification in the carrier,
+// replacing any earlier results for the same disc
+func (c *Carrier) SetRipVerification(v RipVerification) {
+	for i, r := range c.Rips {
+		if r.Disc == v.Disc {
+			c.Rips[i] = v
+			return
+		}
+	}
+	c.Rips = append(c.Rips, v)
+}
+
+// ReadRipLog reads an EAC or XLD log file from the library
+func (l *Library) ReadRipLog(filename string) (*cdrip.RipLog, error) {
+	zm := ziptraverser.New()
+	defer zm.Close()
+
+	f, err := zm.Get(path.Join(l.LibraryDir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rv, err := cdrip.ParseRipLog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return rv, nil
+}
+
+// VerifyRip decodes the audio of one disc of a carrier, and compares its
+// checksums to those in the log of the rip it came from
+func (l *Library) VerifyRip(c *Carrier, disc int, logFilename string, rl *cdrip.RipLog) (RipVerification, error) {
+	rv := RipVerification{
+		Disc:        disc,
+		Log:         logFilename,
+		Ripper:      rl.Ripper,
+		LogChecksum: rl.Checksum.String(),
+		Date:        time.Now().UTC().Format(time.RFC3339),
+	}
+
+	var files []SourceFile
+	for _, pf := range c.Performances {
+		for _, sf := range pf.SourceFiles {
+			if sf.Disc == disc {
+				files = append(files, sf)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return rv, fmt.Errorf("disc %d has no source files", disc)
+	}
+	if len(files) != len(rl.TOC) {
+		return rv, fmt.Errorf("%s lists %d tracks, but disc %d has %d source files", logFilename, len(rl.TOC), disc, len(files))
+	}
+
+	// Only the CRCs of the whole disc are of use
+	wholeDisc := cdrip.NewTrackChecksum(0, false, false)
+
+	for i, sf := range files {
+		tc, err := l.trackChecksum(sf, i == 0, i == len(files)-1, wholeDisc)
+		if err != nil {
+			return rv, err
+		}
+
+		tv := TrackVerification{
+			Number:        rl.TOC[i].Track,
+			Filename:      sf.Filename,
+			CRC32:         fmt.Sprintf("%08X", tc.CRC32()),
+			AccurateRipV1: fmt.Sprintf("%08X", tc.AccurateRipV1()),
+			AccurateRipV2: fmt.Sprintf("%08X", tc.AccurateRipV2()),
+		}
+
+		if lt, ok := rl.Track(tv.Number); ok {
+			if lt.CopyCRC != 0 {
+				tv.LogCRC32 = fmt.Sprintf("%08X", lt.CopyCRC)
+				tv.CRC = crcVerdict(lt.CopyCRC, tc)
+			}
+
+			// Each checksum the ripper computed should match the audio, even
+			// if it wasn't found in the AccurateRip database
+			for _, ar := range lt.AccurateRip {
+				sum := tc.AccurateRipV1()
+				if ar.Version == 2 {
+					sum = tc.AccurateRipV2()
+				}
+				if sum != ar.Checksum {
+					tv.AccurateRip = VerdictMismatch
+					continue
+				}
+				if tv.AccurateRip == "" {
+					tv.AccurateRip = VerdictMatch
+				}
+				if ar.Accurate && ar.Confidence > tv.Confidence {
+					tv.Confidence = ar.Confidence
+				}
+			}
+		}
+
+		rv.Tracks = append(rv.Tracks, tv)
+	}
+
+	if rl.CopyCRC != 0 {
+		rv.CRC = crcVerdict(rl.CopyCRC, wholeDisc)
+	}
+
+	return rv, nil
+}
+
+// crcVerdict compares a CRC from a log to the audio. Depending on its
+// settings, EAC may have left out silence.
+func crcVerdict(crc uint32, tc *cdrip.TrackChecksum) Verdict {
+	if crc == tc.CRC32() || crc == tc.CRC32SkipZero() {
+		return VerdictMatch
+	}
+	return VerdictMismatch
+}
+
+// trackChecksum decodes a source file and computes its checksums
+func (l *Library) trackChecksum(sf SourceFile, first, last bool, wholeDisc io.Writer) (*cdrip.TrackChecksum, error) {
+	zm := ziptraverser.New()
+	defer zm.Close()
+
+	fl, err := zm.Get(path.Join(l.LibraryDir, sf.Filename))
+	if err != nil {
+		return nil, err
+	}
+	defer fl.Close()
+
+	ww, err := DecodeSourceFile(l.WAVConf, fl, sf)
+	if err != nil {
+		return nil, err
+	}
+	defer ww.Close()
+
+	if ww.Format() != wavreader.CD {
+		return nil, fmt.Errorf("%s: expected CD audio; got %s", sf.Filename, ww.Format())
+	}
+
+	tc := cdrip.NewTrackChecksum(int64(ww.Size()/ww.Format().BytesPerSample()), first, last)
+	if _, err := io.Copy(io.MultiWriter(tc, wholeDisc), ww); err != nil {
+		return nil, fmt.Errorf("%s: %v", sf.Filename, err)
+	}
+	return tc, nil
+}
@@ -0,0 +1,50 @@
+package pkg
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestRipVerification(t *testing.T) {
+	c := &Carrier{ID: "kleiber"}
+	v := RipVerification{
+		Disc:        1,
+		Log:         "kleiber/disc_01/eac.log",
+		LogChecksum: "valid",
+		Tracks: []TrackVerification{
+			{Number: 1, Filename: "kleiber/disc_01/track_01.flac", CRC32: "0D3A1B2C", LogCRC32: "0D3A1B2C", CRC: VerdictMatch, AccurateRip: VerdictMatch, Confidence: 12},
+			{Number: 2, Filename: "kleiber/disc_01/track_02.flac", CRC32: "99887766"},
+		},
+	}
+	if !v.OK() {
+		t.Errorf("expected a matching rip to be OK")
+	}
+
+	c.SetRipVerification(v)
+	c.SetRipVerification(RipVerification{Disc: 2, LogChecksum: "missing"})
+
+	v.Tracks[1].AccurateRip = VerdictMismatch
+	if v.OK() {
+		t.Errorf("expected a mismatch not to be OK")
+	}
+	c.SetRipVerification(v)
+	if len(c.Rips) != 2 || c.Rips[0].Tracks[1].AccurateRip != VerdictMismatch {
+		t.Errorf("the second verification of disc 1 should replace the first: %+v", c.Rips)
+	}
+
+	if (RipVerification{LogChecksum: "invalid"}).OK() {
+		t.Errorf("expected a tampered log not to be OK")
+	}
+
+	b, err := xml.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c2 Carrier
+	if err := xml.Unmarshal(b, &c2); err != nil {
+		t.Fatal(err)
+	}
+	if len(c2.Rips) != 2 || c2.Rips[0].Tracks[0] != c.Rips[0].Tracks[0] {
+		t.Errorf("round trip: %s", b)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/users"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
 )
 
@@ -11,6 +12,10 @@ var AddQueueHandler addQueueHandler
 
 type addQueueHandler struct{}
 
+func (addQueueHandler) RequiredRole() users.Role {
+	return users.RoleDJ
+}
+
 func (addQueueHandler) handleAddQueue(s State, r addQueueRequest) (State, addQueueResponse, error) {
 	_, err := s.Library.GetPerformance(r.PerformanceID)
 	if err != nil {
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+)
+
+// Pagination defaults for list endpoints in the JSON API
+const (
+	apiDefaultPerPage = 50
+	apiMaxPerPage     = 500
+)
+
+// A pageRequest selects one page of a list
+type pageRequest struct {
+	Page    int
+	PerPage int
+}
+
+func decodePageRequest(r *http.Request) (pageRequest, error) {
+	rv := pageRequest{
+		Page:    1,
+		PerPage: apiDefaultPerPage,
+	}
+
+	if p := r.FormValue("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			return rv, weberrors.WithStatus(fmt.Errorf("invalid page number '%s'", p), 400)
+		}
+		rv.Page = n
+	}
+
+	if p := r.FormValue("per_page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > apiMaxPerPage {
+			return rv, weberrors.WithStatus(fmt.Errorf("per_page must be between 1 and %d", apiMaxPerPage), 400)
+		}
+		rv.PerPage = n
+	}
+
+	return rv, nil
+}
+
+// bounds returns the slice indices of this page in a list of the given length
+func (p pageRequest) bounds(total int) (int, int) {
+	// Check the page number before multiplying, as a huge one would overflow
+	if p.Page-1 >= (total+p.PerPage-1)/p.PerPage {
+		return total, total
+	}
+	start := (p.Page - 1) * p.PerPage
+	end := start + p.PerPage
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// A Page wraps one page of results from a list endpoint
+type Page struct {
+	Page       int
+	PerPage    int
+	Total      int
+	TotalPages int
+	Items      interface{}
+}
+
+func (p pageRequest) page(total int, items interface{}) Page {
+	return Page{
+		Page:       p.Page,
+		PerPage:    p.PerPage,
+		Total:      total,
+		TotalPages: (total + p.PerPage - 1) / p.PerPage,
+		Items:      items,
+	}
+}
+
+// serveJSON writes a JSON document with an ETag derived from its contents.
+// Requests that already have the current version get a 304 instead.
+func serveJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	var b bytes.Buffer
+	err := json.NewEncoder(&b).Encode(v)
+	if err != nil {
+		log.Printf("error encoding JSON response: %v", err)
+		http.Error(w, "error encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(b.Bytes())
+	etag := "\"" + hex.EncodeToString(sum[:12]) + "\""
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	io.Copy(w, &b)
+}
+
+// etagMatches checks an If-None-Match header against an ETag
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		t = strings.TrimPrefix(t, "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// apiPathID extracts the resource ID from a path of the form /api/v1/{collection}/{id}.
+// It returns an empty string if the path refers to the collection itself.
+func apiPathID(r *http.Request, collection string) (string, error) {
+	prefix := "/api/v1/" + collection
+	p := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	if p == "" || p == "/" {
+		return "", nil
+	}
+	if p[0] != '/' || strings.Contains(p[1:], "/") {
+		return "", errNotFound("", "")
+	}
+	id, err := url.PathUnescape(p[1:])
+	if err != nil {
+		return "", weberrors.WithStatus(err, 400)
+	}
+	return id, nil
+}
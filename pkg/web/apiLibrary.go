@@ -0,0 +1,398 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+	"github.com/thijzert/speeldoos/pkg/search"
+)
+
+// An APICarrier summarises a carrier in carrier listings
+type APICarrier struct {
+	ID               string
+	Name             string
+	Source           string
+	Hash             string
+	PerformanceCount int
+}
+
+// An APICarrierDetail describes one carrier, including its performances
+type APICarrierDetail struct {
+	ID           string
+	Name         string
+	Source       string
+	Hash         string
+	Performances []speeldoos.Performance
+}
+
+// An APIComposer summarises the works and performances by one composer
+type APIComposer struct {
+	Name         string
+	ID           string
+	Works        int
+	Performances int
+}
+
+// sortedCarriers returns all error-free carriers, ordered by ID so that
+// pagination is stable across requests
+func sortedCarriers(lib *speeldoos.Library) []*speeldoos.Carrier {
+	var rv []*speeldoos.Carrier
+	for _, pc := range lib.AllCarriers() {
+		rv = append(rv, pc.Carrier)
+	}
+	sort.SliceStable(rv, func(i, j int) bool {
+		return rv[i].ID < rv[j].ID
+	})
+	return rv
+}
+
+// apiResponse is the common response type of all JSON API handlers
+type apiResponse struct {
+	Body interface{}
+}
+
+func (apiResponse) FlaggedAsResponse() {}
+
+func (a apiResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, r, a.Body)
+}
+
+// Carriers
+
+var APICarriersHandler apiCarriersHandler
+
+type apiCarriersHandler struct{}
+
+func (apiCarriersHandler) handleCarriers(s State, r apiCarriersRequest) (State, apiResponse, error) {
+	var rv apiResponse
+	carriers := sortedCarriers(s.Library)
+
+	if r.ID != "" {
+		for _, car := range carriers {
+			if car.ID == r.ID {
+				rv.Body = APICarrierDetail{
+					ID:           car.ID,
+					Name:         car.Name,
+					Source:       car.Source,
+					Hash:         car.Hash,
+					Performances: car.Performances,
+				}
+				return s, rv, nil
+			}
+		}
+		return s, rv, errNotFound("", fmt.Sprintf("Carrier '%s' not found", r.ID))
+	}
+
+	start, end := r.Page.bounds(len(carriers))
+	items := make([]APICarrier, 0, end-start)
+	for _, car := range carriers[start:end] {
+		items = append(items, APICarrier{
+			ID:               car.ID,
+			Name:             car.Name,
+			Source:           car.Source,
+			Hash:             car.Hash,
+			PerformanceCount: len(car.Performances),
+		})
+	}
+	rv.Body = r.Page.page(len(carriers), items)
+
+	return s, rv, nil
+}
+
+func (apiCarriersHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv apiCarriersRequest
+	var err error
+
+	rv.ID, err = apiPathID(r, "carriers")
+	if err != nil {
+		return rv, err
+	}
+	rv.Page, err = decodePageRequest(r)
+	return rv, err
+}
+
+func (h apiCarriersHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(apiCarriersRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleCarriers(s, req)
+}
+
+type apiCarriersRequest struct {
+	// The carrier to retrieve; empty to list all carriers
+	ID   string
+	Page pageRequest
+}
+
+func (apiCarriersRequest) FlaggedAsRequest() {}
+
+// Performances
+
+var APIPerformancesHandler apiPerformancesHandler
+
+type apiPerformancesHandler struct{}
+
+func (apiPerformancesHandler) handlePerformances(s State, r apiPerformancesRequest) (State, apiResponse, error) {
+	var rv apiResponse
+
+	if r.ID != "" {
+		pfid, err := speeldoos.ParsePerformanceID(r.ID)
+		if err != nil {
+			return s, rv, weberrors.WithStatus(err, 400)
+		}
+		pf, err := s.Library.GetPerformance(pfid)
+		if err != nil {
+			return s, rv, errNotFound("", fmt.Sprintf("Performance '%s' not found", r.ID))
+		}
+		rv.Body = pf
+		return s, rv, nil
+	}
+
+	var matches []speeldoos.Performance
+	for _, car := range sortedCarriers(s.Library) {
+		if r.Carrier != "" && car.ID != r.Carrier {
+			continue
+		}
+		for _, pf := range car.Performances {
+			if r.matches(pf) {
+				matches = append(matches, pf)
+			}
+		}
+	}
+
+	start, end := r.Page.bounds(len(matches))
+	rv.Body = r.Page.page(len(matches), append([]speeldoos.Performance{}, matches[start:end]...))
+
+	return s, rv, nil
+}
+
+func (apiPerformancesHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv apiPerformancesRequest
+	var err error
+
+	rv.ID, err = apiPathID(r, "performances")
+	if err != nil {
+		return rv, err
+	}
+	rv.Page, err = decodePageRequest(r)
+	if err != nil {
+		return rv, err
+	}
+
+	rv.Carrier = r.FormValue("carrier")
+	rv.Composer = strings.ToLower(r.FormValue("composer"))
+	rv.Work = strings.ToLower(r.FormValue("work"))
+	rv.Performer = strings.ToLower(r.FormValue("performer"))
+
+	if y := r.FormValue("year"); y != "" {
+		rv.Year, err = strconv.Atoi(y)
+		if err != nil {
+			return rv, weberrors.WithStatus(fmt.Errorf("invalid year '%s'", y), 400)
+		}
+	}
+
+	return rv, nil
+}
+
+func (h apiPerformancesHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(apiPerformancesRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handlePerformances(s, req)
+}
+
+type apiPerformancesRequest struct {
+	// The performance to retrieve; empty to list performances
+	ID   string
+	Page pageRequest
+
+	// Only list performances from this carrier
+	Carrier string
+
+	// Only list performances whose composer's ID is this, or whose name contains this
+	Composer string
+
+	// Only list performances of works whose title contains this
+	Work string
+
+	// Only list performances with a performer whose name contains this
+	Performer string
+
+	// Only list performances recorded in this year
+	Year int
+}
+
+func (apiPerformancesRequest) FlaggedAsRequest() {}
+
+func (r apiPerformancesRequest) matches(pf speeldoos.Performance) bool {
+	if r.Year != 0 && pf.Year != r.Year {
+		return false
+	}
+
+	if r.Composer != "" {
+		c := pf.Work.Composer
+		if strings.ToLower(c.ID) != r.Composer && !strings.Contains(strings.ToLower(c.Name), r.Composer) {
+			return false
+		}
+	}
+
+	if r.Work != "" {
+		found := false
+		for _, t := range pf.Work.Title {
+			if strings.Contains(strings.ToLower(t.Title), r.Work) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.Performer != "" {
+		found := false
+		for _, p := range pf.Performers {
+			if strings.Contains(strings.ToLower(p.Name), r.Performer) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Composers
+
+var APIComposersHandler apiComposersHandler
+
+type apiComposersHandler struct{}
+
+func (apiComposersHandler) handleComposers(s State, r apiComposersRequest) (State, apiResponse, error) {
+	var rv apiResponse
+
+	composers := make(map[string]*APIComposer)
+	works := make(map[string]map[string]bool)
+
+	for _, car := range sortedCarriers(s.Library) {
+		for _, pf := range car.Performances {
+			c := pf.Work.Composer
+			key := c.ID
+			if key == "" {
+				key = c.Name
+			}
+
+			if composers[key] == nil {
+				composers[key] = &APIComposer{Name: c.Name, ID: c.ID}
+				works[key] = make(map[string]bool)
+			}
+			composers[key].Performances++
+
+			if len(pf.Work.Title) > 0 {
+				works[key][pf.Work.Title[0].Title] = true
+			}
+		}
+	}
+
+	all := make([]APIComposer, 0, len(composers))
+	for key, c := range composers {
+		c.Works = len(works[key])
+		all = append(all, *c)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	start, end := r.Page.bounds(len(all))
+	rv.Body = r.Page.page(len(all), all[start:end])
+
+	return s, rv, nil
+}
+
+func (apiComposersHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv apiComposersRequest
+	var err error
+
+	rv.Page, err = decodePageRequest(r)
+	return rv, err
+}
+
+func (h apiComposersHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(apiComposersRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleComposers(s, req)
+}
+
+type apiComposersRequest struct {
+	Page pageRequest
+}
+
+func (apiComposersRequest) FlaggedAsRequest() {}
+
+// Search
+
+var APISearchHandler apiSearchHandler
+
+type apiSearchHandler struct{}
+
+func (apiSearchHandler) handleSearch(s State, r apiSearchRequest) (State, apiResponse, error) {
+	var rv apiResponse
+
+	var conf search.Config
+	q, err := conf.Compile(r.Query)
+	if err != nil {
+		return s, rv, weberrors.WithStatus(err, 400)
+	}
+
+	results := q.Search(s.Library)
+
+	start, end := r.Page.bounds(len(results))
+	rv.Body = r.Page.page(len(results), append([]search.Result{}, results[start:end]...))
+
+	return s, rv, nil
+}
+
+func (apiSearchHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv apiSearchRequest
+	var err error
+
+	rv.Query = r.FormValue("q")
+	if rv.Query == "" {
+		return rv, weberrors.WithStatus(fmt.Errorf("missing search query"), 400)
+	}
+
+	rv.Page, err = decodePageRequest(r)
+	return rv, err
+}
+
+func (h apiSearchHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(apiSearchRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleSearch(s, req)
+}
+
+type apiSearchRequest struct {
+	Query string
+	Page  pageRequest
+}
+
+func (apiSearchRequest) FlaggedAsRequest() {}
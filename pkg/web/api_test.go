@@ -0,0 +1,59 @@
+package web
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		Page, PerPage, Total int
+		Start, End, Pages    int
+	}{
+		{1, 10, 25, 0, 10, 3},
+		{3, 10, 25, 20, 25, 3},
+		{4, 10, 25, 25, 25, 3},
+		{1, 50, 0, 0, 0, 0},
+		{2, 5, 10, 5, 10, 2},
+		{math.MaxInt / 10, 100, 25, 25, 25, 1},
+	}
+
+	for _, tc := range tests {
+		p := pageRequest{Page: tc.Page, PerPage: tc.PerPage}
+		start, end := p.bounds(tc.Total)
+		if start != tc.Start || end != tc.End {
+			t.Errorf("page %d/%d of %d: got [%d:%d], expected [%d:%d]", tc.Page, tc.PerPage, tc.Total, start, end, tc.Start, tc.End)
+		}
+		if pg := p.page(tc.Total, nil); pg.TotalPages != tc.Pages {
+			t.Errorf("page %d/%d of %d: got %d pages, expected %d", tc.Page, tc.PerPage, tc.Total, pg.TotalPages, tc.Pages)
+		}
+	}
+}
+
+func TestServeJSONETag(t *testing.T) {
+	body := map[string]int{"foo": 1}
+
+	w := httptest.NewRecorder()
+	serveJSON(w, httptest.NewRequest("GET", "/api/v1/composers", nil), body)
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" {
+		t.Fatalf("expected a 200 response with an ETag; got %d, ETag '%s'", w.Code, etag)
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/composers", nil)
+	r.Header.Set("If-None-Match", "\"something-else\", W/"+etag)
+	w = httptest.NewRecorder()
+	serveJSON(w, r, body)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected an empty 304 response; got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	body["foo"] = 2
+	w = httptest.NewRecorder()
+	serveJSON(w, r, body)
+	if w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a new version; got %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,37 @@
+import { onServerEvent } from "./server-events.js";
+
+async function reloadNowPlaying() {
+	let ndnp = document.querySelectorAll(".-js-load-now-playing");
+	if ( ndnp.length == 0 ) {
+		return;
+	}
+
+	let np = await fetch("/now-playing");
+	let npb = await np.text();
+
+	ndnp.forEach(nd => { nd.innerHTML = npb; });
+}
+
+// nowPlayingMain keeps the now playing block up to date, preferably by
+// listening for track and queue changes; otherwise by polling.
+export function nowPlayingMain() {
+	let isDefaultStation = ev => ev.Station == "";
+
+	let subscribed = onServerEvent("nowplaying", ev => {
+		if ( isDefaultStation(ev) ) {
+			reloadNowPlaying();
+		}
+	});
+	if ( subscribed ) {
+		onServerEvent("queue", ev => {
+			if ( isDefaultStation(ev) ) {
+				reloadNowPlaying();
+			}
+		});
+		onServerEvent("library", reloadNowPlaying);
+	} else {
+		window.setInterval(reloadNowPlaying, 4000);
+	}
+
+	reloadNowPlaying();
+}
@@ -0,0 +1,26 @@
+
+let source = null;
+let listeners = {};
+
+// onServerEvent calls handler whenever the server pushes an event of the given
+// type. It returns false if the browser doesn't support server-sent events.
+export function onServerEvent(type, handler) {
+	if ( !window.EventSource ) {
+		return false;
+	}
+
+	if ( !source ) {
+		source = new EventSource("/api/events");
+	}
+
+	if ( !listeners[type] ) {
+		listeners[type] = [];
+		source.addEventListener(type, ev => {
+			let data = JSON.parse(ev.data);
+			listeners[type].forEach(h => h(data));
+		});
+	}
+	listeners[type].push(handler);
+
+	return true;
+}
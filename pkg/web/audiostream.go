@@ -1,16 +1,24 @@
 package web
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
 	"github.com/thijzert/speeldoos/lib/wavreader"
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
 )
 
 var MP3StreamHandler mp3StreamHandler
 var WAVStreamHandler wavStreamHandler
+var FLACStreamHandler flacStreamHandler
+var OpusStreamHandler opusStreamHandler
+
+var errStreamDisabled = errors.New("this stream is not enabled on this server")
 
 type mp3StreamHandler struct{}
 
@@ -47,6 +55,8 @@ type audioStreamType int
 const (
 	typeWAV audioStreamType = iota
 	typeMP3
+	typeOggFLAC
+	typeOpus
 )
 
 type audioStreamRequest struct {
@@ -71,6 +81,19 @@ func (a audioStreamResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if a.Type == typeMP3 {
 		w.Header().Set("Content-Type", "audio/mpeg")
+
+		if r.Header.Get("Icy-MetaData") == "1" {
+			if ads, ok := a.Stream.(chunker.AssociatedDataStream); ok {
+				w.Header().Set("icy-metaint", fmt.Sprintf("%d", icyMetaInt))
+				w.Header().Set("icy-name", "Speeldoos")
+				a.serveICY(w, ads)
+				return
+			}
+		}
+	} else if a.Type == typeOggFLAC {
+		w.Header().Set("Content-Type", "audio/ogg; codecs=flac")
+	} else if a.Type == typeOpus {
+		w.Header().Set("Content-Type", "audio/ogg; codecs=opus")
 	} else if a.Type == typeWAV {
 		w.Header().Set("Content-Type", "audio/wav")
 		ww := wavreader.NewWriter(w, a.Format)
@@ -88,6 +111,31 @@ func (a audioStreamResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveICY writes the audio stream interleaved with ICY metadata. The stream
+// title follows the associated data of the chunk being sent.
+func (a audioStreamResponse) serveICY(w io.Writer, stream chunker.AssociatedDataStream) {
+	iw := newICYWriter(w, icyMetaInt)
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := stream.Read(buf)
+		if pf, ok := stream.AssociatedData().(speeldoos.Performance); ok {
+			iw.SetTitle(icyTitle(pf))
+		}
+		if n > 0 {
+			if _, ew := iw.Write(buf[:n]); ew != nil {
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Print(err)
+			}
+			return
+		}
+	}
+}
+
 type wavStreamHandler struct{}
 
 func (wavStreamHandler) handleWAVStream(s State, r audioStreamRequest) (State, audioStreamResponse, error) {
@@ -117,3 +165,71 @@ func (h wavStreamHandler) HandleRequest(s State, r Request) (State, Response, er
 
 	return h.handleWAVStream(s, req)
 }
+
+type flacStreamHandler struct{}
+
+func (flacStreamHandler) handleFLACStream(s State, r audioStreamRequest) (State, audioStreamResponse, error) {
+	var rv audioStreamResponse
+
+	if s.FLACStream == nil {
+		return s, rv, weberrors.WithStatus(errStreamDisabled, 404)
+	}
+
+	cs, err := s.FLACStream.NewStream()
+	if err != nil {
+		return s, rv, err
+	}
+
+	rv.Type = typeOggFLAC
+	rv.Format = s.FLACStream.Format()
+	rv.Stream = cs
+
+	return s, rv, nil
+}
+
+func (flacStreamHandler) DecodeRequest(r *http.Request) (Request, error) {
+	return audioStreamRequest{}, nil
+}
+
+func (h flacStreamHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(audioStreamRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleFLACStream(s, req)
+}
+
+type opusStreamHandler struct{}
+
+func (opusStreamHandler) handleOpusStream(s State, r audioStreamRequest) (State, audioStreamResponse, error) {
+	var rv audioStreamResponse
+
+	if s.OpusStream == nil {
+		return s, rv, weberrors.WithStatus(errStreamDisabled, 404)
+	}
+
+	cs, err := s.OpusStream.NewStream()
+	if err != nil {
+		return s, rv, err
+	}
+
+	rv.Type = typeOpus
+	rv.Format = s.OpusStream.Format()
+	rv.Stream = cs
+
+	return s, rv, nil
+}
+
+func (opusStreamHandler) DecodeRequest(r *http.Request) (Request, error) {
+	return audioStreamRequest{}, nil
+}
+
+func (h opusStreamHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(audioStreamRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleOpusStream(s, req)
+}
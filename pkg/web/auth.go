@@ -0,0 +1,205 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/thijzert/speeldoos/lib/users"
+)
+
+// SessionCookie is the name of the cookie that holds the login session ID
+const SessionCookie = "speeldoos_session"
+
+// A RoleRequirer is a Handler that can only be used by users with a
+// certain role. Handlers that don't implement this require RoleListener.
+type RoleRequirer interface {
+	RequiredRole() users.Role
+}
+
+// Authorize checks if the current user may use a handler. It always succeeds
+// if authentication is disabled.
+func Authorize(h Handler, s State) error {
+	if s.Users == nil {
+		return nil
+	}
+
+	need := users.RoleListener
+	if rr, ok := h.(RoleRequirer); ok {
+		need = rr.RequiredRole()
+	}
+
+	if s.User.Can(need) {
+		return nil
+	}
+
+	if s.User == nil {
+		return errForbidden("Login required", "Please log in to access this resource")
+	}
+	return errForbidden("", fmt.Sprintf("This requires the '%s' role; you are logged in as a %s", need, s.User.Role))
+}
+
+// Login
+
+var LoginHandler loginHandler
+
+type loginHandler struct{}
+
+func (loginHandler) RequiredRole() users.Role {
+	return users.RoleNone
+}
+
+func (loginHandler) handleLogin(s State, r loginRequest) (State, Response, error) {
+	if s.Users == nil {
+		return s, loginResponse{}, errNotFound("", "This server doesn't have any user accounts")
+	}
+
+	rv := loginResponse{
+		User:     s.User,
+		Continue: r.Continue,
+	}
+
+	if !r.Submitted {
+		return s, rv, nil
+	}
+
+	u, err := s.Users.Authenticate(r.Name, r.Password)
+	if err != nil {
+		rv.Error = "Invalid user name or password"
+		return s, rv, nil
+	}
+
+	session, err := s.Users.NewSession(u.Name)
+	if err != nil {
+		return s, rv, err
+	}
+
+	return s, loginSuccessResponse{
+		Session:  session,
+		Continue: r.Continue,
+	}, nil
+}
+
+func (loginHandler) DecodeRequest(r *http.Request) (Request, error) {
+	rv := loginRequest{
+		Continue: safeContinue(r.FormValue("continue")),
+	}
+
+	if r.Method == "POST" {
+		rv.Submitted = true
+		rv.Name = r.PostFormValue("name")
+		rv.Password = r.PostFormValue("password")
+	}
+
+	return rv, nil
+}
+
+func (h loginHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(loginRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleLogin(s, req)
+}
+
+type loginRequest struct {
+	Submitted bool
+	Name      string
+	Password  string
+
+	// The page to go to after logging in
+	Continue string
+}
+
+func (loginRequest) FlaggedAsRequest() {}
+
+type loginResponse struct {
+	User     *users.User
+	Error    string
+	Continue string
+}
+
+func (loginResponse) FlaggedAsResponse() {}
+
+type loginSuccessResponse struct {
+	Session  string
+	Continue string
+}
+
+func (loginSuccessResponse) FlaggedAsResponse() {}
+
+func (l loginSuccessResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    l.Session,
+		Path:     "/",
+		Expires:  time.Now().Add(users.SessionDuration),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, l.Continue, http.StatusSeeOther)
+}
+
+// safeContinue only allows redirects to paths on this server
+func safeContinue(cont string) string {
+	u, err := url.Parse(cont)
+	if cont == "" || err != nil || u.Scheme != "" || u.User != nil || u.Host != "" || len(u.Path) < 1 || u.Path[0] != '/' {
+		return "/"
+	}
+	return u.RequestURI()
+}
+
+// Logout
+
+var LogoutHandler logoutHandler
+
+type logoutHandler struct{}
+
+func (logoutHandler) RequiredRole() users.Role {
+	return users.RoleNone
+}
+
+func (logoutHandler) handleLogout(s State, r logoutRequest) (State, logoutResponse, error) {
+	if s.Users != nil && s.Session != "" {
+		s.Users.EndSession(s.Session)
+	}
+	return s, logoutResponse{}, nil
+}
+
+func (logoutHandler) DecodeRequest(r *http.Request) (Request, error) {
+	if r.Method != "POST" {
+		return logoutRequest{}, errRedirect{"login"}
+	}
+	return logoutRequest{}, nil
+}
+
+func (h logoutHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(logoutRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleLogout(s, req)
+}
+
+type logoutRequest struct{}
+
+func (logoutRequest) FlaggedAsRequest() {}
+
+type logoutResponse struct{}
+
+func (logoutResponse) FlaggedAsResponse() {}
+
+func (logoutResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -11,24 +11,47 @@ var BufferStatusHandler bufferStatusHandler
 type bufferStatusHandler struct{}
 
 func (bufferStatusHandler) handleBufferStatus(s State, r bufferStatusRequest) (State, bufferStatusResponse, error) {
-	var rv bufferStatusResponse
+	rv := make(bufferStatusResponse)
 
-	if s.Buffers.MP3Stream != nil {
-		mp3Stream := s.Buffers.MP3Stream.BufferStatus()
-		if !mp3Stream.Tmin.IsZero() {
-			rv.MP3Stream = &mp3Stream
+	for _, st := range s.Stations {
+		keys := stationBufferKeys(st.Name)
+
+		if st.Buffers.MP3Stream != nil {
+			mp3Stream := st.Buffers.MP3Stream.BufferStatus()
+			if !mp3Stream.Tmin.IsZero() {
+				rv[keys.MP3Stream] = mp3Stream
+			}
 		}
-	}
-	if s.Buffers.Scheduler != nil {
-		sch := s.Buffers.Scheduler.BufferStatus()
-		if !sch.Tmin.IsZero() {
-			rv.Scheduler = &sch
+		if st.Buffers.Scheduler != nil {
+			sch := st.Buffers.Scheduler.BufferStatus()
+			if !sch.Tmin.IsZero() {
+				rv[keys.Scheduler] = sch
+			}
 		}
 	}
 
 	return s, rv, nil
 }
 
+// bufferKeys contains the keys under which a station's buffers are reported
+type bufferKeys struct {
+	Station   string
+	MP3Stream string
+	Scheduler string
+}
+
+func stationBufferKeys(name string) bufferKeys {
+	prefix := ""
+	if name != "" {
+		prefix = name + "/"
+	}
+	return bufferKeys{
+		Station:   name,
+		MP3Stream: prefix + "MP3Stream",
+		Scheduler: prefix + "Scheduler",
+	}
+}
+
 func (bufferStatusHandler) DecodeRequest(r *http.Request) (Request, error) {
 	return bufferStatusRequest{}, nil
 }
@@ -47,9 +70,9 @@ type bufferStatusRequest struct {
 
 func (bufferStatusRequest) FlaggedAsRequest() {}
 
-type bufferStatusResponse struct {
-	MP3Stream *chunker.BufferStatus
-	Scheduler *chunker.BufferStatus
-}
+// A bufferStatusResponse maps buffer names to their status. The default
+// station's buffers are called "MP3Stream" and "Scheduler"; those of other
+// stations are prefixed with the station name, e.g. "piano/MP3Stream".
+type bufferStatusResponse map[string]chunker.BufferStatus
 
 func (bufferStatusResponse) FlaggedAsResponse() {}
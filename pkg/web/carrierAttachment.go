@@ -0,0 +1,260 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/thumbnail"
+	"github.com/thijzert/speeldoos/lib/transcodecache"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+// thumbnailSizes lists the sizes in which thumbnails are generated. Any
+// other requested size is rounded up to the next one, so the cache doesn't
+// fill up with near-identical images.
+var thumbnailSizes = []int{64, 128, 256, 512}
+
+var CarrierAttachmentHandler carrierAttachmentHandler
+
+type carrierAttachmentHandler struct{}
+
+func (carrierAttachmentHandler) handleCarrierAttachment(s State, r carrierAttachmentRequest) (State, Response, error) {
+	car, err := s.Library.GetCarrier(r.CarrierID)
+	if err != nil {
+		return withError(s, weberrors.WithStatus(err, 404))
+	}
+
+	if r.Type == "" {
+		var rv []carrierAttachment
+		for _, a := range s.Library.Attachments(car) {
+			u := "carrier/" + url.PathEscape(car.ID) + "/" + a.Type
+			if a.Disc != 0 {
+				u += "?disc=" + strconv.Itoa(a.Disc)
+			}
+			rv = append(rv, carrierAttachment{Attachment: a, URL: u})
+		}
+		return s, apiResponse{rv}, nil
+	}
+
+	a, err := s.Library.FindAttachment(car, r.Type, r.Disc)
+	if err == speeldoos.ErrNoAttachment {
+		return withError(s, errNotFound("", fmt.Sprintf("Carrier %s has no %s", car.ID, r.Type)))
+	} else if err != nil {
+		return withError(s, err)
+	}
+
+	rv := carrierAttachmentResponse{
+		Attachment: a,
+		Library:    s.Library,
+	}
+	if r.Size > 0 && isImage(a.Filename) {
+		rv.Size = r.Size
+		rv.Cache = s.TranscodeCache
+	}
+	return s, rv, nil
+}
+
+func (carrierAttachmentHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv carrierAttachmentRequest
+	var err error
+
+	// The URL path is /carrier/{id}/{type}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 4 {
+		return rv, errNotFound("", "")
+	}
+
+	rv.CarrierID, err = url.PathUnescape(parts[2])
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+
+	if parts[3] != "attachments" {
+		for _, t := range speeldoos.AttachmentTypes {
+			if parts[3] == t {
+				rv.Type = t
+			}
+		}
+		if rv.Type == "" {
+			return rv, errNotFound("", "")
+		}
+	}
+
+	if d := r.FormValue("disc"); d != "" {
+		rv.Disc, err = strconv.Atoi(d)
+		if err != nil || rv.Disc < 1 {
+			return rv, weberrors.WithStatus(fmt.Errorf("invalid disc number '%s'", d), 400)
+		}
+	}
+
+	if sz := r.FormValue("size"); sz != "" {
+		size, err := strconv.Atoi(sz)
+		if err != nil || size < 1 {
+			return rv, weberrors.WithStatus(fmt.Errorf("invalid thumbnail size '%s'", sz), 400)
+		}
+		rv.Size = thumbnailSizes[len(thumbnailSizes)-1]
+		for _, s := range thumbnailSizes {
+			if size <= s {
+				rv.Size = s
+				break
+			}
+		}
+	}
+
+	return rv, nil
+}
+
+func (h carrierAttachmentHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(carrierAttachmentRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleCarrierAttachment(s, req)
+}
+
+type carrierAttachmentRequest struct {
+	CarrierID string
+
+	// The type of attachment; empty to list all of them
+	Type string
+
+	// Prefer the attachment for this disc, if there is one
+	Disc int
+
+	// Scale images down to fit within this size; 0 for the original
+	Size int
+}
+
+func (carrierAttachmentRequest) FlaggedAsRequest() {}
+
+// A carrierAttachment is an entry in the list of a carrier's attachments
+type carrierAttachment struct {
+	speeldoos.Attachment
+	URL string
+}
+
+type carrierAttachmentResponse struct {
+	Attachment speeldoos.Attachment
+	Library    *speeldoos.Library
+
+	// Scale the image down to this size, and cache the result if possible
+	Size  int
+	Cache *transcodecache.Cache
+}
+
+func (carrierAttachmentResponse) FlaggedAsResponse() {}
+
+func (c carrierAttachmentResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, fi, err := c.Library.OpenAttachmentSeeker(c.Attachment)
+	if err != nil {
+		log.Printf("error opening %s: %v", c.Attachment.Filename, err)
+		http.Error(w, "error opening attachment", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	version := attachmentVersion(c.Attachment, fi)
+	name := path.Base(c.Attachment.Filename)
+
+	var content io.ReadSeeker = f
+	if c.Size > 0 {
+		th, err := c.thumbnail(f, version)
+		if err != nil {
+			log.Printf("error scaling %s: %v", c.Attachment.Filename, err)
+			http.Error(w, "error scaling image", http.StatusInternalServerError)
+			return
+		}
+		defer th.Close()
+		content = th
+		name = strings.TrimSuffix(name, path.Ext(name)) + ".jpg"
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+		if c.Attachment.Type == speeldoos.AttachmentEACLog || c.Attachment.Type == speeldoos.AttachmentCuesheet {
+			contentType = "text/plain"
+		}
+	}
+
+	// Attachments rarely change, but the ETag lets clients find out when they do
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Header().Set("ETag", fmt.Sprintf("\"%s-%d\"", version[:24], c.Size))
+	http.ServeContent(w, r, name, fi.ModTime(), content)
+}
+
+// attachmentVersion identifies the contents of an attachment without reading
+// it, using its size and modification time, and its CRC if it's inside a zip
+// archive
+func attachmentVersion(a speeldoos.Attachment, fi os.FileInfo) string {
+	var crc uint32
+	if fh, ok := fi.Sys().(*zip.FileHeader); ok {
+		crc = fh.CRC32
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%08x", a.Filename, fi.Size(), fi.ModTime().UnixNano(), crc)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// thumbnail scales down an image, fetching the result from the cache if it's there
+func (c carrierAttachmentResponse) thumbnail(img io.Reader, version string) (io.ReadSeekCloser, error) {
+	fill := func(w io.Writer) error {
+		return thumbnail.JPEG(w, img, c.Size)
+	}
+
+	if c.Cache == nil {
+		var b bytes.Buffer
+		if err := fill(&b); err != nil {
+			return nil, err
+		}
+		return nopSeekCloser{bytes.NewReader(b.Bytes())}, nil
+	}
+
+	key := transcodecache.Key(version, fmt.Sprintf("thumbnail %d q%d", c.Size, thumbnail.Quality))
+	return c.Cache.GetOrCreate(key, fill)
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// coverURL returns the URL of a carrier's cover thumbnail, or an empty
+// string if it has no cover art
+func coverURL(l *speeldoos.Library, carrierID string, size int) string {
+	car, err := l.GetCarrier(carrierID)
+	if err != nil {
+		return ""
+	}
+	if _, err := l.FindAttachment(car, speeldoos.AttachmentCover, 0); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("carrier/%s/%s?size=%d", url.PathEscape(carrierID), speeldoos.AttachmentCover, size)
+}
+
+func isImage(filename string) bool {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
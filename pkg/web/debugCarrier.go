@@ -20,8 +20,10 @@ type debugCarrierHandler struct{}
 func (debugCarrierHandler) handleDebugCarrier(s State, r debugCarrierRequest) (State, debugCarrierResponse, error) {
 	var rv debugCarrierResponse
 
+	carriers := s.Library.ParsedCarriers()
+
 	str := fmt.Sprintf("carrier '%s' not found\n", r.CarrierID)
-	for _, pc := range s.Library.Carriers {
+	for _, pc := range carriers {
 		str += "\n *  " + pc.Carrier.ID
 	}
 
@@ -29,7 +31,7 @@ func (debugCarrierHandler) handleDebugCarrier(s State, r debugCarrierRequest) (S
 	rv.ParsedCarrier.Error = fmt.Errorf("%s", str)
 	rv.ParsedCarrier.Error = weberrors.WithStatus(rv.ParsedCarrier.Error, 404)
 
-	for _, pc := range s.Library.Carriers {
+	for _, pc := range carriers {
 		if pc.Carrier != nil && pc.Carrier.ID == r.CarrierID {
 			rv.ParsedCarrier = pc
 		}
@@ -0,0 +1,279 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/users"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+// performerRoles lists the roles that can be picked in the carrier editor
+var performerRoles = []string{"", "performer", "soloist", "orchestra", "ensemble", "conductor"}
+
+var EditCarrierHandler editCarrierHandler
+
+type editCarrierHandler struct{}
+
+func (editCarrierHandler) RequiredRole() users.Role {
+	return users.RoleAdmin
+}
+
+func (editCarrierHandler) handleEditCarrier(s State, r editCarrierRequest) (State, editCarrierResponse, error) {
+	rv := editCarrierResponse{
+		Roles: performerRoles,
+		Extra: []int{0, 1},
+	}
+
+	// Carriers in the inbox have no file to save them to until they're tagged
+	if item, ok := s.Library.InboxItem(r.CarrierID); ok {
+		return s, rv, errRedirect{"inbox/" + url.PathEscape(path.Base(item.Filename))}
+	}
+
+	orig, err := s.Library.GetCarrier(r.CarrierID)
+	if err != nil {
+		return s, rv, weberrors.WithStatus(err, 404)
+	}
+	rv.Carrier = orig
+
+	if !r.Submitted {
+		return s, rv, nil
+	}
+
+	if len(r.Performances) != len(orig.Performances) {
+		return s, rv, weberrors.WithStatus(fmt.Errorf("expected %d performances; got %d", len(orig.Performances), len(r.Performances)), 400)
+	}
+
+	// Apply the changes to a copy, so nothing changes until it's saved
+	car := *orig
+	car.Name = r.Name
+	car.Performances = make([]speeldoos.Performance, len(orig.Performances))
+	for i, pf := range orig.Performances {
+		for _, e := range r.Performances[i].apply(&pf) {
+			rv.Errors = append(rv.Errors, fmt.Sprintf("performance %d: %s", i+1, e))
+		}
+		car.Performances[i] = pf
+	}
+	rv.Carrier = &car
+
+	for _, e := range speeldoos.CheckCarrier(&car, s.Library.LibraryDir) {
+		if _, ok := e.(speeldoos.FixableError); ok {
+			rv.Fixed = append(rv.Fixed, e.Error())
+		} else {
+			rv.Errors = append(rv.Errors, e.Error())
+		}
+	}
+	if len(rv.Errors) > 0 {
+		return s, rv, nil
+	}
+
+	err = s.Library.SaveCarrier(&car)
+	if err != nil {
+		return s, rv, err
+	}
+	rv.Carrier, _ = s.Library.GetCarrier(car.ID)
+	rv.Saved = true
+
+	return s, rv, nil
+}
+
+func parseYear(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	rv, err := strconv.Atoi(s)
+	if err != nil || rv < 0 {
+		return 0, fmt.Errorf("invalid year '%s'", s)
+	}
+	return rv, nil
+}
+
+func validRole(role string) bool {
+	for _, r := range performerRoles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+func (editCarrierHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv editCarrierRequest
+	var err error
+
+	// The URL path is /edit/carrier/{id}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 4 {
+		return rv, errNotFound("", "")
+	}
+	rv.CarrierID, err = url.PathUnescape(parts[3])
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+
+	if r.Method != "POST" {
+		return rv, nil
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+	f := r.PostForm
+
+	rv.Submitted = true
+	rv.Name = strings.TrimSpace(f.Get("name"))
+
+	for i := 0; ; i++ {
+		pre := fmt.Sprintf("pf%d-", i)
+		if _, ok := f[pre+"composer"]; !ok {
+			break
+		}
+		rv.Performances = append(rv.Performances, decodePerformanceEdit(f, pre))
+	}
+
+	return rv, nil
+}
+
+// decodePerformanceEdit reads the fields of one performance from a form.
+// Their names all start with a prefix, and list items are numbered. Empty
+// list items are left out, so clearing a field removes it.
+func decodePerformanceEdit(f url.Values, pre string) performanceEdit {
+	val := func(name string, j int) string {
+		if j >= 0 {
+			name = fmt.Sprintf("%s-%d", name, j)
+		}
+		return strings.TrimSpace(f.Get(pre + name))
+	}
+	items := func(name string) int {
+		n := 0
+		for {
+			if _, ok := f[fmt.Sprintf("%s%s-%d", pre, name, n)]; !ok {
+				return n
+			}
+			n++
+		}
+	}
+
+	var rv performanceEdit
+	rv.Composer = speeldoos.Composer{
+		Name: val("composer", -1),
+		ID:   val("composer-id", -1),
+	}
+	rv.WorkYear = val("work-year", -1)
+	rv.Year = val("year", -1)
+
+	for j, n := 0, items("title"); j < n; j++ {
+		if t := val("title", j); t != "" {
+			rv.Titles = append(rv.Titles, speeldoos.Title{Title: t, Language: val("title-lang", j)})
+		}
+	}
+	for j, n := 0, items("opus"); j < n; j++ {
+		if o := val("opus", j); o != "" {
+			rv.OpusNumbers = append(rv.OpusNumbers, speeldoos.OpusNumber{Number: o, IndexName: val("opus-index", j)})
+		}
+	}
+	for j, n := 0, items("part"); j < n; j++ {
+		if p := val("part", j); p != "" {
+			rv.Parts = append(rv.Parts, speeldoos.Part{Part: p, Number: val("part-number", j)})
+		}
+	}
+	for j, n := 0, items("performer"); j < n; j++ {
+		if p := val("performer", j); p != "" {
+			rv.Performers = append(rv.Performers, speeldoos.Performer{Name: p, Role: val("performer-role", j)})
+		}
+	}
+
+	return rv
+}
+
+func (h editCarrierHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(editCarrierRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleEditCarrier(s, req)
+}
+
+type editCarrierRequest struct {
+	CarrierID string
+
+	// Submitted is set if the request contains changes to the carrier
+	Submitted    bool
+	Name         string
+	Performances []performanceEdit
+}
+
+func (editCarrierRequest) FlaggedAsRequest() {}
+
+// A performanceEdit contains the editable fields of a performance
+type performanceEdit struct {
+	Composer    speeldoos.Composer
+	Titles      []speeldoos.Title
+	OpusNumbers []speeldoos.OpusNumber
+	Parts       []speeldoos.Part
+	Performers  []speeldoos.Performer
+
+	// The years are validated along with everything else, so they're kept as strings
+	WorkYear string
+	Year     string
+}
+
+// apply copies the changes to a performance, and returns any problems with them
+func (ed performanceEdit) apply(pf *speeldoos.Performance) []string {
+	var rv []string
+	var err error
+
+	pf.Work.Composer = ed.Composer
+	pf.Work.Title = ed.Titles
+	pf.Work.OpusNumber = ed.OpusNumbers
+	pf.Work.Parts = ed.Parts
+	pf.Performers = ed.Performers
+
+	pf.Work.Year, err = parseYear(ed.WorkYear)
+	if err != nil {
+		rv = append(rv, err.Error())
+	}
+	pf.Year, err = parseYear(ed.Year)
+	if err != nil {
+		rv = append(rv, err.Error())
+	}
+
+	if len(pf.Work.Title) == 0 {
+		rv = append(rv, "no title")
+	}
+	for _, p := range pf.Performers {
+		if !validRole(p.Role) {
+			rv = append(rv, fmt.Sprintf("invalid role '%s' for %s", p.Role, p.Name))
+		}
+	}
+
+	return rv
+}
+
+type editCarrierResponse struct {
+	Carrier *speeldoos.Carrier
+
+	// Saved is set if the changes were written to disk
+	Saved bool
+
+	// Problems that prevented saving the carrier
+	Errors []string
+
+	// Problems that were fixed automatically
+	Fixed []string
+
+	// The performer roles to choose from
+	Roles []string
+
+	// The number of empty rows to add to every list, for adding new items
+	Extra []int
+}
+
+func (editCarrierResponse) FlaggedAsResponse() {}
@@ -0,0 +1,185 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+// Event types pushed over /api/events
+const (
+	EventNowPlaying = "nowplaying"
+	EventQueue      = "queue"
+	EventLibrary    = "library"
+)
+
+// An Event notifies subscribers of a change in server state
+type Event struct {
+	Type string
+
+	// The station this event pertains to; empty for the default station, or
+	// for events that don't pertain to any station
+	Station string
+
+	Data interface{}
+}
+
+// An EventSource allows subscribing to server events
+type EventSource interface {
+	// Subscribe returns a channel that receives all events from now on, and a
+	// function that cancels the subscription.
+	Subscribe() (<-chan Event, func())
+}
+
+// NowPlayingEvent is the payload of a nowplaying event
+type NowPlayingEvent struct {
+	ID          string
+	Performance speeldoos.Performance
+}
+
+// QueueEvent is the payload of a queue event
+type QueueEvent struct {
+	Queue []QueueItem
+}
+
+// A QueueItem is one performance in the play queue
+type QueueItem struct {
+	ID          string
+	Performance speeldoos.Performance
+}
+
+// NewNowPlayingEvent creates a nowplaying event for a station
+func NewNowPlayingEvent(station string, pf speeldoos.Performance) Event {
+	rv := NowPlayingEvent{Performance: pf}
+	if pf.ID != (speeldoos.PerformanceID{}) {
+		rv.ID = pf.ID.String()
+	}
+	return Event{Type: EventNowPlaying, Station: station, Data: rv}
+}
+
+// NewQueueEvent creates a queue event for a station
+func NewQueueEvent(station string, lib *speeldoos.Library, queue []speeldoos.PerformanceID) Event {
+	rv := QueueEvent{Queue: []QueueItem{}}
+	for _, pfid := range queue {
+		item := QueueItem{ID: pfid.String()}
+		if lib != nil {
+			item.Performance, _ = lib.GetPerformance(pfid)
+		}
+		rv.Queue = append(rv.Queue, item)
+	}
+	return Event{Type: EventQueue, Station: station, Data: rv}
+}
+
+var EventsHandler eventsHandler
+
+type eventsHandler struct{}
+
+func (eventsHandler) handleEvents(s State, r eventsRequest) (State, eventsResponse, error) {
+	var rv eventsResponse
+
+	if s.Events == nil {
+		return s, rv, errNotFound("No events", "This server does not publish events")
+	}
+	rv.Events = s.Events
+
+	// Start off with the current state of all stations, so clients don't
+	// have to query it separately
+	for _, st := range s.Stations {
+		rv.Initial = append(rv.Initial, NewNowPlayingEvent(st.Name, st.NowPlaying))
+	}
+	rv.Initial = append(rv.Initial, NewQueueEvent(s.Station, s.Library, s.PlayQueue))
+
+	return s, rv, nil
+}
+
+func (eventsHandler) DecodeRequest(r *http.Request) (Request, error) {
+	return eventsRequest{}, nil
+}
+
+func (h eventsHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(eventsRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleEvents(s, req)
+}
+
+type eventsRequest struct{}
+
+func (eventsRequest) FlaggedAsRequest() {}
+
+type eventsResponse struct {
+	Events  EventSource
+	Initial []Event
+}
+
+func (eventsResponse) FlaggedAsResponse() {}
+
+// eventKeepAlive is the interval between comments sent to keep idle
+// connections from timing out
+const eventKeepAlive = 30 * time.Second
+
+func (e eventsResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := e.Events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: 5000\n\n")
+	for _, ev := range e.Initial {
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprintf(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev Event) error {
+	data, err := json.Marshal(struct {
+		Station string
+		Data    interface{}
+	}{ev.Station, ev.Data})
+	if err != nil {
+		log.Printf("error encoding %s event: %v", ev.Type, err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
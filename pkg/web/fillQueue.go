@@ -0,0 +1,94 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/users"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+var FillQueueHandler fillQueueHandler
+
+type fillQueueHandler struct{}
+
+func (fillQueueHandler) RequiredRole() users.Role {
+	return users.RoleDJ
+}
+
+func (fillQueueHandler) handleFillQueue(s State, r fillQueueRequest) (State, fillQueueResponse, error) {
+	var rv fillQueueResponse
+
+	// Working out the programme can take a while, so let the scheduler add it
+	// to the queue as it is by then, rather than to the copy in s.PlayQueue
+	prog, err := s.Scheduler.FillWindow(r.Window)
+	if err != nil {
+		return s, rv, err
+	}
+	if len(prog.Performances) > 0 {
+		s.PlayQueueChanged = true
+	}
+
+	s.Scheduler.QueueMutex.RLock()
+	s.PlayQueue = append(s.PlayQueue[:0], s.Scheduler.PlayQueue...)
+	s.Scheduler.QueueMutex.RUnlock()
+
+	rv.Window = prog.Window.Seconds()
+	rv.Queued = prog.Queued.Seconds()
+	rv.Scheduled = prog.Scheduled.Seconds()
+	rv.Slack = prog.Slack().Seconds()
+	rv.Fill = prog.Fill()
+	rv.Added = prog.Performances
+
+	rv.Queue = make([]speeldoos.Performance, 0, len(s.PlayQueue))
+	for _, pfid := range s.PlayQueue {
+		p, er := s.Library.GetPerformance(pfid)
+		if er == nil {
+			rv.Queue = append(rv.Queue, p)
+		}
+	}
+
+	return s, rv, nil
+}
+
+func (fillQueueHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var err error
+	rv := fillQueueRequest{}
+
+	rv.Window, err = speeldoos.ParseWindow(r.PostFormValue("for"), time.Now())
+	if err != nil {
+		err = weberrors.WithStatus(err, 400)
+	}
+	return rv, err
+}
+
+func (h fillQueueHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(fillQueueRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleFillQueue(s, req)
+}
+
+type fillQueueRequest struct {
+	Window time.Duration
+}
+
+func (fillQueueRequest) FlaggedAsRequest() {}
+
+// A fillQueueResponse reports how well the time slot was filled. All
+// durations are in seconds.
+type fillQueueResponse struct {
+	Window    float64
+	Queued    float64
+	Scheduled float64
+	Slack     float64
+	Fill      float64
+
+	Added []speeldoos.Performance
+	Queue []speeldoos.Performance
+}
+
+func (fillQueueResponse) FlaggedAsResponse() {}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
+)
+
+// The target length of each HLS segment
+const hlsSegmentLength = 6 * time.Second
+
+var HLSPlaylistHandler hlsPlaylistHandler
+var HLSSegmentHandler hlsSegmentHandler
+
+var errNoSegmenter = errors.New("this stream does not support segmenting")
+
+type hlsPlaylistHandler struct{}
+
+func (hlsPlaylistHandler) handleHLSPlaylist(s State, r hlsPlaylistRequest) (State, hlsPlaylistResponse, error) {
+	var rv hlsPlaylistResponse
+
+	seg, ok := s.MP3Stream.(chunker.Segmenter)
+	if !ok {
+		return s, rv, weberrors.WithStatus(errNoSegmenter, 404)
+	}
+
+	rv.Segments = seg.Segments(hlsSegmentLength)
+	rv.Token = r.Token
+	return s, rv, nil
+}
+
+func (hlsPlaylistHandler) DecodeRequest(r *http.Request) (Request, error) {
+	return hlsPlaylistRequest{
+		Token: r.URL.Query().Get("token"),
+	}, nil
+}
+
+func (h hlsPlaylistHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(hlsPlaylistRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleHLSPlaylist(s, req)
+}
+
+type hlsPlaylistRequest struct {
+	// The API token the playlist was requested with, if any
+	Token string
+}
+
+func (hlsPlaylistRequest) FlaggedAsRequest() {}
+
+type hlsPlaylistResponse struct {
+	Segments []chunker.Segment
+
+	// If set, segment URLs carry this API token, so players that can only
+	// authenticate through the URL can fetch them
+	Token string
+}
+
+func (hlsPlaylistResponse) FlaggedAsResponse() {}
+
+func (p hlsPlaylistResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(p.Bytes())
+}
+
+// Bytes renders the live playlist in M3U8 format
+func (p hlsPlaylistResponse) Bytes() []byte {
+	var b bytes.Buffer
+
+	target := int(hlsSegmentLength / time.Second)
+	for _, seg := range p.Segments {
+		if d := int(math.Ceil(seg.Duration.Seconds())); d > target {
+			target = d
+		}
+	}
+
+	fmt.Fprintf(&b, "#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", target)
+	if len(p.Segments) > 0 {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.Segments[0].Sequence)
+	}
+
+	query := ""
+	if p.Token != "" {
+		query = "?token=" + url.QueryEscape(p.Token)
+	}
+
+	for _, seg := range p.Segments {
+		fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", seg.Start.UTC().Format("2006-01-02T15:04:05.000Z"))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", seg.Duration.Seconds())
+		fmt.Fprintf(&b, "hls/%d.mp3%s\n", seg.Sequence, query)
+	}
+
+	return b.Bytes()
+}
+
+type hlsSegmentHandler struct{}
+
+func (hlsSegmentHandler) handleHLSSegment(s State, r hlsSegmentRequest) (State, hlsSegmentResponse, error) {
+	var rv hlsSegmentResponse
+
+	seg, ok := s.MP3Stream.(chunker.Segmenter)
+	if !ok {
+		return s, rv, weberrors.WithStatus(errNoSegmenter, 404)
+	}
+
+	var err error
+	rv.Segment, err = seg.Segment(hlsSegmentLength, r.Sequence)
+	if err != nil {
+		return s, rv, weberrors.WithStatus(err, 404)
+	}
+
+	return s, rv, nil
+}
+
+func (hlsSegmentHandler) DecodeRequest(r *http.Request) (Request, error) {
+	name := path.Base(r.URL.Path)
+	if !strings.HasSuffix(name, ".mp3") {
+		return nil, errNotFound("", "")
+	}
+
+	seq, err := strconv.ParseInt(strings.TrimSuffix(name, ".mp3"), 10, 64)
+	if err != nil {
+		return nil, errNotFound("", "")
+	}
+
+	return hlsSegmentRequest{Sequence: seq}, nil
+}
+
+func (h hlsSegmentHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(hlsSegmentRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleHLSSegment(s, req)
+}
+
+type hlsSegmentRequest struct {
+	Sequence int64
+}
+
+func (hlsSegmentRequest) FlaggedAsRequest() {}
+
+type hlsSegmentResponse struct {
+	Segment chunker.Segment
+}
+
+func (hlsSegmentResponse) FlaggedAsResponse() {}
+
+func (h hlsSegmentResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.Write(id3Timestamp(h.Segment.Start))
+	w.Write(h.Segment.Contents)
+}
+
+// id3Timestamp creates the ID3 tag HLS requires at the start of a packed
+// audio segment. It carries the segment's start time as a 33-bit MPEG-2
+// timestamp (in units of 1/90000s) in a PRIV frame.
+func id3Timestamp(t time.Time) []byte {
+	const owner = "com.apple.streaming.transportStreamTimestamp\x00"
+	ts := uint64(t.UnixNano()/1000*9/100) & (1<<33 - 1)
+
+	frameSize := len(owner) + 8
+
+	var b bytes.Buffer
+	b.WriteString("ID3\x04\x00\x00")
+	b.Write(syncsafe(10 + frameSize))
+	b.WriteString("PRIV")
+	b.Write(syncsafe(frameSize))
+	b.Write([]byte{0, 0})
+	b.WriteString(owner)
+	binary.Write(&b, binary.BigEndian, ts)
+
+	return b.Bytes()
+}
+
+func syncsafe(n int) []byte {
+	return []byte{
+		byte(n>>21) & 0x7f,
+		byte(n>>14) & 0x7f,
+		byte(n>>7) & 0x7f,
+		byte(n) & 0x7f,
+	}
+}
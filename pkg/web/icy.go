@@ -0,0 +1,108 @@
+package web
+
+import (
+	"io"
+	"strings"
+
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+// The number of audio bytes between two ICY metadata blocks
+const icyMetaInt = 16000
+
+// An icyWriter interleaves an audio stream with Shoutcast-style metadata
+// blocks. Each block is sent after exactly MetaInt bytes of audio; it is
+// empty unless the stream title changed since the previous block.
+type icyWriter struct {
+	target    io.Writer
+	metaInt   int
+	untilMeta int
+	title     string
+	sentTitle string
+}
+
+func newICYWriter(target io.Writer, metaInt int) *icyWriter {
+	return &icyWriter{
+		target:    target,
+		metaInt:   metaInt,
+		untilMeta: metaInt,
+	}
+}
+
+// SetTitle sets the stream title to be sent in the next metadata block
+func (w *icyWriter) SetTitle(title string) {
+	w.title = title
+}
+
+func (w *icyWriter) Write(buf []byte) (int, error) {
+	written := 0
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > w.untilMeta {
+			n = w.untilMeta
+		}
+
+		nw, err := w.target.Write(buf[:n])
+		written += nw
+		w.untilMeta -= nw
+		if err != nil {
+			return written, err
+		}
+		buf = buf[n:]
+
+		if w.untilMeta == 0 {
+			if _, err := w.target.Write(w.metadataBlock()); err != nil {
+				return written, err
+			}
+			w.untilMeta = w.metaInt
+		}
+	}
+	return written, nil
+}
+
+func (w *icyWriter) metadataBlock() []byte {
+	if w.title == w.sentTitle {
+		return []byte{0}
+	}
+	w.sentTitle = w.title
+
+	// There's no escape mechanism for quotes in ICY metadata
+	title := strings.ReplaceAll(w.title, "'", "’")
+
+	// The length byte counts 16-byte blocks, so the payload can't exceed 4080 bytes
+	maxTitle := 255*16 - len("StreamTitle='';")
+	if len(title) > maxTitle {
+		title = strings.ToValidUTF8(title[:maxTitle], "")
+	}
+
+	payload := "StreamTitle='" + title + "';"
+	l := (len(payload) + 15) / 16
+
+	rv := make([]byte, 1+16*l)
+	rv[0] = byte(l)
+	copy(rv[1:], payload)
+	return rv
+}
+
+// icyTitle formats a performance as "Composer - Work (Performers)"
+func icyTitle(pf speeldoos.Performance) string {
+	rv := pf.Work.Composer.Name
+	if len(pf.Work.Title) > 0 {
+		if rv != "" {
+			rv += " - "
+		}
+		rv += pf.Work.Title[0].Title
+	}
+
+	var performers []string
+	for _, p := range pf.Performers {
+		if p.Name != "" {
+			performers = append(performers, p.Name)
+		}
+	}
+	if len(performers) > 0 {
+		rv += " (" + strings.Join(performers, ", ") + ")"
+	}
+
+	return rv
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+func TestICYWriter(t *testing.T) {
+	var b bytes.Buffer
+	iw := newICYWriter(&b, 10)
+
+	iw.SetTitle("Foo")
+	iw.Write([]byte("0123456"))
+	iw.Write([]byte("789abcdefghij"))
+	iw.SetTitle("Bar")
+	iw.Write([]byte("klmnopqrstuvwxyz"))
+
+	meta := func(title string) string {
+		payload := "StreamTitle='" + title + "';"
+		return "\x02" + payload + strings.Repeat("\x00", 32-len(payload))
+	}
+
+	exp := "0123456789" + meta("Foo") + "abcdefghij" + "\x00" + "klmnopqrst" + meta("Bar") + "uvwxyz"
+	if b.String() != exp {
+		t.Errorf("unexpected ICY stream:\n%q\nexpected:\n%q", b.String(), exp)
+	}
+}
+
+func TestICYTitle(t *testing.T) {
+	pf := speeldoos.Performance{
+		Work: speeldoos.Work{
+			Composer: speeldoos.Composer{Name: "Gustav Mahler"},
+			Title:    []speeldoos.Title{{Title: "Symphony No. 2"}},
+		},
+		Performers: []speeldoos.Performer{
+			{Name: "Berliner Philharmoniker", Role: "orchestra"},
+			{Name: "Claudio Abbado", Role: "conductor"},
+		},
+	}
+
+	exp := "Gustav Mahler - Symphony No. 2 (Berliner Philharmoniker, Claudio Abbado)"
+	if title := icyTitle(pf); title != exp {
+		t.Errorf("expected title '%s', got '%s'", exp, title)
+	}
+}
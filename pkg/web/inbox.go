@@ -0,0 +1,399 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/users"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+// Inbox
+
+var InboxHandler inboxHandler
+
+type inboxHandler struct{}
+
+func (inboxHandler) RequiredRole() users.Role {
+	return users.RoleAdmin
+}
+
+func (inboxHandler) handleInbox(s State, r inboxRequest) (State, inboxResponse, error) {
+	var rv inboxResponse
+
+	for _, pc := range s.Library.InboxItems() {
+		it := inboxItem{
+			Name: path.Base(pc.Filename),
+		}
+		it.URL = "inbox/" + url.PathEscape(it.Name)
+		if pc.Carrier != nil {
+			for _, pf := range pc.Carrier.Performances {
+				it.Works++
+				it.Files += len(pf.SourceFiles)
+			}
+		}
+		if pc.Error != nil {
+			it.Error = pc.Error.Error()
+		}
+		rv.Items = append(rv.Items, it)
+	}
+
+	return s, rv, nil
+}
+
+func (inboxHandler) DecodeRequest(r *http.Request) (Request, error) {
+	return inboxRequest{}, nil
+}
+
+func (h inboxHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(inboxRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleInbox(s, req)
+}
+
+type inboxRequest struct{}
+
+func (inboxRequest) FlaggedAsRequest() {}
+
+type inboxResponse struct {
+	Items []inboxItem
+}
+
+func (inboxResponse) FlaggedAsResponse() {}
+
+// An inboxItem summarises an untagged file or directory in the inbox
+type inboxItem struct {
+	Name  string
+	URL   string
+	Works int
+	Files int
+	Error string `json:",omitempty"`
+}
+
+// Inbox item
+
+var InboxItemHandler inboxItemHandler
+
+type inboxItemHandler struct{}
+
+func (inboxItemHandler) RequiredRole() users.Role {
+	return users.RoleAdmin
+}
+
+func (inboxItemHandler) handleInboxItem(s State, r inboxItemRequest) (State, inboxItemResponse, error) {
+	rv := inboxItemResponse{
+		Name:  r.Name,
+		URL:   "inbox/" + url.PathEscape(r.Name),
+		Roles: performerRoles,
+		Extra: []int{0, 1},
+	}
+
+	var item speeldoos.ParsedCarrier
+	for _, pc := range s.Library.InboxItems() {
+		if path.Base(pc.Filename) == r.Name && pc.Carrier != nil {
+			item = pc
+		}
+	}
+	if item.Carrier == nil {
+		return s, rv, errNotFound("", fmt.Sprintf("There's no item called '%s' in the inbox", r.Name))
+	}
+	rv.Notes = item.Notes
+
+	// Every source file in the inbox item becomes a track, which can be
+	// previewed in the performance it was detected in.
+	var tracks []inboxTrack
+	var sourceFiles []speeldoos.SourceFile
+	for _, pf := range item.Carrier.Performances {
+		for k, sf := range pf.SourceFiles {
+			t := inboxTrack{
+				Index:    len(tracks),
+				Filename: sf.Filename,
+				Start:    k == 0,
+			}
+			if k < len(pf.Work.Parts) {
+				t.Part = pf.Work.Parts[k].Part
+			}
+			if pf.ID.Carrier() != "" {
+				t.Preview = fmt.Sprintf("performance/%s/audio?part=%d", url.PathEscape(pf.ID.String()), k+1)
+			}
+			tracks = append(tracks, t)
+			sourceFiles = append(sourceFiles, sf)
+		}
+	}
+
+	if !r.Submitted {
+		rv.Carrier = speeldoos.Carrier{
+			Name:   item.Carrier.Name,
+			Source: item.Carrier.Source,
+		}
+		if rv.Carrier.Name == "" {
+			rv.Carrier.Name = strings.TrimSuffix(r.Name, ".zip")
+		}
+		for _, pf := range item.Carrier.Performances {
+			// Placeholder titles and years are better left blank
+			if pf.Work.Year == 2222 {
+				pf.Work.Title = nil
+				pf.Work.Year = 0
+			}
+			if pf.Year == 2222 {
+				pf.Year = 0
+			}
+			pf.Work.Parts = nil
+			rv.Carrier.Performances = append(rv.Carrier.Performances, pf)
+		}
+		rv.Works = groupTracks(rv.Carrier.Performances, tracks)
+		return s, rv, nil
+	}
+
+	if len(r.Parts) != len(tracks) {
+		return s, rv, weberrors.WithStatus(fmt.Errorf("expected %d tracks; got %d", len(tracks), len(r.Parts)), 400)
+	}
+
+	// Divide the tracks into works at every track that starts a new one
+	rv.Carrier = speeldoos.Carrier{
+		ID:     r.ID,
+		Name:   r.CarrierName,
+		Source: r.Source,
+	}
+	var prev performanceEdit
+	for i := range tracks {
+		tracks[i].Part = r.Parts[i]
+		tracks[i].Start = i == 0 || r.Starts[i]
+		if !tracks[i].Start {
+			continue
+		}
+
+		end := i + 1
+		for end < len(tracks) && !r.Starts[end] {
+			end++
+		}
+
+		// A work that was just split off inherits the composer and
+		// performers of the one it was part of
+		ed, ok := r.Works[i]
+		if !ok {
+			ed = performanceEdit{
+				Composer:   prev.Composer,
+				Performers: prev.Performers,
+				Year:       prev.Year,
+			}
+		}
+		prev = ed
+
+		var pf speeldoos.Performance
+		for _, e := range ed.apply(&pf) {
+			if r.Save {
+				rv.Errors = append(rv.Errors, fmt.Sprintf("work %d: %s", len(rv.Carrier.Performances)+1, e))
+			}
+		}
+
+		pf.SourceFiles = sourceFiles[i:end]
+		pf.Work.Parts = nil
+		for _, t := range r.Parts[i:end] {
+			pf.Work.Parts = append(pf.Work.Parts, speeldoos.Part{Part: t})
+		}
+
+		rv.Carrier.Performances = append(rv.Carrier.Performances, pf)
+	}
+	rv.Works = groupTracks(rv.Carrier.Performances, tracks)
+
+	if !r.Save {
+		// Keep the draft, so it survives the next refresh
+		err := s.Library.SaveInboxDraft(item, &rv.Carrier)
+		return s, rv, err
+	}
+
+	if strings.ContainsAny(r.ID, "|/") {
+		rv.Errors = append(rv.Errors, fmt.Sprintf("invalid carrier ID '%s'", r.ID))
+	} else if _, err := s.Library.GetCarrier(r.ID); err == nil {
+		rv.Errors = append(rv.Errors, fmt.Sprintf("there already is a carrier with ID '%s'", r.ID))
+	}
+
+	car := rv.Carrier
+	car.Performances = append([]speeldoos.Performance{}, rv.Carrier.Performances...)
+	for i, pf := range car.Performances {
+		// A work that consists of one track has no parts
+		if len(pf.SourceFiles) == 1 {
+			car.Performances[i].Work.Parts = nil
+		}
+	}
+	for _, e := range speeldoos.CheckCarrier(&car, s.Library.LibraryDir) {
+		if _, ok := e.(speeldoos.FixableError); ok {
+			rv.Fixed = append(rv.Fixed, e.Error())
+		} else {
+			rv.Errors = append(rv.Errors, e.Error())
+		}
+	}
+	if len(rv.Errors) > 0 {
+		return s, rv, nil
+	}
+
+	filename, err := s.Library.TagInboxItem(item, &car)
+	if err != nil {
+		return s, rv, err
+	}
+	rv.Carrier = car
+	rv.Saved = true
+	rv.Filename = strings.TrimLeft(strings.TrimPrefix(filename, s.Library.LibraryDir), "/")
+	rv.EditURL = "edit/carrier/" + url.PathEscape(car.ID)
+
+	return s, rv, nil
+}
+
+// groupTracks divides the tracks among the performances they belong to
+func groupTracks(performances []speeldoos.Performance, tracks []inboxTrack) []inboxWork {
+	var rv []inboxWork
+	i := 0
+	for _, pf := range performances {
+		w := inboxWork{
+			Start:       i,
+			Performance: pf,
+		}
+		for range pf.SourceFiles {
+			if i < len(tracks) {
+				w.Tracks = append(w.Tracks, tracks[i])
+			}
+			i++
+		}
+		rv = append(rv, w)
+	}
+	return rv
+}
+
+func (inboxItemHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv inboxItemRequest
+	var err error
+
+	// The URL path is /inbox/{name}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 3 {
+		return rv, errNotFound("", "")
+	}
+	rv.Name, err = url.PathUnescape(parts[2])
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+
+	if r.Method != "POST" {
+		return rv, nil
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+	f := r.PostForm
+
+	rv.Submitted = true
+	rv.Save = f.Get("action") == "save"
+	rv.ID = strings.TrimSpace(f.Get("id"))
+	rv.CarrierName = strings.TrimSpace(f.Get("name"))
+	rv.Source = strings.TrimSpace(f.Get("source"))
+	rv.Works = make(map[int]performanceEdit)
+
+	for i := 0; ; i++ {
+		pre := fmt.Sprintf("track%d-", i)
+		if _, ok := f[pre+"part"]; !ok {
+			break
+		}
+		rv.Parts = append(rv.Parts, strings.TrimSpace(f.Get(pre+"part")))
+		rv.Starts = append(rv.Starts, f.Get(pre+"start") != "")
+
+		pre = fmt.Sprintf("work%d-", i)
+		if _, ok := f[pre+"composer"]; ok {
+			rv.Works[i] = decodePerformanceEdit(f, pre)
+		}
+	}
+
+	return rv, nil
+}
+
+func (h inboxItemHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(inboxItemRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleInboxItem(s, req)
+}
+
+type inboxItemRequest struct {
+	// The file name of the inbox item
+	Name string
+
+	// Submitted is set if the request contains a draft of the carrier. If
+	// Save is set too, the draft should be saved.
+	Submitted bool
+	Save      bool
+
+	ID          string
+	CarrierName string
+	Source      string
+
+	// The part title of every track, and whether or not it starts a new work
+	Parts  []string
+	Starts []bool
+
+	// The details of each work, by the index of its first track
+	Works map[int]performanceEdit
+}
+
+func (inboxItemRequest) FlaggedAsRequest() {}
+
+type inboxItemResponse struct {
+	Name    string
+	URL     string
+	Carrier speeldoos.Carrier
+	Works   []inboxWork
+
+	// Notes on how the contents of the item were detected
+	Notes []speeldoos.InferenceNote
+
+	// Saved is set if the carrier was saved, to this file in the library directory
+	Saved    bool
+	Filename string
+	EditURL  string
+
+	// Problems that prevented saving the carrier
+	Errors []string
+
+	// Problems that were fixed automatically
+	Fixed []string
+
+	// The performer roles to choose from
+	Roles []string
+
+	// The number of empty rows to add to every list, for adding new items
+	Extra []int
+}
+
+func (inboxItemResponse) FlaggedAsResponse() {}
+
+// An inboxWork is a draft performance, along with its tracks
+type inboxWork struct {
+	// The index of the first track
+	Start int
+
+	Performance speeldoos.Performance
+	Tracks      []inboxTrack
+}
+
+// An inboxTrack is one source file in an inbox item
+type inboxTrack struct {
+	Index    int
+	Filename string
+	Part     string
+
+	// Start is set if this track starts a new work
+	Start bool
+
+	// The URL at which this track can be played
+	Preview string
+}
@@ -2,6 +2,8 @@ package web
 
 import (
 	"net/http"
+	"net/url"
+	"path"
 	"sort"
 	"strings"
 
@@ -13,11 +15,24 @@ var LibraryHandler libraryHandler
 type libraryHandler struct{}
 
 func (libraryHandler) handleLibrary(s State, r libraryRequest) (State, libraryResponse, error) {
-	var rv libraryResponse
+	rv := libraryResponse{
+		Covers:   make(map[string]string),
+		Inbox:    make(map[string]string),
+		Editable: Authorize(EditCarrierHandler, s) == nil,
+	}
+
+	for _, pc := range s.Library.InboxItems() {
+		if pc.Carrier != nil {
+			rv.Inbox[pc.Carrier.ID] = "inbox/" + url.PathEscape(path.Base(pc.Filename))
+		}
+	}
 
-	for _, car := range s.Library.Carriers {
+	for _, car := range s.Library.ParsedCarriers() {
 		if car.Error == nil {
 			rv.Performances = append(rv.Performances, car.Carrier.Performances...)
+			if u := coverURL(s.Library, car.Carrier.ID, 64); u != "" {
+				rv.Covers[car.Carrier.ID] = u
+			}
 		} else {
 			rv.FailedCarriers = append(rv.FailedCarriers, car)
 		}
@@ -49,6 +64,15 @@ func (libraryRequest) FlaggedAsRequest() {}
 type libraryResponse struct {
 	Performances   []speeldoos.Performance
 	FailedCarriers []speeldoos.ParsedCarrier
+
+	// Cover thumbnail URLs, by carrier ID
+	Covers map[string]string
+
+	// Inbox page URLs of the carriers that haven't been tagged yet, by carrier ID
+	Inbox map[string]string
+
+	// Editable is set if the current user may edit carriers
+	Editable bool
 }
 
 func (r *libraryResponse) Len() int {
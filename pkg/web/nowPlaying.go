@@ -14,6 +14,9 @@ func (nowPlayingHandler) handleNowPlaying(s State, r nowPlayingRequest) (State,
 	rv := nowPlayingResponse{
 		NowPlaying: s.NowPlaying,
 	}
+	if s.NowPlaying.ID.Carrier() != "" {
+		rv.Cover = coverURL(s.Library, s.NowPlaying.ID.Carrier(), 256)
+	}
 
 	if s.Buffers.Scheduler != nil {
 		sch := s.Buffers.Scheduler.BufferStatus()
@@ -61,6 +64,9 @@ func (nowPlayingRequest) FlaggedAsRequest() {}
 type nowPlayingResponse struct {
 	NowPlaying speeldoos.Performance
 	UpNext     []speeldoos.Performance
+
+	// The URL of the cover art of the current performance, if it has any
+	Cover string `json:",omitempty"`
 }
 
 func (nowPlayingResponse) FlaggedAsResponse() {}
@@ -0,0 +1,228 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/transcodecache"
+	speeldoos "github.com/thijzert/speeldoos/pkg"
+)
+
+var PerformanceAudioHandler performanceAudioHandler
+
+type performanceAudioHandler struct{}
+
+func (performanceAudioHandler) handlePerformanceAudio(s State, r performanceAudioRequest) (State, performanceAudioResponse, error) {
+	var rv performanceAudioResponse
+
+	pf, err := s.Library.GetPerformance(r.PerformanceID)
+	if err != nil {
+		return s, rv, weberrors.WithStatus(err, 404)
+	}
+
+	audio, err := s.Library.OpenAudio(pf)
+	if err != nil {
+		return s, rv, err
+	}
+
+	start := r.Start
+	if r.Part > 0 {
+		start, err = audio.PartStart(r.Part - 1)
+		if err != nil {
+			audio.Close()
+			return s, rv, weberrors.WithStatus(err, 400)
+		}
+	}
+	if start > 0 {
+		err = audio.StartAt(start)
+		if err != nil {
+			audio.Close()
+			return s, rv, weberrors.WithStatus(err, 400)
+		}
+	}
+
+	rv.Type = r.Type
+	rv.Name = pf.ID.String()
+	rv.Audio = audio
+	rv.Library = s.Library
+
+	// Only complete transcodes are cached
+	if r.Type == typeMP3 && start == 0 && s.TranscodeCache != nil {
+		hash, err := s.Library.SourceHash(pf)
+		if err != nil {
+			log.Printf("not caching %s: %v", pf.ID, err)
+		} else {
+			rv.Cache = s.TranscodeCache
+			rv.CacheKey = transcodecache.Key(hash, s.Library.WAVConf.MP3Settings())
+		}
+	}
+
+	return s, rv, nil
+}
+
+func (performanceAudioHandler) DecodeRequest(r *http.Request) (Request, error) {
+	var rv performanceAudioRequest
+	var err error
+
+	// The URL path is /performance/{id}/audio[.mp3]
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 4 {
+		return rv, errNotFound("", "")
+	}
+
+	if parts[3] == "audio" {
+		rv.Type = typeWAV
+	} else if parts[3] == "audio.mp3" {
+		rv.Type = typeMP3
+	} else {
+		return rv, errNotFound("", "")
+	}
+
+	pfid, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+	rv.PerformanceID, err = speeldoos.ParsePerformanceID(pfid)
+	if err != nil {
+		return rv, weberrors.WithStatus(err, 400)
+	}
+
+	if t := r.FormValue("t"); t != "" {
+		rv.Start, err = parseSeekTime(t)
+		if err != nil {
+			return rv, weberrors.WithStatus(err, 400)
+		}
+	}
+
+	if p := r.FormValue("part"); p != "" {
+		rv.Part, err = strconv.Atoi(p)
+		if err != nil || rv.Part < 1 {
+			return rv, weberrors.WithStatus(fmt.Errorf("invalid part number '%s'", p), 400)
+		}
+	}
+
+	return rv, nil
+}
+
+// parseSeekTime accepts either a number of seconds or a Go-style duration
+func parseSeekTime(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (h performanceAudioHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(performanceAudioRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handlePerformanceAudio(s, req)
+}
+
+type performanceAudioRequest struct {
+	PerformanceID speeldoos.PerformanceID
+	Type          audioStreamType
+
+	// Start playback at this time offset
+	Start time.Duration
+
+	// Start playback at the beginning of this part (counting from 1)
+	Part int
+}
+
+func (performanceAudioRequest) FlaggedAsRequest() {}
+
+type performanceAudioResponse struct {
+	Type    audioStreamType
+	Name    string
+	Audio   *speeldoos.PerformanceAudio
+	Library *speeldoos.Library
+
+	Cache    *transcodecache.Cache
+	CacheKey string
+}
+
+func (performanceAudioResponse) FlaggedAsResponse() {}
+
+func (p performanceAudioResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer p.Audio.Close()
+
+	w.Header().Set("X-Content-Duration", fmt.Sprintf("%.3f", p.Audio.Duration().Seconds()))
+
+	if p.Type == typeWAV {
+		w.Header().Set("Content-Type", "audio/wav")
+		http.ServeContent(w, r, p.Name+".wav", time.Time{}, p.Audio)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+
+	if p.Cache != nil {
+		if f, err := p.Cache.Open(p.CacheKey); err == nil {
+			defer f.Close()
+			http.ServeContent(w, r, p.Name+".mp3", time.Time{}, f)
+			return
+		}
+	}
+
+	// The size of a fresh transcode isn't known in advance, so it can't
+	// support Range requests.
+	w.Header().Set("Accept-Ranges", "none")
+
+	var out io.Writer = w
+	var pending *transcodecache.Pending
+	if p.Cache != nil {
+		var err error
+		pending, err = p.Cache.Create(p.CacheKey)
+		if err != nil {
+			log.Print(err)
+		} else {
+			out = io.MultiWriter(w, pending)
+		}
+	}
+
+	err := p.transcode(out)
+	if pending != nil {
+		if err == nil {
+			err = pending.Commit()
+		} else {
+			pending.Abort()
+		}
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (p performanceAudioResponse) transcode(out io.Writer) error {
+	_, err := p.Audio.Seek(p.Audio.DataOffset(), io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	mp3, err := p.Library.WAVConf.ToMP3(out, p.Audio.Format())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(mp3, p.Audio)
+	if err != nil {
+		mp3.CloseWithError(err)
+		return err
+	}
+
+	err = mp3.Close()
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
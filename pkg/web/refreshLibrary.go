@@ -0,0 +1,66 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	weberrors "github.com/thijzert/speeldoos/internal/web-plumbing/errors"
+	"github.com/thijzert/speeldoos/lib/users"
+)
+
+var RefreshLibraryHandler refreshLibraryHandler
+
+type refreshLibraryHandler struct{}
+
+func (refreshLibraryHandler) RequiredRole() users.Role {
+	return users.RoleAdmin
+}
+
+func (refreshLibraryHandler) handleRefreshLibrary(s State, r refreshLibraryRequest) (State, refreshLibraryResponse, error) {
+	var rv refreshLibraryResponse
+
+	err := s.Library.Refresh()
+	if err != nil {
+		return s, rv, err
+	}
+
+	for _, pc := range s.Library.ParsedCarriers() {
+		if pc.Error == nil {
+			rv.Carriers++
+		} else {
+			rv.Errors++
+		}
+	}
+
+	return s, rv, nil
+}
+
+func (refreshLibraryHandler) DecodeRequest(r *http.Request) (Request, error) {
+	if r.Method != "POST" {
+		return refreshLibraryRequest{}, weberrors.WithStatus(errors.New("method not allowed"), 405)
+	}
+	return refreshLibraryRequest{}, nil
+}
+
+func (h refreshLibraryHandler) HandleRequest(s State, r Request) (State, Response, error) {
+	req, ok := r.(refreshLibraryRequest)
+	if !ok {
+		return withError(s, errWrongRequestType{})
+	}
+
+	return h.handleRefreshLibrary(s, req)
+}
+
+type refreshLibraryRequest struct{}
+
+func (refreshLibraryRequest) FlaggedAsRequest() {}
+
+type refreshLibraryResponse struct {
+	// The number of carriers successfully loaded
+	Carriers int
+
+	// The number of carriers that failed to parse
+	Errors int
+}
+
+func (refreshLibraryResponse) FlaggedAsResponse() {}
@@ -7,7 +7,11 @@ var StatusHandler statusHandler
 type statusHandler struct{}
 
 func (statusHandler) handleStatus(s State, r statusRequest) (State, statusResponse, error) {
-	return s, statusResponse{}, nil
+	var rv statusResponse
+	for _, st := range s.Stations {
+		rv.Stations = append(rv.Stations, stationBufferKeys(st.Name))
+	}
+	return s, rv, nil
 }
 
 func (statusHandler) DecodeRequest(r *http.Request) (Request, error) {
@@ -28,6 +32,8 @@ type statusRequest struct {
 
 func (statusRequest) FlaggedAsRequest() {}
 
-type statusResponse struct{}
+type statusResponse struct {
+	Stations []bufferKeys
+}
 
 func (statusResponse) FlaggedAsResponse() {}
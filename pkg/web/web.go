@@ -3,6 +3,8 @@ package web
 import (
 	"net/http"
 
+	"github.com/thijzert/speeldoos/lib/transcodecache"
+	"github.com/thijzert/speeldoos/lib/users"
 	"github.com/thijzert/speeldoos/lib/wavreader/chunker"
 	speeldoos "github.com/thijzert/speeldoos/pkg"
 )
@@ -15,12 +17,50 @@ type State struct {
 	PlayQueueDirty bool
 	PlayQueue      []speeldoos.PerformanceID
 
+	// The station's scheduler. Handlers that add to its queue directly, rather
+	// than through PlayQueue, set PlayQueueChanged so the new queue is announced.
+	Scheduler        *speeldoos.Scheduler
+	PlayQueueChanged bool
+
+	// The name of the station this request pertains to; empty for the default station
+	Station string
+
 	RawStream chunker.Chunker
 	MP3Stream chunker.Chunker
-	Buffers   struct {
-		Scheduler chunker.Statuser
-		MP3Stream chunker.Statuser
-	}
+	Buffers   StationBuffers
+
+	// Optional lossless and low-bitrate streams; nil if disabled
+	FLACStream chunker.Chunker
+	OpusStream chunker.Chunker
+
+	// All stations running on this server, including the default one
+	Stations []StationState
+
+	// The cache for transcoded performances; nil if disabled
+	TranscodeCache *transcodecache.Cache
+
+	// The source of server events; nil if unavailable
+	Events EventSource
+
+	// All user accounts; nil if authentication is disabled
+	Users *users.Store
+
+	// The user making this request, and their login session ID (if any)
+	User    *users.User
+	Session string
+}
+
+// StationBuffers wraps the buffers in a station's audio pipeline
+type StationBuffers struct {
+	Scheduler chunker.Statuser
+	MP3Stream chunker.Statuser
+}
+
+// A StationState summarises the state of one station
+type StationState struct {
+	Name       string
+	NowPlaying speeldoos.Performance
+	Buffers    StationBuffers
 }
 
 var (